@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"demandscience/internal/handlers"
+	"demandscience/internal/models"
 	"demandscience/internal/services"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -20,6 +26,10 @@ func main() {
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		runKeysCommand(os.Args[2:])
+		return
+	}
 	maxFileSizeStr := os.Getenv("MAX_FILE_SIZE")
 	maxFileSize, strErr := strconv.ParseInt(maxFileSizeStr, 10, 64)
 	if strErr != nil {
@@ -29,6 +39,25 @@ func main() {
 	csvService := services.DSCsvProcessingService()
 	csvHandler := handlers.DSCsvProcessorHandler(csvService)
 
+	keyService, err := services.DSAPIKeyService("")
+	if err != nil {
+		log.Fatal("Failed to load API keys:", err)
+	}
+	go keyService.ReloadPeriodically(10 * time.Second)
+	keyHandler := handlers.DSAPIKeyHandler(keyService)
+	tokens, err := services.DSTokenVerifierFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure bearer tokens:", err)
+	}
+	authHandler := handlers.DSAuthHandler(keyService, tokens)
+	if !services.APIAuthEnabled {
+		log.Println("Authentication is off; set API_AUTH_ENABLED=true to require API keys or bearer tokens")
+	}
+
+	if inbox := os.Getenv("HOT_FOLDER_INBOX"); inbox != "" {
+		startHotFolderWatcher(csvService, inbox)
+	}
+
 	router := gin.Default()
 	router.MaxMultipartMemory = maxFileSize
 
@@ -39,10 +68,42 @@ func main() {
 		})
 	})
 
-	api := router.Group("/API")
+	api := router.Group("/API", authHandler.Authenticate)
+	upload := api.Group("", authHandler.RequireScope(models.ScopeUpload))
 	{
-		api.POST("/upload", csvHandler.UploadFile)
-		api.GET("/download/:id", csvHandler.DownloadFile)
+		upload.POST("/upload", csvHandler.UploadFile)
+		upload.POST("/preview", csvHandler.PreviewFile)
+		upload.POST("/jobs/:id/cancel", csvHandler.CancelJob)
+		upload.POST("/jobs/:id/rerun", csvHandler.RerunJob)
+		upload.POST("/uploads", csvHandler.UploadFiles)
+		upload.POST("/resumable", csvHandler.CreateResumableUpload)
+		upload.HEAD("/resumable/:id", csvHandler.ResumableUploadOffset)
+		upload.GET("/resumable/:id", csvHandler.ResumableUploadStatus)
+		upload.PATCH("/resumable/:id", csvHandler.PatchResumableUpload)
+		upload.DELETE("/resumable/:id", csvHandler.DeleteResumableUpload)
+	}
+	read := api.Group("", authHandler.RequireScope(models.ScopeRead))
+	{
+		read.GET("/download/:id", csvHandler.DownloadFile)
+		read.GET("/download/:id/errors", csvHandler.DownloadRowErrors)
+		read.GET("/jobs", csvHandler.ListJobs)
+		read.GET("/jobs/:id", csvHandler.GetJob)
+		read.GET("/jobs/:id/output", csvHandler.DownloadJobOutput)
+		read.GET("/jobs/:id/profile", csvHandler.JobProfile)
+		read.GET("/jobs/:id/report.html", csvHandler.JobReport)
+		read.GET("/batches/:id", csvHandler.BatchStatus)
+		read.GET("/batches/:id/download", csvHandler.DownloadBatch)
+		read.GET("/usage", csvHandler.Usage)
+	}
+	admin := api.Group("", authHandler.RequireScope(models.ScopeAdmin))
+	{
+		admin.GET("/cache/stats", csvHandler.CacheStats)
+	}
+	keys := admin.Group("/keys", authHandler.RequireAuthentication)
+	{
+		keys.POST("", keyHandler.CreateKey)
+		keys.GET("", keyHandler.ListKeys)
+		keys.DELETE("/:id", keyHandler.DeleteKey)
 	}
 
 	log.Println("Starting Go backend server on :", port)
@@ -51,3 +112,84 @@ func main() {
 	}
 
 }
+
+// startHotFolderWatcher processes CSV files dropped into inbox in the background.
+func startHotFolderWatcher(csvService *services.CsvProcessingService, inbox string) {
+	outbox := os.Getenv("HOT_FOLDER_OUTBOX")
+	if outbox == "" {
+		outbox = filepath.Join(filepath.Dir(filepath.Clean(inbox)), "outbox")
+	}
+
+	watcher, err := services.DSHotFolderWatcher(csvService, inbox, outbox)
+	if err != nil {
+		log.Fatal("Failed to start hot folder watcher:", err)
+	}
+	if value := os.Getenv("HOT_FOLDER_POLL_INTERVAL"); value != "" {
+		if watcher.PollInterval, err = time.ParseDuration(value); err != nil || watcher.PollInterval <= 0 {
+			log.Fatal("Error loading HOT_FOLDER_POLL_INTERVAL .env variable")
+		}
+	}
+	if value := os.Getenv("HOT_FOLDER_STABLE_FOR"); value != "" {
+		if watcher.StableFor, err = time.ParseDuration(value); err != nil {
+			log.Fatal("Error loading HOT_FOLDER_STABLE_FOR .env variable")
+		}
+	}
+
+	go watcher.Run(context.Background())
+}
+
+// runKeysCommand manages API keys from the command line:
+//
+//	keys create -name NAME -scopes upload,read [-tenant TENANT]
+//	keys list
+//	keys delete ID
+func runKeysCommand(args []string) {
+	keyService, err := services.DSAPIKeyService("")
+	if err != nil {
+		log.Fatal("Failed to load API keys:", err)
+	}
+
+	if len(args) == 0 {
+		log.Fatal("Usage: keys create|list|delete")
+	}
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("keys create", flag.ExitOnError)
+		name := flags.String("name", "", "name of the key")
+		scopes := flags.String("scopes", "", "comma separated scopes: upload, read, admin, operator")
+		tenant := flags.String("tenant", "", "tenant of the key; empty for the default tenant")
+		flags.Parse(args[1:])
+
+		created, err := keyService.Create(*name, []string{*scopes}, *tenant)
+		if err != nil {
+			log.Fatal("Failed to create API key:", err)
+		}
+		fmt.Printf("Created key %s (%s) with scopes %v\n", created.ID, created.Name, created.Scopes)
+		if created.Tenant != "" {
+			fmt.Printf("Tenant: %s\n", created.Tenant)
+		}
+		fmt.Printf("Key: %s\n", created.Key)
+		fmt.Println("Store it now; it cannot be shown again.")
+
+	case "list":
+		for _, key := range keyService.List() {
+			tenant := key.Tenant
+			if tenant == "" {
+				tenant = "-"
+			}
+			fmt.Printf("%s\t%s\t%s...\t%v\t%s\t%s\n", key.ID, key.Name, key.Prefix, key.Scopes, tenant, key.CreatedAt.Format(time.RFC3339))
+		}
+
+	case "delete":
+		if len(args) != 2 {
+			log.Fatal("Usage: keys delete ID")
+		}
+		if err := keyService.Delete(args[1]); err != nil {
+			log.Fatal("Failed to delete API key:", err)
+		}
+		fmt.Printf("Deleted key %s\n", args[1])
+
+	default:
+		log.Fatal("Usage: keys create|list|delete")
+	}
+}
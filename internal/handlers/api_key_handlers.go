@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	keyService *services.APIKeyService
+}
+
+func DSAPIKeyHandler(keyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		keyService: keyService,
+	}
+}
+
+// CreateKey creates an API key and returns it in full, the only time it is
+// shown. The key belongs to the tenant of the caller unless an operator names
+// another one, and only operators may create operator keys.
+func (handler *APIKeyHandler) CreateKey(ctx *gin.Context) {
+	var request models.CreateAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "A JSON body must include name and scopes",
+		})
+		return
+	}
+	if request.Tenant == "" {
+		request.Tenant = principalTenant(ctx)
+	}
+	if !managesTenant(ctx, request.Tenant) {
+		log.Printf("[API_KEYS] [ERROR] Key for another tenant refused - Tenant: %s, IP: %s", request.Tenant, ctx.ClientIP())
+		ctx.JSON(http.StatusForbidden, models.UploadResponse{
+			Error: "Keys can only be created for your own tenant",
+		})
+		return
+	}
+	if principal := currentPrincipal(ctx); principal != nil && !principal.HasScope(models.ScopeOperator) && requestsOperator(request.Scopes) {
+		log.Printf("[API_KEYS] [ERROR] Operator key refused - Principal: %s, IP: %s", principal.ID, ctx.ClientIP())
+		ctx.JSON(http.StatusForbidden, models.UploadResponse{
+			Error: "Only operators can create operator keys",
+		})
+		return
+	}
+
+	created, err := handler.keyService.Create(request.Name, request.Scopes, request.Tenant)
+	if err != nil {
+		log.Printf("[API_KEYS] [ERROR] Key creation failed - Name: %s, Error: %v", request.Name, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("[API_KEYS] [SUCCESS] Key created - ID: %s, Name: %s, IP: %s", created.ID, created.Name, ctx.ClientIP())
+	ctx.JSON(http.StatusCreated, created)
+}
+
+// ListKeys returns the API keys the caller manages, without their secrets.
+func (handler *APIKeyHandler) ListKeys(ctx *gin.Context) {
+	keys := make([]models.APIKey, 0)
+	for _, key := range handler.keyService.List() {
+		if managesTenant(ctx, key.Tenant) {
+			keys = append(keys, key)
+		}
+	}
+	ctx.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// DeleteKey revokes an API key. Keys of tenants the caller does not manage
+// are reported as not found.
+func (handler *APIKeyHandler) DeleteKey(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	err := services.ErrAPIKeyNotFound
+	for _, key := range handler.keyService.List() {
+		if key.ID == id && managesTenant(ctx, key.Tenant) {
+			err = handler.keyService.Delete(id)
+			break
+		}
+	}
+	if err != nil {
+		log.Printf("[API_KEYS] [ERROR] Key deletion failed - ID: %s, Error: %v", id, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			status = http.StatusNotFound
+		}
+		ctx.JSON(status, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("[API_KEYS] [SUCCESS] Key deleted - ID: %s, IP: %s", id, ctx.ClientIP())
+	ctx.Status(http.StatusNoContent)
+}
+
+// requestsOperator reports whether the scopes of a key request, which may be
+// comma separated, include the operator scope.
+func requestsOperator(scopes []string) bool {
+	for _, value := range scopes {
+		for _, scope := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(scope), models.ScopeOperator) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// managesTenant reports whether the caller may manage the keys of tenant:
+// operators manage every tenant, admins their own.
+func managesTenant(ctx *gin.Context, tenant string) bool {
+	principal := currentPrincipal(ctx)
+	return principal != nil && (principal.HasScope(models.ScopeOperator) || principal.Tenant == tenant)
+}
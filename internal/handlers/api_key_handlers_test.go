@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"bytes"
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupAuthRouter builds a router with API key authentication turned on and
+// the route groups of cmd/main.go.
+func setupAuthRouter(t *testing.T) (*gin.Engine, *services.APIKeyService, string) {
+	t.Helper()
+	return setupAuthRouterWithTokens(t, nil)
+}
+
+// setupAuthRouterWithTokens also accepts bearer tokens checked by tokens.
+func setupAuthRouterWithTokens(t *testing.T, tokens *services.TokenVerifier) (*gin.Engine, *services.APIKeyService, string) {
+	t.Helper()
+	enabled := services.APIAuthEnabled
+	services.APIAuthEnabled = true
+	t.Cleanup(func() { services.APIAuthEnabled = enabled })
+
+	keysPath := filepath.Join(t.TempDir(), "api_keys.json")
+	keyService, err := services.DSAPIKeyService(keysPath)
+	if err != nil {
+		t.Fatalf("Failed to create key service: %v", err)
+	}
+	_, handler := setupTestRouter()
+	keyHandler := DSAPIKeyHandler(keyService)
+	authHandler := DSAuthHandler(keyService, tokens)
+
+	router := gin.New()
+	api := router.Group("/API", authHandler.Authenticate)
+	upload := api.Group("", authHandler.RequireScope(models.ScopeUpload))
+	upload.POST("/upload", handler.UploadFile)
+	upload.POST("/uploads", handler.UploadFiles)
+	read := api.Group("", authHandler.RequireScope(models.ScopeRead))
+	read.GET("/download/:id", handler.DownloadFile)
+	read.GET("/jobs", handler.ListJobs)
+	read.GET("/jobs/:id", handler.GetJob)
+	read.GET("/jobs/:id/output", handler.DownloadJobOutput)
+	read.GET("/batches/:id", handler.BatchStatus)
+	read.GET("/usage", handler.Usage)
+	admin := api.Group("", authHandler.RequireScope(models.ScopeAdmin))
+	keys := admin.Group("/keys", authHandler.RequireAuthentication)
+	keys.POST("", keyHandler.CreateKey)
+	keys.GET("", keyHandler.ListKeys)
+	keys.DELETE("/:id", keyHandler.DeleteKey)
+	return router, keyService, keysPath
+}
+
+func createTestKey(t *testing.T, keyService *services.APIKeyService, name string, scopes ...string) *models.CreateAPIKeyResponse {
+	t.Helper()
+	created, err := keyService.Create(name, scopes, "")
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	return created
+}
+
+func authRequest(router *gin.Engine, method, path, key string, body []byte, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func uploadWithKey(router *gin.Engine, key, filename, content string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	writer.Close()
+	return authRequest(router, "POST", "/API/upload", key, buf.Bytes(), writer.FormDataContentType())
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	router, keyService, _ := setupAuthRouter(t)
+	reader := createTestKey(t, keyService, "dashboard", "read")
+
+	if w := authRequest(router, "GET", "/API/jobs", "", nil, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without a key, got %d", w.Code)
+	}
+	if w := authRequest(router, "GET", "/API/jobs", "dsk_unknown", nil, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for an unknown key, got %d", w.Code)
+	}
+	if w := authRequest(router, "GET", "/API/jobs", reader.Key, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with a read key, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Scopes are enforced per route
+	if w := uploadWithKey(router, reader.Key, "contacts.csv", "name,email\n"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an upload with a read key, got %d", w.Code)
+	}
+	if w := authRequest(router, "GET", "/API/keys", reader.Key, nil, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for key management with a read key, got %d", w.Code)
+	}
+}
+
+func TestAPIKeyManagement(t *testing.T) {
+	router, keyService, keysPath := setupAuthRouter(t)
+	admin := createTestKey(t, keyService, "ops", "admin")
+
+	body := []byte(`{"name": "ci", "scopes": ["upload", "read"]}`)
+	w := authRequest(router, "POST", "/API/keys", admin.Key, body, "application/json")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.CreateAPIKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if !strings.HasPrefix(created.Key, "dsk_") || created.Hash != "" {
+		t.Errorf("Expected the full key without its hash, got %+v", created)
+	}
+
+	if w := uploadWithKey(router, created.Key, "contacts.csv", "name,email\n"); w.Code != http.StatusOK {
+		t.Errorf("Expected the new key to upload, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = authRequest(router, "GET", "/API/keys", admin.Key, nil, "")
+	if strings.Contains(w.Body.String(), created.Key) || strings.Contains(w.Body.String(), `"hash"`) {
+		t.Errorf("Expected listings to hide keys and hashes, got %s", w.Body.String())
+	}
+
+	// Keys are hashed at rest and survive a restart
+	stored, _ := os.ReadFile(keysPath)
+	if strings.Contains(string(stored), created.Key) {
+		t.Errorf("Expected the keys file to hold hashes only")
+	}
+	reloaded, err := services.DSAPIKeyService(keysPath)
+	if err != nil || reloaded.Authenticate(created.Key) == nil {
+		t.Errorf("Expected the key to be loaded from the keys file, got error %v", err)
+	}
+
+	invalid := []byte(`{"name": "bad", "scopes": ["everything"]}`)
+	if w := authRequest(router, "POST", "/API/keys", admin.Key, invalid, "application/json"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown scope, got %d", w.Code)
+	}
+
+	if w := authRequest(router, "DELETE", "/API/keys/"+created.ID, admin.Key, nil, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := uploadWithKey(router, created.Key, "contacts.csv", "name,email\n"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a deleted key to be rejected, got %d", w.Code)
+	}
+	if w := authRequest(router, "DELETE", "/API/keys/"+created.ID, admin.Key, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a deleted key, got %d", w.Code)
+	}
+}
+
+func TestKeyManagementNeedsAuthentication(t *testing.T) {
+	router, keyService, keysPath := setupAuthRouter(t)
+	services.APIAuthEnabled = false
+
+	body := []byte(`{"name": "root", "scopes": ["admin"]}`)
+	if w := authRequest(router, "POST", "/API/keys", "", body, "application/json"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 creating a key while authentication is off, got %d", w.Code)
+	}
+	if w := authRequest(router, "GET", "/API/keys", "", nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 listing keys while authentication is off, got %d", w.Code)
+	}
+	if len(keyService.List()) != 0 {
+		t.Errorf("Expected no key to be created")
+	}
+	if _, err := os.Stat(keysPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no keys file, got %v", err)
+	}
+}
+
+func TestJobsBelongToTheirKey(t *testing.T) {
+	router, keyService, _ := setupAuthRouter(t)
+	owner := createTestKey(t, keyService, "owner", "upload", "read")
+	other := createTestKey(t, keyService, "other", "upload", "read")
+	admin := createTestKey(t, keyService, "ops", "admin")
+
+	w := uploadWithKey(router, owner.Key, "contacts.csv", "name,email\nJohn Smith,john@example.com\n")
+	var response models.UploadResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	var details models.JobDetails
+	for attempt := 0; attempt < 50; attempt++ {
+		w = authRequest(router, "GET", "/API/jobs/"+response.ID, owner.Key, nil, "")
+		json.Unmarshal(w.Body.Bytes(), &details)
+		if details.Status != models.JobStatusInProgress {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if details.CreatedBy != owner.ID {
+		t.Errorf("Expected the job to record key %s, got %q", owner.ID, details.CreatedBy)
+	}
+
+	for _, path := range []string{"/API/download/", "/API/jobs/"} {
+		if w := authRequest(router, "GET", path+response.ID, other.Key, nil, ""); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for another key on %s, got %d", path, w.Code)
+		}
+	}
+	if w := authRequest(router, "GET", "/API/jobs/"+response.ID+"/output", owner.Key, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the owner to download the output, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := authRequest(router, "GET", "/API/jobs/"+response.ID+"/output", admin.Key, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected an admin key to download the output, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var listing models.JobListResponse
+	w = authRequest(router, "GET", "/API/jobs", other.Key, nil, "")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Jobs) != 0 {
+		t.Errorf("Expected another key to list no jobs, got %d", len(listing.Jobs))
+	}
+	w = authRequest(router, "GET", "/API/jobs", admin.Key, nil, "")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Jobs) != 1 {
+		t.Errorf("Expected an admin key to list every job, got %d", len(listing.Jobs))
+	}
+}
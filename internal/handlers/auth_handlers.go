@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalContextKey holds the authenticated *models.Principal in the gin context.
+const principalContextKey = "principal"
+
+type AuthHandler struct {
+	keyService *services.APIKeyService
+	tokens     *services.TokenVerifier
+}
+
+// DSAuthHandler accepts API keys from keyService and, when tokens is not nil,
+// JWT bearer tokens it verifies.
+func DSAuthHandler(keyService *services.APIKeyService, tokens *services.TokenVerifier) *AuthHandler {
+	return &AuthHandler{
+		keyService: keyService,
+		tokens:     tokens,
+	}
+}
+
+// Authenticate is middleware that identifies the caller from the X-API-Key
+// header or an Authorization: Bearer token. Without API_AUTH_ENABLED every
+// request passes unchecked.
+func (handler *AuthHandler) Authenticate(ctx *gin.Context) {
+	if !services.APIAuthEnabled {
+		ctx.Next()
+		return
+	}
+
+	if raw := ctx.GetHeader("X-API-Key"); raw != "" {
+		key := handler.keyService.Authenticate(raw)
+		if key == nil {
+			log.Printf("[AUTH] [ERROR] Invalid API key - Path: %s, IP: %s", ctx.FullPath(), ctx.ClientIP())
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.UploadResponse{
+				Error: "Invalid API key",
+			})
+			return
+		}
+		ctx.Set(principalContextKey, key.Principal())
+		ctx.Next()
+		return
+	}
+
+	token, isBearer := bearerToken(ctx.GetHeader("Authorization"))
+	if !isBearer || handler.tokens == nil {
+		log.Printf("[AUTH] [ERROR] Missing credentials - Path: %s, IP: %s", ctx.FullPath(), ctx.ClientIP())
+		message := "Missing API key"
+		if handler.tokens != nil {
+			message = "Missing API key or bearer token"
+		}
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.UploadResponse{
+			Error: message,
+		})
+		return
+	}
+
+	principal, err := handler.tokens.Verify(token)
+	if err != nil {
+		log.Printf("[AUTH] [ERROR] Bearer token rejected - Path: %s, IP: %s, Error: %v", ctx.FullPath(), ctx.ClientIP(), err)
+		ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, models.UploadResponse{
+			Error: "Invalid bearer token",
+		})
+		return
+	}
+
+	ctx.Set(principalContextKey, principal)
+	ctx.Next()
+}
+
+// RequireScope returns middleware that rejects callers without scope.
+func (handler *AuthHandler) RequireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal := currentPrincipal(ctx)
+		if principal != nil && !principal.HasScope(scope) {
+			log.Printf("[AUTH] [ERROR] Missing scope - Principal: %s, Scope: %s, Path: %s", principal.ID, scope, ctx.FullPath())
+			ctx.AbortWithStatusJSON(http.StatusForbidden, models.UploadResponse{
+				Error: "Credentials lack the " + scope + " scope",
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireAuthentication answers 404 while authentication is off, for routes
+// such as key management that must not be open to anonymous callers.
+func (handler *AuthHandler) RequireAuthentication(ctx *gin.Context) {
+	if currentPrincipal(ctx) == nil {
+		log.Printf("[AUTH] [ERROR] Route needs authentication - Path: %s, IP: %s", ctx.FullPath(), ctx.ClientIP())
+		ctx.AbortWithStatusJSON(http.StatusNotFound, models.UploadResponse{
+			Error: "Not available while API_AUTH_ENABLED is off",
+		})
+		return
+	}
+	ctx.Next()
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer" header.
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// currentPrincipal is the caller that authenticated the request, or nil when
+// authentication is off.
+func currentPrincipal(ctx *gin.Context) *models.Principal {
+	if value, ok := ctx.Get(principalContextKey); ok {
+		return value.(*models.Principal)
+	}
+	return nil
+}
+
+// principalID is the ID recorded on the jobs a request creates.
+func principalID(ctx *gin.Context) string {
+	if principal := currentPrincipal(ctx); principal != nil {
+		return principal.ID
+	}
+	return ""
+}
+
+// principalTenant is the tenant recorded on the jobs a request creates.
+func principalTenant(ctx *gin.Context) string {
+	if principal := currentPrincipal(ctx); principal != nil {
+		return principal.Tenant
+	}
+	return ""
+}
+
+// inTenant reports whether a job or batch of tenant is visible to the request.
+// Without authentication there is a single tenant.
+func inTenant(ctx *gin.Context, tenant string) bool {
+	principal := currentPrincipal(ctx)
+	return principal == nil || principal.Tenant == tenant
+}
+
+// authorizeOwner reports whether the request may access a job or batch of
+// tenant created by createdBy: the same caller or an admin of the tenant.
+// Resources of another tenant answer 404 with "<resource> not found", so
+// their IDs cannot be probed; those of another caller answer 403.
+func authorizeOwner(ctx *gin.Context, resource, tenant, createdBy string) bool {
+	principal := currentPrincipal(ctx)
+	if principal == nil {
+		return true
+	}
+	if principal.Tenant != tenant {
+		log.Printf("[AUTH] [ERROR] Resource of another tenant - Principal: %s, Tenant: %s, Path: %s", principal.ID, principal.Tenant, ctx.FullPath())
+		ctx.JSON(http.StatusNotFound, models.UploadResponse{
+			Error: resource + " not found",
+		})
+		return false
+	}
+	if principal.HasScope(models.ScopeAdmin) || principal.ID == createdBy {
+		return true
+	}
+
+	log.Printf("[AUTH] [ERROR] Access denied - Principal: %s, CreatedBy: %s, Path: %s", principal.ID, createdBy, ctx.FullPath())
+	ctx.JSON(http.StatusForbidden, models.UploadResponse{
+		Error: "This resource belongs to another caller",
+	})
+	return false
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com/"
+	testAudience = "demandscience-api"
+)
+
+// testSigner signs RS256 tokens with a key published in a JWKS.
+type testSigner struct {
+	key *rsa.PrivateKey
+	kid string
+}
+
+func newTestSigner(t *testing.T, kid string) *testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	return &testSigner{key: key, kid: kid}
+}
+
+func (signer *testSigner) jwks() []byte {
+	encode := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": signer.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   encode(signer.key.N.Bytes()),
+			"e":   encode(big.NewInt(int64(signer.key.E)).Bytes()),
+		}},
+	})
+	return jwks
+}
+
+func (signer *testSigner) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	encode := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": signer.kid})
+	payload, _ := json.Marshal(claims)
+	signingInput := encode(header) + "." + encode(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, signer.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signingInput + "." + encode(signature)
+}
+
+func testClaims(subject string, roles ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":    testIssuer,
+		"aud":    []string{"other-api", testAudience},
+		"sub":    subject,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"tenant": "acme",
+		"roles":  roles,
+	}
+}
+
+// setupTokenRouter builds an authenticated router that trusts signer through
+// a JWKS file.
+func setupTokenRouter(t *testing.T, signer *testSigner) (*gin.Engine, *services.APIKeyService) {
+	t.Helper()
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksPath, signer.jwks(), 0644); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+	tokens, err := services.DSTokenVerifier(services.TokenVerifierConfig{
+		JWKSFile: jwksPath,
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create token verifier: %v", err)
+	}
+	router, keyService, _ := setupAuthRouterWithTokens(t, tokens)
+	return router, keyService
+}
+
+func bearerRequest(router *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestBearerTokenAuthentication(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	router, keyService := setupTokenRouter(t, signer)
+
+	token := signer.sign(t, testClaims("user-42", "upload", "read"))
+	w := uploadWithToken(router, token, "contacts.csv", "name,email\nAda,ada@example.com\n")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for an upload with a bearer token, got %d: %s", w.Code, w.Body.String())
+	}
+	var uploaded models.UploadResponse
+	json.Unmarshal(w.Body.Bytes(), &uploaded)
+
+	w = bearerRequest(router, "GET", "/API/jobs/"+uploaded.ID, token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the job, got %d: %s", w.Code, w.Body.String())
+	}
+	var details models.JobDetails
+	json.Unmarshal(w.Body.Bytes(), &details)
+	if details.CreatedBy != "jwt:user-42" || details.Tenant != "acme" {
+		t.Errorf("Expected the job to record jwt:user-42 of tenant acme, got %q of %q", details.CreatedBy, details.Tenant)
+	}
+
+	// Another subject cannot read the job
+	other := signer.sign(t, testClaims("user-7", "read"))
+	if w := bearerRequest(router, "GET", "/API/jobs/"+uploaded.ID, other); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for another subject, got %d", w.Code)
+	}
+
+	// Roles map to scopes
+	if w := uploadWithToken(router, other, "contacts.csv", "name,email\n"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an upload with the read role only, got %d", w.Code)
+	}
+
+	// API keys keep working next to bearer tokens
+	reader := createTestKey(t, keyService, "dashboard", "read")
+	if w := authRequest(router, "GET", "/API/jobs", reader.Key, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with an API key, got %d", w.Code)
+	}
+}
+
+func TestBearerTokenRejected(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	router, _ := setupTokenRouter(t, signer)
+
+	expired := testClaims("user-42", "read")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongIssuer := testClaims("user-42", "read")
+	wrongIssuer["iss"] = "https://attacker.example.com/"
+	wrongAudience := testClaims("user-42", "read")
+	wrongAudience["aud"] = "other-api"
+	noExpiry := testClaims("user-42", "read")
+	delete(noExpiry, "exp")
+	notYetValid := testClaims("user-42", "read")
+	notYetValid["nbf"] = time.Now().Add(time.Hour).Unix()
+
+	valid := signer.sign(t, testClaims("user-42", "read"))
+	stranger := newTestSigner(t, "key-1")
+
+	tokens := map[string]string{
+		"expired":        signer.sign(t, expired),
+		"wrong issuer":   signer.sign(t, wrongIssuer),
+		"wrong audience": signer.sign(t, wrongAudience),
+		"no expiry":      signer.sign(t, noExpiry),
+		"not yet valid":  signer.sign(t, notYetValid),
+		"unknown signer": stranger.sign(t, testClaims("user-42", "read")),
+		"tampered":       valid[:len(valid)-4] + "AAAA",
+		"unsigned":       base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-42"}`)) + ".",
+		"malformed":      "not-a-token",
+	}
+	for name, token := range tokens {
+		w := bearerRequest(router, "GET", "/API/jobs", token)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for a token that is %s, got %d", name, w.Code)
+		}
+	}
+
+	if w := bearerRequest(router, "GET", "/API/jobs", valid); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for a valid token, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBearerTokenJWKSURL(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(signer.jwks())
+	}))
+	defer jwksServer.Close()
+
+	tokens, err := services.DSTokenVerifier(services.TokenVerifierConfig{
+		JWKSURL:  jwksServer.URL,
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create token verifier: %v", err)
+	}
+	router, _, _ := setupAuthRouterWithTokens(t, tokens)
+
+	claims := testClaims("user-42")
+	claims["roles"] = "read upload"
+	if w := bearerRequest(router, "GET", "/API/jobs", signer.sign(t, claims)); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with a key from the JWKS URL, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBearerTokenJWKSURLUnreachableAtStartup(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	var fetches atomic.Int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(signer.jwks())
+	}))
+	defer jwksServer.Close()
+
+	tokens, err := services.DSTokenVerifier(services.TokenVerifierConfig{
+		JWKSURL:  jwksServer.URL,
+		Issuer:   testIssuer,
+		Audience: testAudience,
+	})
+	if err != nil {
+		t.Fatalf("Expected the verifier to start without its JWKS, got %v", err)
+	}
+	router, _, _ := setupAuthRouterWithTokens(t, tokens)
+	token := signer.sign(t, testClaims("user-42", "read"))
+
+	// Failed loads are retried at most once a second
+	if w := bearerRequest(router, "GET", "/API/jobs", token); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 before the JWKS loads, got %d", w.Code)
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	// Concurrent tokens wait for one load instead of fetching once each
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = bearerRequest(router, "GET", "/API/jobs", token).Code
+		}(i)
+	}
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Expected status 200 for request %d once the JWKS loads, got %d", i, code)
+		}
+	}
+	if count := fetches.Load(); count != 2 {
+		t.Errorf("Expected 2 JWKS fetches, got %d", count)
+	}
+}
+
+func uploadWithToken(router *gin.Engine, token, filename, content string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"demandscience/internal/models"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (handler *CsvProcessorHandler) UploadFiles(ctx *gin.Context) {
+	startTime := time.Now()
+	clientIP := ctx.ClientIP()
+
+	log.Printf("[BATCH_UPLOAD] Starting batch upload request from IP: %s", clientIP)
+
+	form, err := ctx.MultipartForm()
+	if err != nil {
+		log.Printf("[BATCH_UPLOAD] [ERROR] Invalid multipart form from IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "No files provided",
+		})
+		return
+	}
+
+	fileHeaders := append(form.File["files[]"], form.File["files"]...)
+	if len(fileHeaders) == 0 {
+		log.Printf("[BATCH_UPLOAD] [ERROR] No files provided in request from IP: %s", clientIP)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "No files provided",
+		})
+		return
+	}
+
+	var options models.ProcessingOptions
+	if err := ctx.ShouldBind(&options); err != nil {
+		log.Printf("[BATCH_UPLOAD] [ERROR] Invalid processing options from IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid processing options",
+		})
+		return
+	}
+	options.CreatedBy = principalID(ctx)
+	options.Tenant = principalTenant(ctx)
+
+	batch, err := handler.csvService.ProcessBatch(fileHeaders, options)
+	if err != nil {
+		log.Printf("[BATCH_UPLOAD] [ERROR] Batch processing initiation failed - Files: %d, IP: %s, Error: %v",
+			len(fileHeaders), clientIP, err)
+		if respondQuotaError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	duration := time.Since(startTime)
+	log.Printf("[BATCH_UPLOAD] [SUCCESS] Batch upload successful - BatchID: %s, Files: %d, Jobs: %d, Duration: %v, IP: %s",
+		batch.ID, len(fileHeaders), len(batch.JobIDs), duration, clientIP)
+
+	ctx.JSON(http.StatusOK, models.UploadResponse{
+		BatchID: batch.ID,
+		IDs:     batch.JobIDs,
+	})
+}
+
+func (handler *CsvProcessorHandler) BatchStatus(ctx *gin.Context) {
+	clientIP := ctx.ClientIP()
+	batchID := ctx.Param("id")
+
+	log.Printf("[BATCH_STATUS] Starting batch status request - BatchID: %s, IP: %s", batchID, clientIP)
+
+	status := handler.csvService.GetBatchStatus(batchID)
+	if status == nil {
+		log.Printf("[BATCH_STATUS] [ERROR] Batch not found - BatchID: %s, IP: %s", batchID, clientIP)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid batch ID",
+		})
+		return
+	}
+	if !authorizeOwner(ctx, "Batch", status.Tenant, status.CreatedBy) {
+		return
+	}
+
+	log.Printf("[BATCH_STATUS] [SUCCESS] Batch status returned - BatchID: %s, Status: %s, Progress: %.1f%%",
+		batchID, status.Status, status.Progress)
+	ctx.JSON(http.StatusOK, status)
+}
+
+func (handler *CsvProcessorHandler) DownloadBatch(ctx *gin.Context) {
+	startTime := time.Now()
+	clientIP := ctx.ClientIP()
+	batchID := ctx.Param("id")
+
+	log.Printf("[BATCH_DOWNLOAD] Starting batch download request - BatchID: %s, IP: %s", batchID, clientIP)
+
+	status := handler.csvService.GetBatchStatus(batchID)
+	if status == nil {
+		log.Printf("[BATCH_DOWNLOAD] [ERROR] Batch not found - BatchID: %s, IP: %s", batchID, clientIP)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid batch ID",
+		})
+		return
+	}
+	if !authorizeOwner(ctx, "Batch", status.Tenant, status.CreatedBy) {
+		return
+	}
+
+	if status.Status == models.JobStatusInProgress {
+		log.Printf("[BATCH_DOWNLOAD] [STATUS] Batch in progress - BatchID: %s, Progress: %.1f%%", batchID, status.Progress)
+		ctx.JSON(http.StatusLocked, models.UploadResponse{
+			Error: "Batch is still in progress",
+		})
+		return
+	}
+
+	archive, err := handler.csvService.GetBatchArchive(batchID)
+	if err != nil {
+		log.Printf("[BATCH_DOWNLOAD] [ERROR] Failed to build batch archive - BatchID: %s, Error: %v", batchID, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("[BATCH_DOWNLOAD] [SUCCESS] Batch archive returned - BatchID: %s, Size: %d bytes, Duration: %v",
+		batchID, len(archive), time.Since(startTime))
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":             batchID,
+		"status":         string(status.Status),
+		"message":        "Batch processed successfully",
+		"processed_name": batchID + "_processed.zip",
+		"file_data":      base64.StdEncoding.EncodeToString(archive),
+		"content_type":   "application/zip",
+		"size":           len(archive),
+		"completed":      status.Completed,
+		"failed":         status.Failed,
+		"created_at":     status.CreatedAt,
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchUpload(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("files[]", "first.csv")
+	part.Write([]byte("name,email\nJohn,john@test.com"))
+	part, _ = writer.CreateFormFile("files[]", "second.csv")
+	part.Write([]byte("name,email\nJane,invalid-email"))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/uploads", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var uploadResponse struct {
+		BatchID string   `json:"batchId"`
+		IDs     []string `json:"ids"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+
+	if uploadResponse.BatchID == "" || len(uploadResponse.IDs) != 2 {
+		t.Fatalf("Expected a batch ID and two job IDs, got: %s", w.Body.String())
+	}
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	req = httptest.NewRequest("GET", "/API/batches/"+uploadResponse.BatchID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var status map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &status)
+
+	if status["status"] != "COMPLETED" || status["progress"] != 100.0 || status["completed"] != 2.0 {
+		t.Errorf("Expected completed batch, got: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/API/batches/"+uploadResponse.BatchID+"/download", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for batch download, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var download map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &download)
+	archiveData, _ := base64.StdEncoding.DecodeString(download["file_data"].(string))
+
+	archive, err := zip.NewReader(bytes.NewReader(archiveData), int64(len(archiveData)))
+	if err != nil {
+		t.Fatalf("Batch download should be a zip archive: %v", err)
+	}
+
+	var names []string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+		reader, _ := file.Open()
+		content, _ := io.ReadAll(reader)
+		reader.Close()
+		if !strings.Contains(string(content), "has_email") {
+			t.Errorf("Archive entry %s should hold processed output, got: %s", file.Name, content)
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "first.csv_processed.csv,second.csv_processed.csv" {
+		t.Errorf("Unexpected archive entries: %v", names)
+	}
+}
+
+func TestBatchUploadRejectsInvalidFile(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("files[]", "good.csv")
+	part.Write([]byte("name,email\nJohn,john@test.com"))
+	part, _ = writer.CreateFormFile("files[]", "bad.pdf")
+	part.Write([]byte("not a csv"))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/uploads", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "bad.pdf") {
+		t.Errorf("Error should name the invalid file, got: %s", w.Body.String())
+	}
+}
+
+func TestInvalidBatchID(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	req := httptest.NewRequest("GET", "/API/batches/invalid-id", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
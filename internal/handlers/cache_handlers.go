@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheStats returns the hit and miss counts of the cache of identical uploads.
+func (handler *CsvProcessorHandler) CacheStats(ctx *gin.Context) {
+	stats := handler.csvService.GetCacheStats()
+
+	log.Printf("[CACHE_STATS] Cache stats returned - Hits: %d, Misses: %d, Entries: %d, IP: %s",
+		stats.Hits, stats.Misses, stats.Entries, ctx.ClientIP())
+	ctx.JSON(http.StatusOK, stats)
+}
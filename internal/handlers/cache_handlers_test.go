@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"demandscience/internal/models"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getCacheStats(t *testing.T, router *gin.Engine) models.CacheStats {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/API/cache/stats", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var stats models.CacheStats
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	return stats
+}
+
+func getJobOutput(t *testing.T, router *gin.Engine, jobID string) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/API/jobs/"+jobID+"/output", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the output of %s, got %d: %s", jobID, w.Code, w.Body.String())
+	}
+	return w.Body.String()
+}
+
+func TestDedupeCache(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\nJohn Smith,john@example.com\nJane Doe,jane@example.com\n"
+	firstID := uploadTestFile(t, router, "contacts.csv", csvContent, nil)
+	first := waitForJob(t, router, firstID)
+	if first.Status != models.JobStatusCompleted || first.InputDigest == "" || first.CachedFrom != "" {
+		t.Fatalf("Expected a processed job with a digest, got %+v", first)
+	}
+
+	// Same content under another name and with other tags reuses the output
+	secondID := uploadTestFile(t, router, "copy.csv", csvContent, map[string]string{"tags": "again"})
+	if secondID == firstID {
+		t.Fatalf("Expected a new job ID")
+	}
+	second := waitForJob(t, router, secondID)
+	if second.Status != models.JobStatusCompleted || second.CachedFrom != firstID {
+		t.Errorf("Expected a completed job cached from %s, got %s from %q", firstID, second.Status, second.CachedFrom)
+	}
+	if second.Links["cachedFrom"] != "/API/jobs/"+firstID || second.InputDigest != first.InputDigest {
+		t.Errorf("Expected the cachedFrom link and the same digest, got %+v", second)
+	}
+	if getJobOutput(t, router, secondID) != getJobOutput(t, router, firstID) {
+		t.Errorf("Expected the cached output to match the original")
+	}
+
+	// The caller may ask for the job that produced the output instead
+	existingID := uploadTestFile(t, router, "contacts.csv", csvContent, map[string]string{"dedupe": "existing"})
+	if existingID != firstID {
+		t.Errorf("Expected the existing job ID %s, got %s", firstID, existingID)
+	}
+
+	stats := getCacheStats(t, router)
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("Expected 2 hits, 1 miss and 1 entry, got %+v", stats)
+	}
+
+	// Other options or dedupe turned off process the upload again
+	ndjsonID := uploadTestFile(t, router, "contacts.csv", csvContent, map[string]string{"output_format": "ndjson"})
+	if ndjson := waitForJob(t, router, ndjsonID); ndjson.CachedFrom != "" {
+		t.Errorf("Expected different options to miss the cache, got cached from %s", ndjson.CachedFrom)
+	}
+	offID := uploadTestFile(t, router, "contacts.csv", csvContent, map[string]string{"dedupe": "off"})
+	if off := waitForJob(t, router, offID); off.CachedFrom != "" {
+		t.Errorf("Expected dedupe off to skip the cache, got cached from %s", off.CachedFrom)
+	}
+
+	stats = getCacheStats(t, router)
+	if stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("Expected 2 hits, 2 misses and 2 entries, got %+v", stats)
+	}
+}
+
+func TestDedupeCacheDoesNotRetainAgain(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\nGrace Hopper,grace@example.com\n"
+	firstID := uploadTestFile(t, router, "hopper.csv", csvContent, nil)
+	first := waitForJob(t, router, firstID)
+	stored := waitForUsage(t, router).BytesStored
+
+	secondID := uploadTestFile(t, router, "hopper.csv", csvContent, nil)
+	second := waitForJob(t, router, secondID)
+	if second.CachedFrom != firstID {
+		t.Fatalf("Expected a job cached from %s, got %q", firstID, second.CachedFrom)
+	}
+	if usage := waitForUsage(t, router); usage.BytesStored != stored {
+		t.Errorf("Expected a cache hit to store nothing, got %d bytes stored after %d", usage.BytesStored, stored)
+	}
+	if first.Input == nil || second.Input == nil || *second.Input != *first.Input {
+		t.Errorf("Expected the cached job to share the retained upload, got %+v and %+v", first.Input, second.Input)
+	}
+}
+
+func TestDedupeCacheSkipsFailedJobs(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\nJohn Smith,john@example.com,extra\n"
+	firstID := uploadTestFile(t, router, "broken.csv", csvContent, nil)
+	if first := waitForJob(t, router, firstID); first.Status != models.JobStatusFailed {
+		t.Fatalf("Expected the first job to fail, got %s", first.Status)
+	}
+
+	secondID := uploadTestFile(t, router, "broken.csv", csvContent, nil)
+	second := waitForJob(t, router, secondID)
+	if second.Status != models.JobStatusFailed || second.CachedFrom != "" {
+		t.Errorf("Expected failed jobs not to be cached, got %s from %q", second.Status, second.CachedFrom)
+	}
+}
+
+func TestDedupeInvalidMode(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "contacts.csv")
+	part.Write([]byte("name,email\nJohn Smith,john@example.com\n"))
+	writer.WriteField("dedupe", "sometimes")
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown dedupe mode, got %d", w.Code)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"demandscience/internal/models"
 	"demandscience/internal/services"
 	"encoding/base64"
+	"errors"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"time"
 
@@ -28,6 +30,11 @@ func (handler *CsvProcessorHandler) UploadFile(ctx *gin.Context) {
 
 	log.Printf("[UPLOAD] Starting file upload request from IP: %s, User-Agent: %s", clientIP, userAgent)
 
+	if ctx.ContentType() == "application/json" {
+		handler.uploadSourceURL(ctx, startTime)
+		return
+	}
+
 	fileHeader, err := ctx.FormFile("file")
 	if err != nil {
 		log.Printf("[UPLOAD] [ERROR] No file provided in request from IP: %s, Error: %v", clientIP, err)
@@ -37,15 +44,41 @@ func (handler *CsvProcessorHandler) UploadFile(ctx *gin.Context) {
 		return
 	}
 
-	jobID, err := handler.csvService.ProcessFile(fileHeader)
+	var options models.ProcessingOptions
+	if err := ctx.ShouldBind(&options); err != nil {
+		log.Printf("[UPLOAD] [ERROR] Invalid processing options from IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid processing options",
+		})
+		return
+	}
+	options.CreatedBy = principalID(ctx)
+	options.Tenant = principalTenant(ctx)
+
+	if options.ZipMode == services.ZipModePerEntry {
+		handler.uploadArchiveEntries(ctx, fileHeader, options, startTime)
+		return
+	}
+
+	jobIDs, err := handler.idempotentUpload(ctx, fileHeader, "", options, func(options models.ProcessingOptions) ([]string, error) {
+		jobID, err := handler.csvService.ProcessFile(fileHeader, options)
+		if err != nil {
+			return nil, err
+		}
+		return []string{jobID}, nil
+	})
 	if err != nil {
 		log.Printf("[UPLOAD] [ERROR] File processing initiation failed - File: %s, IP: %s, Error: %v",
 			fileHeader.Filename, clientIP, err)
-		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+		if respondQuotaError(ctx, err) {
+			return
+		}
+		ctx.JSON(idempotentUploadStatus(err, http.StatusBadRequest), models.UploadResponse{
 			Error: err.Error(),
 		})
 		return
 	}
+	jobID := jobIDs[0]
 
 	duration := time.Since(startTime)
 	log.Printf("[UPLOAD] [SUCCESS] File upload successful - JobID: %s, File: %s, Size: %d bytes, Duration: %v, IP: %s",
@@ -56,6 +89,123 @@ func (handler *CsvProcessorHandler) UploadFile(ctx *gin.Context) {
 	})
 }
 
+// idempotentUpload runs start, or when the request carries an Idempotency-Key,
+// returns the job IDs of the first request with that key instead. start gets
+// options with the digest of the file the fingerprint already read.
+func (handler *CsvProcessorHandler) idempotentUpload(ctx *gin.Context, fileHeader *multipart.FileHeader,
+	sourceURL string, options models.ProcessingOptions, start func(models.ProcessingOptions) ([]string, error)) ([]string, error) {
+	key := ctx.GetHeader("Idempotency-Key")
+	if key == "" {
+		return start(options)
+	}
+
+	fingerprint, digest, err := services.UploadFingerprint(fileHeader, sourceURL, options)
+	if err != nil {
+		return nil, err
+	}
+	options.InputDigest = digest
+
+	jobIDs, replayed, err := handler.csvService.IdempotentUpload(options.Tenant+"/"+options.CreatedBy, key, fingerprint,
+		func() ([]string, error) { return start(options) })
+	if replayed {
+		log.Printf("[UPLOAD] Replaying idempotent upload - Key: %s, Jobs: %d, IP: %s", key, len(jobIDs), ctx.ClientIP())
+		ctx.Header("Idempotent-Replayed", "true")
+	}
+	return jobIDs, err
+}
+
+// idempotentUploadStatus is 409 for a reused Idempotency-Key and status otherwise.
+func idempotentUploadStatus(err error, status int) int {
+	if errors.Is(err, services.ErrIdempotencyKeyReused) {
+		return http.StatusConflict
+	}
+	return status
+}
+
+// uploadArchiveEntries starts one job per CSV inside a zip upload.
+func (handler *CsvProcessorHandler) uploadArchiveEntries(ctx *gin.Context, fileHeader *multipart.FileHeader,
+	options models.ProcessingOptions, startTime time.Time) {
+	clientIP := ctx.ClientIP()
+
+	jobIDs, err := handler.idempotentUpload(ctx, fileHeader, "", options, func(options models.ProcessingOptions) ([]string, error) {
+		return handler.csvService.ProcessArchiveEntries(fileHeader, options)
+	})
+	if err != nil {
+		log.Printf("[UPLOAD] [ERROR] Archive processing initiation failed - File: %s, IP: %s, Error: %v",
+			fileHeader.Filename, clientIP, err)
+		if respondQuotaError(ctx, err) {
+			return
+		}
+		ctx.JSON(idempotentUploadStatus(err, http.StatusBadRequest), models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	duration := time.Since(startTime)
+	log.Printf("[UPLOAD] [SUCCESS] Archive upload successful - Jobs: %d, File: %s, Size: %d bytes, Duration: %v, IP: %s",
+		len(jobIDs), fileHeader.Filename, fileHeader.Size, duration, clientIP)
+
+	ctx.JSON(http.StatusOK, models.UploadResponse{
+		ID:  jobIDs[0],
+		IDs: jobIDs,
+	})
+}
+
+// uploadSourceURL starts processing for a file fetched from the source_url of a JSON body.
+func (handler *CsvProcessorHandler) uploadSourceURL(ctx *gin.Context, startTime time.Time) {
+	clientIP := ctx.ClientIP()
+
+	var request models.SourceURLRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		log.Printf("[UPLOAD] [ERROR] Invalid source URL request from IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "A JSON body must include source_url",
+		})
+		return
+	}
+
+	options := request.Options()
+	options.CreatedBy = principalID(ctx)
+	options.Tenant = principalTenant(ctx)
+	jobIDs, err := handler.idempotentUpload(ctx, nil, request.SourceURL, options, func(options models.ProcessingOptions) ([]string, error) {
+		return handler.csvService.ProcessSourceURL(ctx.Request.Context(), request.SourceURL, options)
+	})
+	if err != nil {
+		log.Printf("[UPLOAD] [ERROR] Source URL processing initiation failed - URL: %s, IP: %s, Error: %v",
+			request.SourceURL, clientIP, err)
+		if respondQuotaError(ctx, err) {
+			return
+		}
+		status, code := http.StatusBadRequest, ""
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrSourceURLBlocked):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrSourceTooLarge):
+			status, code = http.StatusRequestEntityTooLarge, models.ErrorCodeFileTooLarge
+		case errors.Is(err, services.ErrSourceContentType):
+			status = http.StatusUnsupportedMediaType
+		}
+		ctx.JSON(status, models.UploadResponse{
+			Error: err.Error(),
+			Code:  code,
+		})
+		return
+	}
+
+	duration := time.Since(startTime)
+	log.Printf("[UPLOAD] [SUCCESS] Source URL upload successful - Jobs: %d, URL: %s, Duration: %v, IP: %s",
+		len(jobIDs), request.SourceURL, duration, clientIP)
+
+	response := models.UploadResponse{ID: jobIDs[0]}
+	if request.ZipMode == services.ZipModePerEntry {
+		response.IDs = jobIDs
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
 func (handler *CsvProcessorHandler) DownloadFile(ctx *gin.Context) {
 	startTime := time.Now()
 	clientIP := ctx.ClientIP()
@@ -73,6 +223,9 @@ func (handler *CsvProcessorHandler) DownloadFile(ctx *gin.Context) {
 		})
 		return
 	}
+	if !authorizeOwner(ctx, "Job", job.Tenant, job.CreatedBy) {
+		return
+	}
 
 	log.Printf("[DOWNLOAD] Job found - JobID: %s, Status: %s, OriginalFile: %s, CreatedAt: %v",
 		jobID, job.Status, job.OriginalFileName, job.CreatedAt)
@@ -93,8 +246,9 @@ func (handler *CsvProcessorHandler) DownloadFile(ctx *gin.Context) {
 		log.Printf("[DOWNLOAD] [ERROR] Job failed - JobID: %s, IP: %s, TotalTime: %v, Duration: %v",
 			jobID, clientIP, time.Since(job.CreatedAt), duration)
 
-		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
-			Error: "Job failed to process",
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Job failed to process",
+			"failure": handler.csvService.GetJobDetails(jobID).Failure,
 		})
 		return
 
@@ -118,10 +272,13 @@ func (handler *CsvProcessorHandler) DownloadFile(ctx *gin.Context) {
 			"status":         string(job.Status),
 			"message":        "File processed successfully",
 			"filename":       job.OriginalFileName,
-			"processed_name": job.OriginalFileName + "_processed.csv",
+			"processed_name": job.OriginalFileName + "_processed." + services.OutputExtension(job.Options.OutputFormat),
 			"file_data":      encoded,
-			"content_type":   "text/csv",
+			"content_type":   services.OutputContentType(job.Options.OutputFormat),
+			"output_format":  job.Options.OutputFormat,
 			"size":           len(fileContent),
+			"encoding":       job.DetectedEncoding,
+			"row_errors":     job.RowErrorCount,
 			"created_at":     job.CreatedAt,
 		})
 		return
@@ -144,3 +301,52 @@ func (handler *CsvProcessorHandler) DownloadFile(ctx *gin.Context) {
 		})
 	}
 }
+
+// DownloadRowErrors returns the malformed rows skipped by a tolerant job. It is
+// also available for jobs that failed because they ran out of error budget.
+func (handler *CsvProcessorHandler) DownloadRowErrors(ctx *gin.Context) {
+	clientIP := ctx.ClientIP()
+	jobID := ctx.Param("id")
+
+	log.Printf("[DOWNLOAD_ERRORS] Starting row errors request - JobID: %s, IP: %s", jobID, clientIP)
+
+	details := handler.csvService.GetJobDetails(jobID)
+	if details == nil {
+		log.Printf("[DOWNLOAD_ERRORS] [ERROR] Job not found - JobID: %s, IP: %s", jobID, clientIP)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid job ID",
+		})
+		return
+	}
+	if !authorizeOwner(ctx, "Job", details.Tenant, details.CreatedBy) {
+		return
+	}
+
+	if details.Status == models.JobStatusInProgress {
+		ctx.JSON(http.StatusLocked, models.UploadResponse{
+			Error: "Job is still in progress",
+		})
+		return
+	}
+
+	fileContent, err := handler.csvService.GetRowErrorsFile(jobID)
+	if err != nil {
+		log.Printf("[DOWNLOAD_ERRORS] [ERROR] No errors file - JobID: %s, Error: %v", jobID, err)
+		ctx.JSON(http.StatusNotFound, models.UploadResponse{
+			Error: "No malformed rows were recorded for this job",
+		})
+		return
+	}
+
+	log.Printf("[DOWNLOAD_ERRORS] [SUCCESS] Errors file returned - JobID: %s, Rows: %d", jobID, details.RowErrorCount)
+	ctx.JSON(http.StatusOK, gin.H{
+		"id":             jobID,
+		"status":         string(details.Status),
+		"filename":       details.OriginalFileName,
+		"processed_name": details.OriginalFileName + "_errors.csv",
+		"file_data":      base64.StdEncoding.EncodeToString(fileContent),
+		"content_type":   "text/csv",
+		"size":           len(fileContent),
+		"row_errors":     details.RowErrorCount,
+	})
+}
@@ -1,19 +1,27 @@
 package handlers
 
 import (
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"demandscience/internal/models"
 	"demandscience/internal/services"
 	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/parquet-go/parquet-go"
+	_ "modernc.org/sqlite"
 )
 
 func setupTestRouter() (*gin.Engine, *CsvProcessorHandler) {
@@ -24,6 +32,25 @@ func setupTestRouter() (*gin.Engine, *CsvProcessorHandler) {
 	router := gin.New()
 	router.POST("/API/upload", handler.UploadFile)
 	router.GET("/API/download/:id", handler.DownloadFile)
+	router.GET("/API/download/:id/errors", handler.DownloadRowErrors)
+	router.POST("/API/preview", handler.PreviewFile)
+	router.GET("/API/jobs", handler.ListJobs)
+	router.GET("/API/usage", handler.Usage)
+	router.GET("/API/jobs/:id", handler.GetJob)
+	router.GET("/API/jobs/:id/output", handler.DownloadJobOutput)
+	router.POST("/API/jobs/:id/cancel", handler.CancelJob)
+	router.POST("/API/jobs/:id/rerun", handler.RerunJob)
+	router.GET("/API/cache/stats", handler.CacheStats)
+	router.GET("/API/jobs/:id/profile", handler.JobProfile)
+	router.GET("/API/jobs/:id/report.html", handler.JobReport)
+	router.POST("/API/uploads", handler.UploadFiles)
+	router.GET("/API/batches/:id", handler.BatchStatus)
+	router.GET("/API/batches/:id/download", handler.DownloadBatch)
+	router.POST("/API/resumable", handler.CreateResumableUpload)
+	router.HEAD("/API/resumable/:id", handler.ResumableUploadOffset)
+	router.GET("/API/resumable/:id", handler.ResumableUploadStatus)
+	router.PATCH("/API/resumable/:id", handler.PatchResumableUpload)
+	router.DELETE("/API/resumable/:id", handler.DeleteResumableUpload)
 
 	return router, handler
 }
@@ -558,3 +585,750 @@ func TestLargeFileUpload(t *testing.T) {
 func containsIgnoreCase(str, substr string) bool {
 	return strings.Contains(strings.ToLower(str), strings.ToLower(substr))
 }
+
+func TestUTF16EncodedUpload(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	// Excel "Unicode Text" export: UTF-16LE with a BOM
+	csvContent := "name,email\nJosé,jose@test.com\nJane,invalid-email"
+	encoded := []byte{0xFF, 0xFE}
+	for _, r := range csvContent {
+		encoded = append(encoded, byte(r), byte(r>>8))
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "utf16.csv")
+	part.Write(encoded)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var uploadResponse map[string]string
+	json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+	jobID := uploadResponse["id"]
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	req = httptest.NewRequest("GET", "/API/download/"+jobID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	if response["encoding"] != "utf-16le" {
+		t.Errorf("Expected detected encoding utf-16le, got: %v", response["encoding"])
+	}
+
+	decodedData, _ := base64.StdEncoding.DecodeString(response["file_data"].(string))
+	content := string(decodedData)
+	t.Logf("Processed content:\n%s", content)
+
+	if !strings.Contains(content, "José,jose@test.com,true") {
+		t.Error("UTF-16 input should be transcoded to UTF-8 and its email detected")
+	}
+}
+
+func TestUnsupportedEncodingOption(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "test.csv")
+	part.Write([]byte("name,email\nJohn,john@test.com"))
+	writer.WriteField("encoding", "ebcdic")
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if !strings.Contains(response["error"], "encoding") {
+		t.Errorf("Error should mention the encoding, got: %s", response["error"])
+	}
+}
+
+func TestGzipUpload(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("name,email\nJohn,john@test.com\nJane,invalid-email"))
+	gz.Close()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "contacts.csv.gz")
+	part.Write(compressed.Bytes())
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var uploadResponse map[string]string
+	json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	req = httptest.NewRequest("GET", "/API/download/"+uploadResponse["id"], nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	decodedData, _ := base64.StdEncoding.DecodeString(response["file_data"].(string))
+	content := string(decodedData)
+
+	if !strings.Contains(content, "John,john@test.com,true") || !strings.Contains(content, "Jane,invalid-email,false") {
+		t.Errorf("Gzip upload should be decompressed and processed, got:\n%s", content)
+	}
+}
+
+func TestZipUploadModes(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	first, _ := zw.Create("first.csv")
+	first.Write([]byte("name,email\nJohn,john@test.com"))
+	second, _ := zw.Create("nested/second.csv")
+	second.Write([]byte("name,email\nJane,invalid-email"))
+	readme, _ := zw.Create("README.txt")
+	readme.Write([]byte("not a csv"))
+	zw.Close()
+
+	upload := func(zipMode string) (int, map[string]interface{}) {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, _ := writer.CreateFormFile("file", "contacts.zip")
+		part.Write(archive.Bytes())
+		writer.WriteField("zip_mode", zipMode)
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/API/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	download := func(jobID string) string {
+		req := httptest.NewRequest("GET", "/API/download/"+jobID, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		fileData, _ := response["file_data"].(string)
+		decodedData, _ := base64.StdEncoding.DecodeString(fileData)
+		return string(decodedData)
+	}
+
+	code, combined := upload("combined")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200 for combined zip, got %d", code)
+	}
+
+	code, perEntry := upload("per_entry")
+	if code != http.StatusOK {
+		t.Fatalf("Expected status 200 for per_entry zip, got %d", code)
+	}
+
+	ids, _ := perEntry["ids"].([]interface{})
+	if len(ids) != 2 {
+		t.Fatalf("Expected one job per CSV entry, got: %v", perEntry["ids"])
+	}
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	content := download(combined["id"].(string))
+	if strings.Count(content, "name,email,has_email") != 1 ||
+		!strings.Contains(content, "John,john@test.com,true") ||
+		!strings.Contains(content, "Jane,invalid-email,false") {
+		t.Errorf("Combined zip should merge all CSV entries under one header, got:\n%s", content)
+	}
+
+	if content := download(ids[1].(string)); !strings.Contains(content, "Jane") || strings.Contains(content, "John") {
+		t.Errorf("Per-entry job should only contain its own entry, got:\n%s", content)
+	}
+}
+
+func TestCompressionRatioGuard(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	// Highly repetitive content decompresses to far more than 100x its size
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("name,email\n"))
+	gz.Write(bytes.Repeat([]byte("aaaaaaaa,aaaaaaaa\n"), 200000))
+	gz.Close()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "bomb.csv.gz")
+	part.Write(compressed.Bytes())
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var uploadResponse map[string]string
+	json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+
+	// Poll until processing stops; slow builds (e.g. -race) take a while
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		req = httptest.NewRequest("GET", "/API/download/"+uploadResponse["id"], nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusLocked || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected job to fail with status 400, got %d", w.Code)
+	}
+}
+
+func buildTestWorkbook() []byte {
+	return buildTestWorkbookWithSheet(`<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c><c r="D1" t="s"><v>3</v></c><c r="E1" t="s"><v>4</v></c></row>
+<row r="2"><c r="A2" t="s"><v>5</v></c><c r="B2" t="s"><v>6</v></c><c r="C2" s="1"><v>45292</v></c><c r="D2"><f>0.1+0.2</f><v>0.30000000000000004</v></c><c r="E2" t="b"><v>1</v></c></row>
+<row r="3"><c r="A3" t="inlineStr"><is><t>Jane</t></is></c><c r="D3"><v>1500</v></c></row>
+</sheetData></worksheet>`)
+}
+
+// buildTestWorkbookWithSheet builds the test workbook with contactsSheet as
+// the worksheet XML of its Contacts sheet.
+func buildTestWorkbookWithSheet(contactsSheet string) []byte {
+	parts := map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"></Types>`,
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Summary" sheetId="1" r:id="rId1"/><sheet name="Contacts" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>name</t></si><si><t>email</t></si><si><t>joined</t></si><si><t>score</t></si><si><t>active</t></si>
+<si><r><t>Jo</t></r><r><t>hn</t></r></si><si><t>john@test.com</t></si><si><t>total</t></si>
+</sst>`,
+		"xl/styles.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts><numFmt numFmtId="164" formatCode="dd/mm/yyyy"/></numFmts>
+<cellXfs><xf numFmtId="0"/><xf numFmtId="164"/></cellXfs>
+</styleSheet>`,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>7</v></c></row><row r="2"><c r="A2"><v>2</v></c></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": contactsSheet,
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, content := range parts {
+		part, _ := zw.Create(name)
+		part.Write([]byte(content))
+	}
+	zw.Close()
+	return archive.Bytes()
+}
+
+func TestXLSXUploadWithSheetSelection(t *testing.T) {
+	router, _ := setupTestRouter()
+	workbook := buildTestWorkbook()
+
+	upload := func(sheet string) string {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, _ := writer.CreateFormFile("file", "contacts.xlsx")
+		part.Write(workbook)
+		writer.WriteField("sheet", sheet)
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/API/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var uploadResponse map[string]string
+		json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+		return uploadResponse["id"]
+	}
+
+	byName := upload("Contacts")
+	byIndex := upload("2")
+	missing := upload("Nope")
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	expected := "name,email,joined,score,active,has_email\n" +
+		"John,john@test.com,2024-01-01,0.3,true,true\n" +
+		"Jane,,,1500,,false\n"
+
+	for _, jobID := range []string{byName, byIndex} {
+		req := httptest.NewRequest("GET", "/API/download/"+jobID, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		fileData, _ := response["file_data"].(string)
+		decodedData, _ := base64.StdEncoding.DecodeString(fileData)
+
+		if string(decodedData) != expected {
+			t.Errorf("Unexpected xlsx conversion, got:\n%s\nwant:\n%s", decodedData, expected)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/API/download/"+missing, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected unknown sheet to fail the job with status 400, got %d", w.Code)
+	}
+}
+
+func TestXLSXCellReferenceBounds(t *testing.T) {
+	router, _ := setupTestRouter()
+	sheet := func(rows string) string {
+		return `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>name</t></is></c><c r="B1" t="inlineStr"><is><t>email</t></is></c></row>
+` + rows + `
+</sheetData></worksheet>`
+	}
+
+	// A reference past XFD is rejected instead of padding the row out to it
+	for _, reference := range []string{"XFE2", "ZZZZZZZZ2", "ZZZZZZZZZZZZZZZZZZZZ2"} {
+		workbook := buildTestWorkbookWithSheet(sheet(`<row r="2"><c r="` + reference + `" t="inlineStr"><is><t>x</t></is></c></row>`))
+		w := postPreview(router, "contacts.xlsx", string(workbook), map[string]string{"sheet": "Contacts"})
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid cell reference") {
+			t.Errorf("Expected status 400 for cell %s, got %d: %s", reference, w.Code, w.Body.String())
+		}
+	}
+
+	// Cells past the header are dropped instead of shifting into its columns
+	workbook := buildTestWorkbookWithSheet(sheet(`<row r="2"><c r="A2" t="inlineStr"><is><t>Ada</t></is></c><c r="XFD2" t="inlineStr"><is><t>x</t></is></c></row>`))
+	w := postPreview(router, "contacts.xlsx", string(workbook), map[string]string{"sheet": "Contacts"})
+	var preview struct {
+		Rows [][]string `json:"rows"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	if w.Code != http.StatusOK || len(preview.Rows) != 1 || strings.Join(preview.Rows[0], ",") != "Ada,,false" {
+		t.Errorf("Expected the cell past the header to be dropped, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email,age,score\nJohn,john@test.com,42,9.5\nJane,invalid-email,,7"
+
+	upload := func(outputFormat string) string {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, _ := writer.CreateFormFile("file", "people.csv")
+		part.Write([]byte(csvContent))
+		writer.WriteField("output_format", outputFormat)
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/API/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %s", outputFormat, w.Code, w.Body.String())
+		}
+
+		var uploadResponse map[string]string
+		json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+		return uploadResponse["id"]
+	}
+
+	download := func(jobID string) (map[string]interface{}, []byte) {
+		req := httptest.NewRequest("GET", "/API/download/"+jobID, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		fileData, _ := response["file_data"].(string)
+		decodedData, _ := base64.StdEncoding.DecodeString(fileData)
+		return response, decodedData
+	}
+
+	ndjsonJob := upload("ndjson")
+	jsonJob := upload("json")
+	parquetJob := upload("parquet")
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	response, content := download(ndjsonJob)
+	if response["content_type"] != "application/x-ndjson" || response["processed_name"] != "people.csv_processed.ndjson" {
+		t.Errorf("Unexpected NDJSON metadata: %v, %v", response["content_type"], response["processed_name"])
+	}
+	expectedLine := `{"name":"John","email":"john@test.com","age":"42","score":"9.5","has_email":"true"}`
+	if lines := strings.Split(strings.TrimSpace(string(content)), "\n"); len(lines) != 2 || lines[0] != expectedLine {
+		t.Errorf("Unexpected NDJSON output:\n%s", content)
+	}
+
+	_, content = download(jsonJob)
+	var rows []map[string]string
+	if err := json.Unmarshal(content, &rows); err != nil || len(rows) != 2 || rows[1]["email"] != "invalid-email" {
+		t.Errorf("Unexpected JSON output (%v):\n%s", err, content)
+	}
+
+	response, content = download(parquetJob)
+	if response["content_type"] != "application/vnd.apache.parquet" {
+		t.Errorf("Unexpected parquet content type: %v", response["content_type"])
+	}
+	parquetFile, err := parquet.OpenFile(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("Failed to open parquet output: %v", err)
+	}
+	if parquetFile.NumRows() != 2 {
+		t.Errorf("Expected 2 parquet rows, got %d", parquetFile.NumRows())
+	}
+
+	var columns []string
+	for _, field := range parquetFile.Schema().Fields() {
+		columns = append(columns, field.Name()+":"+field.Type().String())
+	}
+	expectedColumns := "name:STRING,email:STRING,age:INT(64,true),score:DOUBLE,has_email:BOOLEAN"
+	if strings.Join(columns, ",") != expectedColumns {
+		t.Errorf("Unexpected parquet schema: %s", strings.Join(columns, ","))
+	}
+}
+
+func TestSQLiteOutputFormat(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "people.csv")
+	part.Write([]byte("name,email,age,score\nJohn,john@test.com,42,9.5\nJane,invalid-email,,7\n,,,"))
+	writer.WriteField("output_format", "sqlite")
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var uploadResponse map[string]string
+	json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	req = httptest.NewRequest("GET", "/API/download/"+uploadResponse["id"], nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	if response["processed_name"] != "people.csv_processed.db" {
+		t.Errorf("Expected .db download, got: %v", response["processed_name"])
+	}
+
+	decodedData, _ := base64.StdEncoding.DecodeString(response["file_data"].(string))
+	dbPath := t.TempDir() + "/processed.db"
+	os.WriteFile(dbPath, decodedData, 0644)
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite output: %v", err)
+	}
+	defer db.Close()
+
+	var schema string
+	db.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'records'`).Scan(&schema)
+	if !strings.Contains(schema, `"age" INTEGER`) || !strings.Contains(schema, `"score" REAL`) ||
+		!strings.Contains(schema, `"name" TEXT`) || !strings.Contains(schema, `"has_email" INTEGER`) {
+		t.Errorf("Unexpected records schema: %s", schema)
+	}
+
+	var emails int
+	db.QueryRow(`SELECT COUNT(*) FROM records WHERE has_email = 1 AND age = 42`).Scan(&emails)
+	if emails != 1 {
+		t.Errorf("Expected one typed row with an email, got %d", emails)
+	}
+
+	var totalRecords, emptyRecords int
+	var encoding, delimiter string
+	err = db.QueryRow(`SELECT total_records, empty_records, encoding, delimiter FROM job_summary`).Scan(&totalRecords, &emptyRecords, &encoding, &delimiter)
+	if err != nil || totalRecords != 3 || emptyRecords != 1 || encoding != "utf-8" || delimiter != "," {
+		t.Errorf("Unexpected job summary (%v): total=%d empty=%d encoding=%s delimiter=%q", err, totalRecords, emptyRecords, encoding, delimiter)
+	}
+}
+
+func TestSQLiteOutputCaseInsensitiveHeaders(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	jobID := uploadTestFile(t, router, "cased.csv", "Email,email\nJohn@test.com,john@test.com\n",
+		map[string]string{"output_format": "sqlite"})
+	if details := waitForJob(t, router, jobID); details.Status != models.JobStatusCompleted {
+		t.Fatalf("Expected headers differing in case to complete, got %s: %+v", details.Status, details.Failure)
+	}
+
+	req := httptest.NewRequest("GET", "/API/download/"+jobID, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	decodedData, _ := base64.StdEncoding.DecodeString(response["file_data"].(string))
+	dbPath := t.TempDir() + "/processed.db"
+	os.WriteFile(dbPath, decodedData, 0644)
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite output: %v", err)
+	}
+	defer db.Close()
+
+	var schema string
+	db.QueryRow(`SELECT sql FROM sqlite_master WHERE name = 'records'`).Scan(&schema)
+	if !strings.Contains(schema, `"Email" TEXT`) || !strings.Contains(schema, `"email_2" TEXT`) {
+		t.Errorf("Unexpected records schema: %s", schema)
+	}
+}
+
+func TestTolerantErrorMode(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\nJohn,john@test.com\nbad,row,extra\nJa\"ne,jane@test.com\nBob,bob@test.com\n"
+
+	upload := func(fields map[string]string) string {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, _ := writer.CreateFormFile("file", "messy.csv")
+		part.Write([]byte(csvContent))
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/API/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var uploadResponse map[string]string
+		json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+		return uploadResponse["id"]
+	}
+
+	get := func(path string) (int, map[string]interface{}, []byte) {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		fileData, _ := response["file_data"].(string)
+		decodedData, _ := base64.StdEncoding.DecodeString(fileData)
+		return w.Code, response, decodedData
+	}
+
+	strictJob := upload(nil)
+	tolerantJob := upload(map[string]string{"error_mode": "tolerant"})
+	budgetJob := upload(map[string]string{"error_mode": "tolerant", "max_errors": "1"})
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	if code, _, _ := get("/API/download/" + strictJob); code != http.StatusBadRequest {
+		t.Errorf("Expected strict job to fail, got status %d", code)
+	}
+
+	code, response, output := get("/API/download/" + tolerantJob)
+	if code != http.StatusOK {
+		t.Fatalf("Expected tolerant job to complete, got status %d", code)
+	}
+	if string(output) != "name,email,has_email\nJohn,john@test.com,true\nBob,bob@test.com,true\n" {
+		t.Errorf("Unexpected processed content: %q", string(output))
+	}
+	if response["row_errors"] != 2.0 {
+		t.Errorf("Expected 2 row errors, got %v", response["row_errors"])
+	}
+
+	_, _, errorsFile := get("/API/download/" + tolerantJob + "/errors")
+	records, err := csv.NewReader(bytes.NewReader(errorsFile)).ReadAll()
+	if err != nil || len(records) != 3 {
+		t.Fatalf("Expected header and 2 rows in errors file, got %q (%v)", string(errorsFile), err)
+	}
+	if records[1][1] != "3" || records[1][2] != "bad,row,extra" || !strings.Contains(records[1][3], "wrong number of fields") {
+		t.Errorf("Unexpected field count error row: %v", records[1])
+	}
+	if records[2][1] != "4" || records[2][2] != "Ja\"ne,jane@test.com" || !strings.Contains(records[2][3], "bare \"") {
+		t.Errorf("Unexpected bare quote error row: %v", records[2])
+	}
+
+	// Exceeding the error budget fails the job but keeps the report
+	if code, _, _ := get("/API/download/" + budgetJob); code != http.StatusBadRequest {
+		t.Errorf("Expected job over error budget to fail, got status %d", code)
+	}
+	if code, _, _ := get("/API/download/" + budgetJob + "/errors"); code != http.StatusOK {
+		t.Errorf("Expected errors file for failed job, got status %d", code)
+	}
+}
+
+func TestCSVDelimiter(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	detected := uploadTestFile(t, router, "semicolon.csv", "name;email\nJohn;john@test.com\n", map[string]string{"delimiter": "auto"})
+	tabbed := uploadTestFile(t, router, "tabbed.csv", "name\temail\nJane\tjane@test.com\n", map[string]string{"delimiter": "tab"})
+	// Without a delimiter a file is comma-separated, whatever else its lines hold
+	single := uploadTestFile(t, router, "single.csv", "name\nDoe; John\nRoe; Jane\n", nil)
+	for _, jobID := range []string{detected, tabbed, single} {
+		if details := waitForJob(t, router, jobID); details.Status != models.JobStatusCompleted {
+			t.Fatalf("Expected job %s to complete, got %s", jobID, details.Status)
+		}
+	}
+	if output := getJobOutput(t, router, detected); output != "name,email,has_email\nJohn,john@test.com,true\n" {
+		t.Errorf("Expected the detected semicolon to split the rows, got %q", output)
+	}
+	if output := getJobOutput(t, router, tabbed); output != "name,email,has_email\nJane,jane@test.com,true\n" {
+		t.Errorf("Expected the requested tab to split the rows, got %q", output)
+	}
+	if output := getJobOutput(t, router, single); output != "name,has_email\nDoe; John,false\nRoe; Jane,false\n" {
+		t.Errorf("Expected a single comma-separated column, got %q", output)
+	}
+
+	for _, fields := range []map[string]string{
+		{"delimiter": "\""},
+		{"delimiter": ";;"},
+		{"delimiter": ";", "comment": ";"},
+	} {
+		if w := postPreview(router, "contacts.csv", "name,email\n", fields); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %v, got %d", fields, w.Code)
+		}
+	}
+}
+
+func TestLenientCSVOptions(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "Vendor export \"Q3\"\nGenerated 2024-01-01\nname, email,note\n# internal comment\nJohn, john@test.com,said \"hi\"\nJane,jane@test.com\nBob,bob@test.com,a,extra\n"
+
+	upload := func(fields map[string]string) (int, string) {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		part, _ := writer.CreateFormFile("file", "vendor.csv")
+		part.Write([]byte(csvContent))
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/API/upload", &buf)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var uploadResponse map[string]string
+		json.Unmarshal(w.Body.Bytes(), &uploadResponse)
+		return w.Code, uploadResponse["id"]
+	}
+
+	_, strictJob := upload(map[string]string{"skip_lines": "2"})
+	_, lenientJob := upload(map[string]string{
+		"skip_lines":         "2",
+		"comment":            "#",
+		"lazy_quotes":        "true",
+		"variable_fields":    "true",
+		"trim_leading_space": "true",
+	})
+
+	if code, _ := upload(map[string]string{"comment": ","}); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for comma comment character, got %d", code)
+	}
+	if code, _ := upload(map[string]string{"skip_lines": "-1"}); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for negative skip_lines, got %d", code)
+	}
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	req := httptest.NewRequest("GET", "/API/download/"+strictJob, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected strict parsing to fail, got status %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/API/download/"+lenientJob, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected lenient parsing to succeed, got status %d: %s", w.Code, w.Body.String())
+	}
+
+	var response map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	fileData, _ := base64.StdEncoding.DecodeString(response["file_data"].(string))
+
+	expected := "name,email,note,has_email\n" +
+		"John,john@test.com,\"said \"\"hi\"\"\",true\n" +
+		"Jane,jane@test.com,,true\n" +
+		"Bob,bob@test.com,a,true\n"
+	if string(fileData) != expected {
+		t.Errorf("Expected processed content %q, got %q", expected, string(fileData))
+	}
+}
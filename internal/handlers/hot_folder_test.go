@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"demandscience/internal/services"
+)
+
+func TestHotFolderWatcher(t *testing.T) {
+	_, handler := setupTestRouter()
+
+	root := t.TempDir()
+	inbox := filepath.Join(root, "inbox")
+	outbox := filepath.Join(root, "outbox")
+	watcher, err := services.DSHotFolderWatcher(handler.csvService, inbox, outbox)
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	watcher.StableFor = 0
+
+	os.WriteFile(filepath.Join(inbox, "contacts.csv"), []byte("name,email\nJohn,john@test.com\n"), 0644)
+	os.WriteFile(filepath.Join(inbox, "broken.csv"), []byte(""), 0644)
+	os.WriteFile(filepath.Join(inbox, "notes.txt"), []byte("ignored"), 0644)
+
+	// The first scan only records the files; they start once unchanged on the next one
+	watcher.Scan()
+	if _, err := os.Stat(filepath.Join(inbox, "contacts.csv")); err != nil {
+		t.Fatalf("Input should stay in the inbox while it is processed: %v", err)
+	}
+	watcher.Scan()
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+	watcher.Scan()
+
+	output, err := os.ReadFile(filepath.Join(outbox, "contacts_processed.csv"))
+	if err != nil {
+		t.Fatalf("Expected processed file in outbox: %v", err)
+	}
+	if string(output) != "name,email,has_email\nJohn,john@test.com,true\n" {
+		t.Errorf("Unexpected processed content: %q", string(output))
+	}
+
+	if _, err := os.Stat(filepath.Join(inbox, "done", "contacts.csv")); err != nil {
+		t.Errorf("Expected input moved to done/: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(inbox, "failed", "broken.csv")); err != nil {
+		t.Errorf("Expected empty input moved to failed/: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(inbox, "notes.txt")); err != nil {
+		t.Errorf("Non-CSV files should be left alone: %v", err)
+	}
+
+	entries, _ := os.ReadDir(outbox)
+	if len(entries) != 1 {
+		t.Errorf("Expected exactly one file in outbox, got %d", len(entries))
+	}
+}
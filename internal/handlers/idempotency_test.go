@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"demandscience/internal/models"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func postIdempotentUpload(router *gin.Engine, key, filename, content string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotentUpload(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\nJohn Smith,john@example.com\n"
+	first := postIdempotentUpload(router, "retry-1", "contacts.csv", csvContent)
+	if first.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", first.Code, first.Body.String())
+	}
+	var original models.UploadResponse
+	json.Unmarshal(first.Body.Bytes(), &original)
+
+	// A retry is a new multipart body with another boundary but the same request
+	replay := postIdempotentUpload(router, "retry-1", "contacts.csv", csvContent)
+	if replay.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for a replay, got %d: %s", replay.Code, replay.Body.String())
+	}
+	var replayed models.UploadResponse
+	json.Unmarshal(replay.Body.Bytes(), &replayed)
+	if replayed.ID != original.ID {
+		t.Errorf("Expected the original job ID %s, got %s", original.ID, replayed.ID)
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("Expected the Idempotent-Replayed header on a replay")
+	}
+
+	conflict := postIdempotentUpload(router, "retry-1", "contacts.csv", csvContent+"Jane Doe,jane@example.com\n")
+	if conflict.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a different body, got %d: %s", conflict.Code, conflict.Body.String())
+	}
+
+	other := postIdempotentUpload(router, "retry-2", "contacts.csv", csvContent)
+	var otherResponse models.UploadResponse
+	json.Unmarshal(other.Body.Bytes(), &otherResponse)
+	if other.Code != http.StatusOK || otherResponse.ID == original.ID {
+		t.Errorf("Expected a new job for a new key, got %d: %s", other.Code, other.Body.String())
+	}
+
+	tooLong := postIdempotentUpload(router, strings.Repeat("k", 256), "contacts.csv", csvContent)
+	if tooLong.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an oversized key, got %d", tooLong.Code)
+	}
+}
+
+func TestIdempotentUploadConcurrentRetries(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\nJohn Smith,john@example.com\n"
+	ids := make([]string, 5)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := postIdempotentUpload(router, "concurrent", "contacts.csv", csvContent)
+			var response models.UploadResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			ids[i] = response.ID
+		}(i)
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		if id == "" || id != ids[0] {
+			t.Fatalf("Expected every retry to get the same job ID, got %v", ids)
+		}
+	}
+}
+
+func TestIdempotentUploadFailureReleasesKey(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	invalid := postIdempotentUpload(router, "fix-and-retry", "contacts.txt", "name,email\n")
+	if invalid.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an invalid file, got %d", invalid.Code)
+	}
+
+	valid := postIdempotentUpload(router, "fix-and-retry", "contacts.csv", "name,email\nJohn Smith,john@example.com\n")
+	if valid.Code != http.StatusOK {
+		t.Errorf("Expected a failed upload to release its key, got %d: %s", valid.Code, valid.Body.String())
+	}
+}
+
+func TestIdempotentUploadPanicReleasesKey(t *testing.T) {
+	_, handler := setupTestRouter()
+
+	func() {
+		defer func() { recover() }()
+		handler.csvService.IdempotentUpload("owner", "panics", "fingerprint", func() ([]string, error) {
+			panic("upload crashed")
+		})
+	}()
+
+	done := make(chan []string)
+	go func() {
+		jobIDs, _, _ := handler.csvService.IdempotentUpload("owner", "panics", "fingerprint", func() ([]string, error) {
+			return []string{"job-1"}, nil
+		})
+		done <- jobIDs
+	}()
+	select {
+	case jobIDs := <-done:
+		if len(jobIDs) != 1 || jobIDs[0] != "job-1" {
+			t.Errorf("Expected the retry to run the upload, got %v", jobIDs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a panicking upload to release its key")
+	}
+}
+
+func TestIdempotentSourceURLUpload(t *testing.T) {
+	router := setupLoopbackRouter(t)
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("name,email\nJohn,john@test.com\n"))
+	}))
+	defer server.Close()
+
+	post := func(sourceURL string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"source_url": sourceURL})
+		req := httptest.NewRequest("POST", "/API/upload", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "url-key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := post(server.URL + "/contacts.csv")
+	replay := post(server.URL + "/contacts.csv")
+	if first.Code != http.StatusOK || replay.Body.String() != first.Body.String() {
+		t.Errorf("Expected the replay to return %s, got %d: %s", first.Body.String(), replay.Code, replay.Body.String())
+	}
+	if fetches != 1 {
+		t.Errorf("Expected the source to be fetched once, got %d", fetches)
+	}
+
+	if conflict := post(server.URL + "/other.csv"); conflict.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for another source_url, got %d: %s", conflict.Code, conflict.Body.String())
+	}
+}
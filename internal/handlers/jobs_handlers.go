@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const jobsPrefix = "/API/jobs/"
+
+// ListJobs returns jobs newest first, filtered by status, creation time,
+// file name and tag, one page at a time.
+func (handler *CsvProcessorHandler) ListJobs(ctx *gin.Context) {
+	clientIP := ctx.ClientIP()
+
+	query, err := parseJobQuery(ctx)
+	if err != nil {
+		log.Printf("[LIST_JOBS] [ERROR] Invalid query from IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+	// Callers only see their own jobs; admins see every job of their tenant
+	query.Tenant = principalTenant(ctx)
+	if principal := currentPrincipal(ctx); principal != nil && !principal.HasScope(models.ScopeAdmin) {
+		query.CreatedBy = principal.ID
+	}
+
+	response, err := handler.csvService.ListJobs(query)
+	if err != nil {
+		log.Printf("[LIST_JOBS] [ERROR] Listing failed - IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+func parseJobQuery(ctx *gin.Context) (models.JobQuery, error) {
+	query := models.JobQuery{
+		Status:   models.JobStatus(strings.ToUpper(ctx.Query("status"))),
+		FileName: ctx.Query("filename"),
+		Tag:      strings.TrimSpace(ctx.Query("tag")),
+		Cursor:   ctx.Query("cursor"),
+	}
+
+	switch query.Status {
+	case "", models.JobStatusInProgress, models.JobStatusCompleted, models.JobStatusFailed:
+	default:
+		return query, errors.New("status must be IN_PROGRESS, COMPLETED or FAILED")
+	}
+
+	if value := ctx.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return query, errors.New("limit must be a positive number")
+		}
+		query.Limit = limit
+	}
+
+	times := map[string]*time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+	}
+	for key, target := range times {
+		if value := ctx.Query(key); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, errors.New(key + " must be an RFC 3339 timestamp")
+			}
+			*target = parsed
+		}
+	}
+
+	return query, nil
+}
+
+// GetJob returns the status and metadata of a job without its file, with
+// links to the output and reports once they exist.
+func (handler *CsvProcessorHandler) GetJob(ctx *gin.Context) {
+	jobID := ctx.Param("id")
+
+	details := handler.csvService.GetJobDetails(jobID)
+	if details == nil {
+		log.Printf("[GET_JOB] [ERROR] Job not found - JobID: %s, IP: %s", jobID, ctx.ClientIP())
+		ctx.JSON(http.StatusNotFound, models.UploadResponse{
+			Error: "Job not found",
+		})
+		return
+	}
+	if !authorizeOwner(ctx, "Job", details.Tenant, details.CreatedBy) {
+		return
+	}
+
+	self := jobsPrefix + details.ID
+	details.Links["self"] = self
+	if details.HasOutput {
+		details.Links["output"] = self + "/output"
+	}
+	if details.HasRowErrors {
+		details.Links["rowErrors"] = "/API/download/" + details.ID + "/errors"
+	}
+	if details.HasProfile {
+		details.Links["profile"] = self + "/profile"
+	}
+	if details.Status == models.JobStatusCompleted {
+		details.Links["report"] = self + "/report.html"
+	}
+	if details.BatchID != "" {
+		details.Links["batch"] = "/API/batches/" + details.BatchID
+	}
+	if details.Input != nil {
+		details.Links["rerun"] = self + "/rerun"
+	}
+	if details.RerunOf != "" {
+		details.Links["rerunOf"] = jobsPrefix + details.RerunOf
+	}
+	if details.CachedFrom != "" {
+		details.Links["cachedFrom"] = jobsPrefix + details.CachedFrom
+	}
+
+	ctx.JSON(http.StatusOK, details)
+}
+
+// CancelJob stops a job that is still in progress.
+func (handler *CsvProcessorHandler) CancelJob(ctx *gin.Context) {
+	jobID := ctx.Param("id")
+
+	if job := handler.csvService.GetJob(jobID); job != nil && !authorizeOwner(ctx, "Job", job.Tenant, job.CreatedBy) {
+		return
+	}
+
+	if err := handler.csvService.CancelJob(jobID); err != nil {
+		log.Printf("[CANCEL_JOB] [ERROR] Cancel rejected - JobID: %s, IP: %s, Error: %v", jobID, ctx.ClientIP(), err)
+		status := http.StatusConflict
+		if errors.Is(err, services.ErrJobNotFound) {
+			status = http.StatusNotFound
+		}
+		ctx.JSON(status, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("[CANCEL_JOB] [SUCCESS] Cancellation requested - JobID: %s, IP: %s", jobID, ctx.ClientIP())
+	ctx.JSON(http.StatusAccepted, models.UploadResponse{
+		ID: jobID,
+	})
+}
+
+// RerunJob starts a new job from the retained upload of an existing one. An
+// optional JSON body with the upload options replaces the original options.
+func (handler *CsvProcessorHandler) RerunJob(ctx *gin.Context) {
+	clientIP := ctx.ClientIP()
+	jobID := ctx.Param("id")
+
+	log.Printf("[RERUN_JOB] Starting rerun request - JobID: %s, IP: %s", jobID, clientIP)
+
+	if job := handler.csvService.GetJob(jobID); job != nil && !authorizeOwner(ctx, "Job", job.Tenant, job.CreatedBy) {
+		return
+	}
+
+	var options *models.ProcessingOptions
+	if ctx.Request.ContentLength != 0 {
+		var request models.OptionsRequest
+		if err := ctx.ShouldBindJSON(&request); err != nil {
+			log.Printf("[RERUN_JOB] [ERROR] Invalid request body - JobID: %s, IP: %s, Error: %v", jobID, clientIP, err)
+			ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+				Error: "Invalid processing options",
+			})
+			return
+		}
+		requested := request.Options()
+		options = &requested
+	}
+
+	rerunID, err := handler.csvService.RerunJob(jobID, principalID(ctx), options)
+	if err != nil {
+		log.Printf("[RERUN_JOB] [ERROR] Rerun failed - JobID: %s, IP: %s, Error: %v", jobID, clientIP, err)
+		if respondQuotaError(ctx, err) {
+			return
+		}
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, services.ErrJobNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrInputNotRetained):
+			status = http.StatusGone
+		}
+		ctx.JSON(status, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("[RERUN_JOB] [SUCCESS] Rerun started - JobID: %s, RerunOf: %s, IP: %s", rerunID, jobID, clientIP)
+	ctx.Header("Location", jobsPrefix+rerunID)
+	ctx.JSON(http.StatusAccepted, models.UploadResponse{
+		ID: rerunID,
+	})
+}
+
+// DownloadJobOutput streams the processed file of a completed job as an attachment.
+func (handler *CsvProcessorHandler) DownloadJobOutput(ctx *gin.Context) {
+	clientIP := ctx.ClientIP()
+	jobID := ctx.Param("id")
+
+	log.Printf("[JOB_OUTPUT] Starting output download - JobID: %s, IP: %s", jobID, clientIP)
+
+	details := handler.csvService.GetJobDetails(jobID)
+	if details == nil {
+		log.Printf("[JOB_OUTPUT] [ERROR] Job not found - JobID: %s, IP: %s", jobID, clientIP)
+		ctx.JSON(http.StatusNotFound, models.UploadResponse{
+			Error: "Job not found",
+		})
+		return
+	}
+	if !authorizeOwner(ctx, "Job", details.Tenant, details.CreatedBy) {
+		return
+	}
+	if details.Status != models.JobStatusCompleted || !details.HasOutput {
+		log.Printf("[JOB_OUTPUT] [ERROR] Output not available - JobID: %s, Status: %s", jobID, details.Status)
+		ctx.JSON(http.StatusConflict, models.UploadResponse{
+			Error: "Job has no output while " + string(details.Status),
+		})
+		return
+	}
+
+	reader, err := handler.csvService.OpenProcessedFile(jobID)
+	if err != nil {
+		log.Printf("[JOB_OUTPUT] [ERROR] Failed to open output - JobID: %s, Error: %v", jobID, err)
+		ctx.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Error: "Processed file not found",
+		})
+		return
+	}
+	defer reader.Close()
+
+	name := details.OriginalFileName + "_processed." + services.OutputExtension(details.Options.OutputFormat)
+	ctx.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	ctx.DataFromReader(http.StatusOK, -1, services.OutputContentType(details.Options.OutputFormat), reader, nil)
+
+	log.Printf("[JOB_OUTPUT] [SUCCESS] Output streamed - JobID: %s, File: %s, IP: %s", jobID, name, clientIP)
+}
+
+// JobProfile returns the per-column data quality profile of a completed job.
+func (handler *CsvProcessorHandler) JobProfile(ctx *gin.Context) {
+	clientIP := ctx.ClientIP()
+	jobID := ctx.Param("id")
+
+	log.Printf("[JOB_PROFILE] Starting profile request - JobID: %s, IP: %s", jobID, clientIP)
+
+	details := handler.csvService.GetJobDetails(jobID)
+	if details == nil {
+		log.Printf("[JOB_PROFILE] [ERROR] Job not found - JobID: %s, IP: %s", jobID, clientIP)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid job ID",
+		})
+		return
+	}
+	if !authorizeOwner(ctx, "Job", details.Tenant, details.CreatedBy) {
+		return
+	}
+
+	if details.Status == models.JobStatusInProgress {
+		ctx.JSON(http.StatusLocked, models.UploadResponse{
+			Error: "Job is still in progress",
+		})
+		return
+	}
+
+	profile, err := handler.csvService.GetJobProfile(jobID)
+	if err != nil {
+		log.Printf("[JOB_PROFILE] [ERROR] Profile unavailable - JobID: %s, Status: %s, Error: %v", jobID, details.Status, err)
+		ctx.JSON(http.StatusNotFound, models.UploadResponse{
+			Error: "No profile for this job",
+		})
+		return
+	}
+
+	log.Printf("[JOB_PROFILE] [SUCCESS] Profile returned - JobID: %s, Rows: %d, Columns: %d, IP: %s",
+		jobID, profile.Rows, len(profile.Columns), clientIP)
+	ctx.JSON(http.StatusOK, profile)
+}
+
+// JobReport renders a self-contained HTML summary of a completed job.
+func (handler *CsvProcessorHandler) JobReport(ctx *gin.Context) {
+	clientIP := ctx.ClientIP()
+	jobID := ctx.Param("id")
+
+	log.Printf("[JOB_REPORT] Starting report request - JobID: %s, IP: %s", jobID, clientIP)
+
+	details := handler.csvService.GetJobDetails(jobID)
+	if details == nil {
+		log.Printf("[JOB_REPORT] [ERROR] Job not found - JobID: %s, IP: %s", jobID, clientIP)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid job ID",
+		})
+		return
+	}
+	if !authorizeOwner(ctx, "Job", details.Tenant, details.CreatedBy) {
+		return
+	}
+
+	if details.Status == models.JobStatusInProgress {
+		ctx.JSON(http.StatusLocked, models.UploadResponse{
+			Error: "Job is still in progress",
+		})
+		return
+	}
+
+	page, err := handler.csvService.RenderJobReport(jobID)
+	if err != nil {
+		log.Printf("[JOB_REPORT] [ERROR] Report unavailable - JobID: %s, Status: %s, Error: %v", jobID, details.Status, err)
+		ctx.JSON(http.StatusNotFound, models.UploadResponse{
+			Error: "No report for this job",
+		})
+		return
+	}
+
+	log.Printf("[JOB_REPORT] [SUCCESS] Report rendered - JobID: %s, Size: %d bytes, IP: %s", jobID, len(page), clientIP)
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
@@ -0,0 +1,530 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadTestFile uploads content through /API/upload with optional form
+// fields and returns the job ID.
+func uploadTestFile(t *testing.T, router *gin.Engine, filename, content string, fields map[string]string) string {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/upload", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Upload failed with status %d: %s", w.Code, w.Body.String())
+	}
+
+	var response models.UploadResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return response.ID
+}
+
+func TestJobProfile(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email,phone,age\n" +
+		"John,john@test.com,+1 555 123 4567,34\n" +
+		"Jane,invalid-email,(555) 765-4321,\n" +
+		"John,bob@test.com,not a phone,29\n"
+	jobID := uploadTestFile(t, router, "profile.csv", csvContent, nil)
+
+	time.Sleep(2 * time.Second)
+
+	req := httptest.NewRequest("GET", "/API/jobs/"+jobID+"/profile", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var profile models.JobProfile
+	if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil {
+		t.Fatalf("Failed to parse profile: %v", err)
+	}
+	if profile.Rows != 3 || len(profile.Columns) != 4 {
+		t.Fatalf("Expected 3 rows and 4 columns, got %d rows and %d columns", profile.Rows, len(profile.Columns))
+	}
+
+	name, email, phone, age := profile.Columns[0], profile.Columns[1], profile.Columns[2], profile.Columns[3]
+	if name.Distinct != 2 || name.TopValues[0].Value != "John" || name.TopValues[0].Count != 2 {
+		t.Errorf("Unexpected name profile: %+v", name)
+	}
+	if email.ValidEmailPercent != 66.67 {
+		t.Errorf("Expected 66.67%% valid emails, got %v", email.ValidEmailPercent)
+	}
+	if phone.ValidPhonePercent != 66.67 {
+		t.Errorf("Expected 66.67%% valid phones, got %v", phone.ValidPhonePercent)
+	}
+	if age.Type != "integer" || age.Filled != 2 || age.FillRate != 66.67 {
+		t.Errorf("Unexpected age profile: %+v", age)
+	}
+
+	req = httptest.NewRequest("GET", "/API/jobs/invalid-id/profile", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestJobProfileDistinctEstimate(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var csvContent bytes.Buffer
+	csvContent.WriteString("id,email\n")
+	rows := 30000
+	for i := 0; i < rows; i++ {
+		csvContent.WriteString(time.Duration(i).String() + ",user@test.com\n")
+	}
+	jobID := uploadTestFile(t, router, "distinct.csv", csvContent.String(), nil)
+
+	var w *httptest.ResponseRecorder
+	for attempt := 0; attempt < 20; attempt++ {
+		time.Sleep(500 * time.Millisecond)
+		req := httptest.NewRequest("GET", "/API/jobs/"+jobID+"/profile", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusLocked {
+			break
+		}
+	}
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var profile models.JobProfile
+	json.Unmarshal(w.Body.Bytes(), &profile)
+	id, email := profile.Columns[0], profile.Columns[1]
+	if !id.Approximate || id.Distinct < rows*97/100 || id.Distinct > rows*103/100 {
+		t.Errorf("Expected an approximate distinct count near %d, got %d (approximate: %v)", rows, id.Distinct, id.Approximate)
+	}
+	if email.Approximate || email.Distinct != 1 || email.Type != "email" {
+		t.Errorf("Unexpected email profile: %+v", email)
+	}
+}
+
+func TestJobProfileTopValuesAfterEstimate(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	// The frequent value only appears once distinct values are estimated
+	var csvContent bytes.Buffer
+	csvContent.WriteString("code,email\n")
+	for i := 0; i < 12000; i++ {
+		csvContent.WriteString("code-" + strconv.Itoa(i) + ",late@test.com\n")
+	}
+	for i := 0; i < 3000; i++ {
+		csvContent.WriteString("late,late@test.com\n")
+	}
+	jobID := uploadTestFile(t, router, "frequent.csv", csvContent.String(), nil)
+	waitForJob(t, router, jobID)
+
+	req := httptest.NewRequest("GET", "/API/jobs/"+jobID+"/profile", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var profile models.JobProfile
+	json.Unmarshal(w.Body.Bytes(), &profile)
+	code := profile.Columns[0]
+	if !code.Approximate || len(code.TopValues) == 0 {
+		t.Fatalf("Expected approximate top values, got %+v", code)
+	}
+	if top := code.TopValues[0]; top.Value != "late" || top.Count < 3000 {
+		t.Errorf("Expected late to be the most frequent value, got %+v", top)
+	}
+}
+
+func TestJobReport(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\n" +
+		"John,john@acme.com\n" +
+		"Jane,jane@acme.com\n" +
+		"Bob,bob@other.org\n" +
+		"Ann,ann@acme\n" +
+		"Tom,@acme.com\n" +
+		"Sue,no email\n" +
+		",\n"
+	jobID := uploadTestFile(t, router, "report.csv", csvContent, nil)
+
+	time.Sleep(2 * time.Second)
+
+	req := httptest.NewRequest("GET", "/API/jobs/"+jobID+"/report.html", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Expected an HTML response, got %s", w.Header().Get("Content-Type"))
+	}
+
+	page := w.Body.String()
+	for _, expected := range []string{"report.csv", "<svg", "acme.com", "other.org",
+		"Missing top-level domain", "Nothing before @", "No email-like field", "Valid: 3 (50%)"} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("Expected the report to contain %q", expected)
+		}
+	}
+	if strings.Contains(page, "<script") || strings.Contains(page, "http://") || strings.Contains(page, "https://") {
+		t.Error("The report should not reference external assets")
+	}
+
+	req = httptest.NewRequest("GET", "/API/jobs/invalid-id/report.html", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestListJobs(t *testing.T) {
+	router, _ := setupTestRouter()
+	start := time.Now().UTC()
+
+	csvContent := "name,email\nJohn,john@test.com\n"
+	first := uploadTestFile(t, router, "clients-march.csv", csvContent, map[string]string{"tags": "crm, march"})
+	second := uploadTestFile(t, router, "clients-april.csv", csvContent, map[string]string{"tags": "crm"})
+	third := uploadTestFile(t, router, "leads.csv", csvContent, nil)
+
+	time.Sleep(2 * time.Second)
+
+	list := func(query string) models.JobListResponse {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/API/jobs?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %q, got %d: %s", query, w.Code, w.Body.String())
+		}
+		var response models.JobListResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+	ids := func(response models.JobListResponse) []string {
+		var ids []string
+		for _, job := range response.Jobs {
+			ids = append(ids, job.ID)
+		}
+		return ids
+	}
+
+	// Newest first, two per page
+	after := url.QueryEscape(start.Add(-time.Second).Format(time.RFC3339))
+	page := list("limit=2&created_after=" + after)
+	if got := ids(page); len(got) != 2 || got[0] != third || got[1] != second || page.NextCursor == "" {
+		t.Fatalf("Unexpected first page: %v, cursor %q", got, page.NextCursor)
+	}
+	page = list("limit=2&created_after=" + after + "&cursor=" + page.NextCursor)
+	if got := ids(page); len(got) != 1 || got[0] != first || page.NextCursor != "" {
+		t.Fatalf("Unexpected second page: %v, cursor %q", got, page.NextCursor)
+	}
+
+	if got := ids(list("tag=crm")); len(got) != 2 || got[0] != second || got[1] != first {
+		t.Errorf("Expected the two crm jobs, got %v", got)
+	}
+	if got := ids(list("tag=march")); len(got) != 1 || got[0] != first {
+		t.Errorf("Expected the march job, got %v", got)
+	}
+	if got := ids(list("filename=CLIENTS&created_after=" + after)); len(got) != 2 {
+		t.Errorf("Expected two jobs matching the file name, got %v", got)
+	}
+	if got := ids(list("status=failed&created_after=" + after)); len(got) != 0 {
+		t.Errorf("Expected no failed jobs, got %v", got)
+	}
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	if got := ids(list("created_after=" + future)); len(got) != 0 {
+		t.Errorf("Expected no jobs created in the future, got %v", got)
+	}
+	if job := list("tag=march").Jobs; len(job) == 1 && (job[0].Status != models.JobStatusCompleted || len(job[0].Tags) != 2) {
+		t.Errorf("Unexpected job summary: %+v", job[0])
+	}
+
+	for _, query := range []string{"cursor=not-a-cursor", "status=DONE", "limit=0", "limit=1000", "created_after=yesterday"} {
+		req := httptest.NewRequest("GET", "/API/jobs?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestGetJobAndOutput(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\nJohn,john@test.com\nJane,invalid-email\n"
+	jobID := uploadTestFile(t, router, "status.csv", csvContent, nil)
+
+	time.Sleep(2 * time.Second)
+
+	req := httptest.NewRequest("GET", "/API/jobs/"+jobID, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "file_data") {
+		t.Error("The job resource should not carry the file")
+	}
+
+	var details models.JobDetails
+	json.Unmarshal(w.Body.Bytes(), &details)
+	if details.Status != models.JobStatusCompleted || details.CompletedAt == nil || details.Stats == nil {
+		t.Fatalf("Unexpected job details: %+v", details)
+	}
+	if details.Stats.TotalRecords != 2 || details.Stats.EmailsFound != 1 {
+		t.Errorf("Unexpected counters: %+v", details.Stats)
+	}
+	if details.Links["output"] != "/API/jobs/"+jobID+"/output" || details.Links["profile"] == "" {
+		t.Errorf("Unexpected links: %v", details.Links)
+	}
+
+	req = httptest.NewRequest("GET", details.Links["output"], nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the output, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "status.csv_processed.csv") {
+		t.Errorf("Unexpected Content-Disposition: %s", w.Header().Get("Content-Disposition"))
+	}
+	if !strings.Contains(w.Body.String(), "john@test.com,true") {
+		t.Errorf("Unexpected output: %s", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/API/jobs/invalid-id", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestGetFailedJob(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	jobID := uploadTestFile(t, router, "broken.csv", "name,email\nJohn,\"unterminated\n", nil)
+
+	time.Sleep(2 * time.Second)
+
+	req := httptest.NewRequest("GET", "/API/jobs/"+jobID, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var details models.JobDetails
+	json.Unmarshal(w.Body.Bytes(), &details)
+	if details.Status != models.JobStatusFailed || details.Failure == nil {
+		t.Fatalf("Expected a failed job with a failure, got %+v", details)
+	}
+	if details.Failure.Code != models.FailureMalformedRecord || details.Failure.Line != 2 || details.Failure.Message == "" {
+		t.Errorf("Expected MALFORMED_RECORD on line 2, got %+v", details.Failure)
+	}
+	if _, ok := details.Links["output"]; ok {
+		t.Error("A failed job should not link to an output")
+	}
+
+	req = httptest.NewRequest("GET", "/API/jobs/"+jobID+"/output", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for the output of a failed job, got %d", w.Code)
+	}
+}
+
+// waitForJob polls the job resource until the job leaves IN_PROGRESS.
+func waitForJob(t *testing.T, router *gin.Engine, jobID string) models.JobDetails {
+	t.Helper()
+	var details models.JobDetails
+	for attempt := 0; attempt < 50; attempt++ {
+		req := httptest.NewRequest("GET", "/API/jobs/"+jobID, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		details = models.JobDetails{}
+		json.Unmarshal(w.Body.Bytes(), &details)
+		if details.Status != models.JobStatusInProgress {
+			return details
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", jobID)
+	return details
+}
+
+func TestJobFailureCodes(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	// A header that cannot be parsed
+	jobID := uploadTestFile(t, router, "header.csv", "# report\n\"name,email\n", map[string]string{"skip_lines": "1"})
+	details := waitForJob(t, router, jobID)
+	if details.Failure == nil || details.Failure.Code != models.FailureHeaderReadFailed || details.Failure.Line != 2 {
+		t.Errorf("Expected HEADER_READ_FAILED on line 2, got %+v", details.Failure)
+	}
+
+	// The legacy download reports the failure too
+	req := httptest.NewRequest("GET", "/API/download/"+jobID, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), models.FailureHeaderReadFailed) {
+		t.Errorf("Expected the failure in the download response, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Running out of error budget in tolerant mode
+	jobID = uploadTestFile(t, router, "budget.csv", "name,email\nJohn,x,y\nJane,x,y\n",
+		map[string]string{"error_mode": "tolerant", "max_errors": "1"})
+	details = waitForJob(t, router, jobID)
+	if details.Failure == nil || details.Failure.Code != models.FailureMalformedRecord || details.Failure.Line != 3 {
+		t.Errorf("Expected MALFORMED_RECORD on line 3, got %+v", details.Failure)
+	}
+
+	// Exceeding JOB_TIMEOUT
+	previous := services.JobTimeout
+	services.JobTimeout = time.Nanosecond
+	jobID = uploadTestFile(t, router, "slow.csv", "name,email\nJohn,john@test.com\n", nil)
+	services.JobTimeout = previous
+	details = waitForJob(t, router, jobID)
+	if details.Failure == nil || details.Failure.Code != models.FailureTimeout {
+		t.Errorf("Expected TIMEOUT, got %+v", details.Failure)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var csvContent strings.Builder
+	csvContent.WriteString("name,company\n")
+	for i := 0; i < 100000; i++ {
+		csvContent.WriteString("John Smith,Acme Corporation\n")
+	}
+	jobID := uploadTestFile(t, router, "large.csv", csvContent.String(), nil)
+
+	req := httptest.NewRequest("POST", "/API/jobs/"+jobID+"/cancel", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	details := waitForJob(t, router, jobID)
+	if details.Status != models.JobStatusFailed || details.Failure == nil || details.Failure.Code != models.FailureCancelled {
+		t.Errorf("Expected a CANCELLED failure, got %s %+v", details.Status, details.Failure)
+	}
+
+	// Finished and unknown jobs cannot be cancelled
+	req = httptest.NewRequest("POST", "/API/jobs/"+jobID+"/cancel", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a finished job, got %d", w.Code)
+	}
+	req = httptest.NewRequest("POST", "/API/jobs/invalid-id/cancel", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestRerunJob(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\nJohn Smith,john@example.com\nJane Doe,jane@example.com\n"
+	originalID := uploadTestFile(t, router, "rerun.csv", csvContent, nil)
+	original := waitForJob(t, router, originalID)
+	if original.Input == nil || original.Links["rerun"] == "" {
+		t.Fatalf("Expected the upload to be retained, got %+v", original)
+	}
+
+	body := strings.NewReader(`{"output_format":"ndjson","tags":["rerun"]}`)
+	req := httptest.NewRequest("POST", "/API/jobs/"+originalID+"/rerun", body)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var response models.UploadResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	rerun := waitForJob(t, router, response.ID)
+	if rerun.Status != models.JobStatusCompleted {
+		t.Fatalf("Expected the rerun to complete, got %s", rerun.Status)
+	}
+	if rerun.RerunOf != originalID || rerun.Links["rerunOf"] != "/API/jobs/"+originalID {
+		t.Errorf("Expected the rerun to point at %s, got %q", originalID, rerun.RerunOf)
+	}
+	if rerun.Options.OutputFormat != services.OutputFormatNDJSON || len(rerun.Options.Tags) != 1 {
+		t.Errorf("Expected the new options to apply, got %+v", rerun.Options)
+	}
+
+	req = httptest.NewRequest("GET", "/API/jobs/"+response.ID+"/output", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"john@example.com"`) {
+		t.Errorf("Expected NDJSON output of the original upload, got %d: %s", w.Code, w.Body.String())
+	}
+
+	original = waitForJob(t, router, originalID)
+	if len(original.Reruns) != 1 || original.Reruns[0] != response.ID {
+		t.Errorf("Expected the original to list its rerun, got %v", original.Reruns)
+	}
+
+	req = httptest.NewRequest("POST", "/API/jobs/invalid-id/rerun", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestRerunExpiredInput(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	retention := services.UploadRetention
+	services.UploadRetention = time.Millisecond
+	defer func() { services.UploadRetention = retention }()
+
+	jobID := uploadTestFile(t, router, "expired.csv", "name,email\nJohn Smith,john@example.com\n", nil)
+	waitForJob(t, router, jobID)
+	if removed := handler.csvService.ExpireRetainedInputs(); removed != 1 {
+		t.Fatalf("Expected 1 expired upload, got %d", removed)
+	}
+
+	details := waitForJob(t, router, jobID)
+	if details.Input != nil || details.Links["rerun"] != "" {
+		t.Errorf("Expected no retained input after expiry, got %+v", details.Input)
+	}
+
+	req := httptest.NewRequest("POST", "/API/jobs/"+jobID+"/rerun", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected status 410, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PreviewFile processes the first rows of an upload synchronously and returns
+// them with the detected dialect. No job or output file is created.
+func (handler *CsvProcessorHandler) PreviewFile(ctx *gin.Context) {
+	startTime := time.Now()
+	clientIP := ctx.ClientIP()
+
+	log.Printf("[PREVIEW] Starting preview request from IP: %s", clientIP)
+
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		log.Printf("[PREVIEW] [ERROR] No file provided in request from IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "No file provided",
+		})
+		return
+	}
+
+	rows := services.DefaultPreviewRows
+	if value := ctx.PostForm("rows"); value != "" {
+		rows, err = strconv.Atoi(value)
+		if err != nil {
+			log.Printf("[PREVIEW] [ERROR] Invalid rows from IP: %s, Value: %q", clientIP, value)
+			ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+				Error: "Invalid rows value",
+			})
+			return
+		}
+	}
+
+	var options models.ProcessingOptions
+	if err := ctx.ShouldBind(&options); err != nil {
+		log.Printf("[PREVIEW] [ERROR] Invalid processing options from IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid processing options",
+		})
+		return
+	}
+	options.Tenant = principalTenant(ctx)
+
+	preview, err := handler.csvService.Preview(fileHeader, options, rows)
+	if err != nil {
+		log.Printf("[PREVIEW] [ERROR] Preview failed - File: %s, IP: %s, Error: %v",
+			fileHeader.Filename, clientIP, err)
+		if respondQuotaError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("[PREVIEW] [SUCCESS] Preview returned - File: %s, Rows: %d, Duration: %v, IP: %s",
+		fileHeader.Filename, len(preview.Rows), time.Since(startTime), clientIP)
+
+	ctx.JSON(http.StatusOK, preview)
+}
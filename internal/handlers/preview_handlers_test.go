@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"demandscience/internal/models"
+)
+
+func postPreview(router http.Handler, filename, content string, fields map[string]string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write([]byte(content))
+	for key, value := range fields {
+		writer.WriteField(key, value)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/API/preview", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPreview(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	csvContent := "id,name,contact\r\n1,John,john@test.com\r\n2,Jane,invalid-email\r\n3,Bob,bob@test.com\r\n"
+	w := postPreview(router, "preview.csv", csvContent, map[string]string{"rows": "2"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var preview models.PreviewResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("Failed to parse preview: %v", err)
+	}
+
+	if len(preview.Rows) != 2 || !preview.Truncated {
+		t.Errorf("Expected 2 truncated rows, got %d (truncated: %v)", len(preview.Rows), preview.Truncated)
+	}
+	if len(preview.Headers) != 4 || preview.Headers[3] != "has_email" {
+		t.Errorf("Unexpected headers: %v", preview.Headers)
+	}
+	if preview.Rows[0][3] != "true" || preview.Rows[1][3] != "false" {
+		t.Errorf("Unexpected processed rows: %v", preview.Rows)
+	}
+	if preview.EmailColumn != "contact" {
+		t.Errorf("Expected email column contact, got %q", preview.EmailColumn)
+	}
+	if preview.Dialect.Delimiter != "," || preview.Dialect.LineTerminator != "\r\n" || preview.Dialect.Encoding != "utf-8" {
+		t.Errorf("Unexpected dialect: %+v", preview.Dialect)
+	}
+
+	// The preview is not a job
+	if handler.csvService.GetJob("preview") != nil {
+		t.Error("Preview should not register a job")
+	}
+}
+
+func TestPreviewReportsDialectAndRowErrors(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	w := postPreview(router, "semicolon.csv", "name;email\nJohn;john@test.com\nJane;jane@test.com\n", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var preview models.PreviewResponse
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	// Jobs split on commas unless told otherwise, and the preview shows it
+	if preview.Dialect.Delimiter != ";" || preview.Dialect.JobDelimiter != "," || len(preview.Headers) != 2 || len(preview.Warnings) == 0 {
+		t.Errorf("Expected a detected semicolon, comma-split rows and a warning, got %+v, %v, %v",
+			preview.Dialect, preview.Headers, preview.Warnings)
+	}
+
+	w = postPreview(router, "semicolon.csv", "name;email\nJohn;john@test.com\n", map[string]string{"delimiter": "auto"})
+	preview = models.PreviewResponse{}
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	if preview.Dialect.JobDelimiter != ";" || len(preview.Headers) != 3 || preview.EmailColumn != "email" || len(preview.Warnings) != 0 {
+		t.Errorf("Expected rows split on the detected semicolon, got %+v, %v, %v", preview.Dialect, preview.Headers, preview.Warnings)
+	}
+	if preview.Truncated {
+		t.Error("A fully previewed file should not be truncated")
+	}
+
+	w = postPreview(router, "broken.csv", "name,email\nJohn,\"john@test.com\nJane,jane@test.com\n",
+		map[string]string{"error_mode": "tolerant"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	preview = models.PreviewResponse{}
+	json.Unmarshal(w.Body.Bytes(), &preview)
+	if len(preview.RowErrors) == 0 {
+		t.Errorf("Expected row errors for a malformed file, got %+v", preview)
+	}
+
+	for _, rows := range []string{"0", "abc", "100000"} {
+		w = postPreview(router, "test.csv", "name,email\nJohn,john@test.com\n", map[string]string{"rows": rows})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for rows=%s, got %d", rows, w.Code)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func postUpload(router *gin.Engine, path string, files map[string]string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	field := "file"
+	if path == "/API/uploads" {
+		field = "files"
+	}
+	for filename, content := range files {
+		part, _ := writer.CreateFormFile(field, filename)
+		part.Write([]byte(content))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest("POST", path, &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func getUsage(t *testing.T, router *gin.Engine) models.UsageResponse {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/API/usage", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for the usage, got %d: %s", w.Code, w.Body.String())
+	}
+	var usage models.UsageResponse
+	json.Unmarshal(w.Body.Bytes(), &usage)
+	return usage
+}
+
+func expectQuotaError(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var response models.UploadResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if w.Code != status || response.Code != code {
+		t.Errorf("Expected status %d with code %s, got %d: %s", status, code, w.Code, w.Body.String())
+	}
+}
+
+// todayUsage returns the usage of the current UTC day, which is zero before
+// the tenant used anything today.
+func todayUsage(usage models.UsageResponse) models.DailyUsage {
+	date := time.Now().UTC().Format("2006-01-02")
+	if len(usage.Days) > 0 && usage.Days[0].Date == date {
+		return usage.Days[0]
+	}
+	return models.DailyUsage{Date: date}
+}
+
+// waitForUsage polls the usage until no job of the tenant is running.
+func waitForUsage(t *testing.T, router *gin.Engine) models.UsageResponse {
+	t.Helper()
+	var usage models.UsageResponse
+	for attempt := 0; attempt < 50; attempt++ {
+		if usage = getUsage(t, router); usage.RunningJobs == 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return usage
+}
+
+func TestUploadQuotas(t *testing.T) {
+	router, handler := setupTestRouter()
+	contacts := "name,email\nJohn,john@example.com\n"
+	before := todayUsage(getUsage(t, router))
+
+	handler.csvService.SetTenantQuota("", models.TenantQuota{MaxFileSize: 10})
+	w := postUpload(router, "/API/upload", map[string]string{"contacts.csv": contacts})
+	expectQuotaError(t, w, http.StatusRequestEntityTooLarge, models.ErrorCodeFileTooLarge)
+
+	handler.csvService.SetTenantQuota("", models.TenantQuota{MaxBytesStored: 10})
+	w = postUpload(router, "/API/upload", map[string]string{"contacts.csv": contacts})
+	expectQuotaError(t, w, http.StatusRequestEntityTooLarge, models.ErrorCodeStorageQuotaExceeded)
+
+	// A batch needs a slot for each of its jobs
+	handler.csvService.SetTenantQuota("", models.TenantQuota{MaxConcurrentJobs: 1})
+	w = postUpload(router, "/API/uploads", map[string]string{"a.csv": contacts, "b.csv": contacts})
+	expectQuotaError(t, w, http.StatusTooManyRequests, models.ErrorCodeConcurrentJobsLimit)
+
+	// Refused uploads use no quota
+	usage := getUsage(t, router)
+	if after := todayUsage(usage); usage.RunningJobs != 0 || after.Jobs != before.Jobs || after.BytesIn != before.BytesIn {
+		t.Errorf("Expected refused uploads to leave no usage, got %+v", usage)
+	}
+}
+
+func TestDailyRowLimit(t *testing.T) {
+	router, handler := setupTestRouter()
+	contacts := "name,email\nJohn,john@example.com\nJane,jane@example.com\n"
+	// Usage is kept across restarts, so the limit is set above what earlier
+	// services recorded today
+	before := todayUsage(getUsage(t, router))
+	handler.csvService.SetTenantQuota("*", models.TenantQuota{MaxRowsPerDay: before.RowsProcessed + 3})
+
+	jobID := uploadTestFile(t, router, "contacts.csv", contacts, nil)
+	waitForJob(t, router, jobID)
+
+	usage := waitForUsage(t, router)
+	if usage.Quota.MaxRowsPerDay != before.RowsProcessed+3 {
+		t.Fatalf("Expected the default quota, got %+v", usage.Quota)
+	}
+	today := todayUsage(usage)
+	if today.Jobs != before.Jobs+1 || today.RowsProcessed != before.RowsProcessed+2 || today.BytesIn != before.BytesIn+int64(len(contacts)) || today.BytesOut <= before.BytesOut {
+		t.Errorf("Unexpected usage for today: %+v, before: %+v", today, before)
+	}
+	if usage.BytesStored == 0 {
+		t.Error("Expected the output to count towards the stored bytes")
+	}
+
+	// A job that reaches the limit stops there and is charged what it read.
+	// Identical uploads are served from the cache without reading rows.
+	contacts = "name,email\nAda,ada@example.com\nAlan,alan@example.com\n"
+	jobID = uploadTestFile(t, router, "contacts.csv", contacts, nil)
+	details := waitForJob(t, router, jobID)
+	if details.Status != models.JobStatusFailed || details.Failure == nil || details.Failure.Code != models.FailureDailyRowLimit {
+		t.Errorf("Expected the job to fail with %s, got %s: %+v", models.FailureDailyRowLimit, details.Status, details.Failure)
+	}
+	if today := todayUsage(waitForUsage(t, router)); today.RowsProcessed != before.RowsProcessed+3 {
+		t.Errorf("Expected the failed job to be charged its row, got %d rows after %d", today.RowsProcessed, before.RowsProcessed)
+	}
+
+	w := postUpload(router, "/API/upload", map[string]string{"contacts.csv": contacts})
+	expectQuotaError(t, w, http.StatusTooManyRequests, models.ErrorCodeDailyRowLimit)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter <= 0 || retryAfter > 24*60*60 {
+		t.Errorf("Expected Retry-After until UTC midnight, got %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestUsageSurvivesRestart(t *testing.T) {
+	router, handler := setupTestRouter()
+	jobID := uploadTestFile(t, router, "contacts.csv", "name,email\nJohn,john@example.com\n", nil)
+	waitForJob(t, router, jobID)
+	usage := waitForUsage(t, router)
+
+	if err := handler.csvService.SaveUsage(); err != nil {
+		t.Fatalf("Failed to save usage: %v", err)
+	}
+	restarted, err := services.DSCsvProcessingService().GetUsage("", 1)
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	if restarted.BytesStored != usage.BytesStored || todayUsage(*restarted).RowsProcessed != todayUsage(usage).RowsProcessed {
+		t.Errorf("Expected the usage to be loaded after a restart, got %+v, want %+v", restarted, usage)
+	}
+}
+
+func TestUsageValidation(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	for _, days := range []string{"0", "32", "week"} {
+		req := httptest.NewRequest("GET", "/API/usage?days="+days, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for days=%s, got %d", days, w.Code)
+		}
+	}
+}
+
+func TestUsageOfAnotherTenant(t *testing.T) {
+	router, keyService, _ := setupAuthRouter(t)
+	operator := createTestKey(t, keyService, "operator", "operator")
+	acmeAdmin := createTenantKey(t, keyService, "acme-ops", "acme", "admin")
+
+	w := authRequest(router, "GET", "/API/usage?tenant=acme", operator.Key, nil, "")
+	var usage models.UsageResponse
+	json.Unmarshal(w.Body.Bytes(), &usage)
+	if w.Code != http.StatusOK || usage.Tenant != "acme" {
+		t.Errorf("Expected the operator to see the usage of acme, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := authRequest(router, "GET", "/API/usage?tenant=globex", acmeAdmin.Key, nil, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for the usage of another tenant, got %d", w.Code)
+	}
+	if w := authRequest(router, "GET", "/API/usage", acmeAdmin.Key, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected a tenant admin to see their own usage, got %d", w.Code)
+	}
+}
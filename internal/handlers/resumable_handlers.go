@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tusVersion             = "1.0.0"
+	tusChunkContentType    = "application/offset+octet-stream"
+	resumableUploadsPrefix = "/API/resumable/"
+)
+
+// CreateResumableUpload starts a tus-style upload. The total size comes from
+// Upload-Length and the file name and processing options from Upload-Metadata.
+func (handler *CsvProcessorHandler) CreateResumableUpload(ctx *gin.Context) {
+	clientIP := ctx.ClientIP()
+	ctx.Header("Tus-Resumable", tusVersion)
+
+	log.Printf("[RESUMABLE_CREATE] Starting resumable upload request from IP: %s", clientIP)
+
+	length, err := strconv.ParseInt(ctx.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		log.Printf("[RESUMABLE_CREATE] [ERROR] Invalid Upload-Length from IP: %s, Value: %q", clientIP, ctx.GetHeader("Upload-Length"))
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid Upload-Length header",
+		})
+		return
+	}
+
+	metadata, err := parseUploadMetadata(ctx.GetHeader("Upload-Metadata"))
+	if err != nil || metadata["filename"] == "" {
+		log.Printf("[RESUMABLE_CREATE] [ERROR] Missing filename metadata from IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Upload-Metadata must include a filename",
+		})
+		return
+	}
+
+	options, err := optionsFromMetadata(metadata)
+	if err != nil {
+		log.Printf("[RESUMABLE_CREATE] [ERROR] Invalid processing options from IP: %s, Error: %v", clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+	options.CreatedBy = principalID(ctx)
+	options.Tenant = principalTenant(ctx)
+
+	upload, err := handler.csvService.CreateResumableUpload(metadata["filename"], length, options)
+	if err != nil {
+		log.Printf("[RESUMABLE_CREATE] [ERROR] Failed to create upload - File: %s, IP: %s, Error: %v",
+			metadata["filename"], clientIP, err)
+		status, code := http.StatusBadRequest, ""
+		if errors.Is(err, services.ErrUploadTooLarge) {
+			status, code = http.StatusRequestEntityTooLarge, models.ErrorCodeFileTooLarge
+		}
+		ctx.JSON(status, models.UploadResponse{
+			Error: err.Error(),
+			Code:  code,
+		})
+		return
+	}
+
+	log.Printf("[RESUMABLE_CREATE] [SUCCESS] Resumable upload created - UploadID: %s, File: %s, Length: %d bytes, IP: %s",
+		upload.ID, upload.FileName, upload.Length, clientIP)
+
+	setUploadHeaders(ctx, upload)
+	ctx.Header("Location", resumableUploadsPrefix+upload.ID)
+	ctx.JSON(http.StatusCreated, upload)
+}
+
+// ResumableUploadOffset answers HEAD requests with the number of bytes received so far.
+func (handler *CsvProcessorHandler) ResumableUploadOffset(ctx *gin.Context) {
+	uploadID := ctx.Param("id")
+	ctx.Header("Tus-Resumable", tusVersion)
+
+	upload := handler.csvService.GetResumableUpload(uploadID)
+	if upload == nil || !inTenant(ctx, upload.Options.Tenant) {
+		log.Printf("[RESUMABLE_HEAD] [ERROR] Upload not found - UploadID: %s", uploadID)
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[RESUMABLE_HEAD] Upload offset returned - UploadID: %s, Offset: %d/%d", uploadID, upload.Offset, upload.Length)
+	setUploadHeaders(ctx, upload)
+	ctx.Status(http.StatusOK)
+}
+
+// ResumableUploadStatus returns the upload state as JSON, including the job
+// IDs once the upload is complete.
+func (handler *CsvProcessorHandler) ResumableUploadStatus(ctx *gin.Context) {
+	uploadID := ctx.Param("id")
+
+	upload := handler.csvService.GetResumableUpload(uploadID)
+	if upload == nil || !inTenant(ctx, upload.Options.Tenant) {
+		log.Printf("[RESUMABLE_STATUS] [ERROR] Upload not found - UploadID: %s", uploadID)
+		ctx.JSON(http.StatusNotFound, models.UploadResponse{
+			Error: "Invalid upload ID",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, upload)
+}
+
+// PatchResumableUpload appends the request body at Upload-Offset.
+func (handler *CsvProcessorHandler) PatchResumableUpload(ctx *gin.Context) {
+	startTime := time.Now()
+	clientIP := ctx.ClientIP()
+	uploadID := ctx.Param("id")
+	ctx.Header("Tus-Resumable", tusVersion)
+
+	if ctx.ContentType() != tusChunkContentType {
+		log.Printf("[RESUMABLE_PATCH] [ERROR] Unsupported content type - UploadID: %s, ContentType: %s", uploadID, ctx.ContentType())
+		ctx.JSON(http.StatusUnsupportedMediaType, models.UploadResponse{
+			Error: "Content-Type must be " + tusChunkContentType,
+		})
+		return
+	}
+
+	offset, err := strconv.ParseInt(ctx.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		log.Printf("[RESUMABLE_PATCH] [ERROR] Invalid Upload-Offset - UploadID: %s, Value: %q", uploadID, ctx.GetHeader("Upload-Offset"))
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: "Invalid Upload-Offset header",
+		})
+		return
+	}
+
+	if upload := handler.csvService.GetResumableUpload(uploadID); upload != nil && !inTenant(ctx, upload.Options.Tenant) {
+		log.Printf("[RESUMABLE_PATCH] [ERROR] Upload of another tenant - UploadID: %s, IP: %s", uploadID, clientIP)
+		ctx.JSON(http.StatusNotFound, models.UploadResponse{
+			Error: services.ErrUploadNotFound.Error(),
+		})
+		return
+	}
+
+	upload, err := handler.csvService.WriteResumableChunk(uploadID, offset, ctx.Request.Body, ctx.Request.ContentLength)
+	if upload != nil {
+		setUploadHeaders(ctx, upload)
+	}
+	if err != nil {
+		log.Printf("[RESUMABLE_PATCH] [ERROR] Chunk rejected - UploadID: %s, Offset: %d, IP: %s, Error: %v",
+			uploadID, offset, clientIP, err)
+		if respondQuotaError(ctx, err) {
+			return
+		}
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, services.ErrUploadNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrUploadOffsetMismatch):
+			status = http.StatusConflict
+		case errors.Is(err, services.ErrUploadExceedsLength):
+			status = http.StatusRequestEntityTooLarge
+		}
+		ctx.JSON(status, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	log.Printf("[RESUMABLE_PATCH] [SUCCESS] Chunk accepted - UploadID: %s, Offset: %d/%d, Duration: %v, IP: %s",
+		uploadID, upload.Offset, upload.Length, time.Since(startTime), clientIP)
+	ctx.Status(http.StatusNoContent)
+}
+
+// DeleteResumableUpload terminates an upload and discards the bytes received.
+func (handler *CsvProcessorHandler) DeleteResumableUpload(ctx *gin.Context) {
+	uploadID := ctx.Param("id")
+	ctx.Header("Tus-Resumable", tusVersion)
+
+	err := services.ErrUploadNotFound
+	if upload := handler.csvService.GetResumableUpload(uploadID); upload == nil || inTenant(ctx, upload.Options.Tenant) {
+		err = handler.csvService.DeleteResumableUpload(uploadID)
+	}
+	if err != nil {
+		log.Printf("[RESUMABLE_DELETE] [ERROR] Failed to delete upload - UploadID: %s, Error: %v", uploadID, err)
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, services.ErrUploadNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, services.ErrUploadProcessing):
+			status = http.StatusConflict
+		}
+		ctx.JSON(status, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+func setUploadHeaders(ctx *gin.Context, upload *models.ResumableUpload) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	ctx.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	ctx.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if len(upload.JobIDs) > 0 {
+		ctx.Header("Upload-Job-Id", strings.Join(upload.JobIDs, ","))
+	}
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma separated
+// pairs of a key and a base64 value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 0:
+			continue
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, errors.New("invalid Upload-Metadata value for " + fields[0])
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, errors.New("invalid Upload-Metadata pair: " + strings.TrimSpace(pair))
+		}
+	}
+	return metadata, nil
+}
+
+// optionsFromMetadata reads processing options from Upload-Metadata keys named
+// like the multipart form fields.
+func optionsFromMetadata(metadata map[string]string) (models.ProcessingOptions, error) {
+	options := models.ProcessingOptions{
+		Encoding:     metadata["encoding"],
+		ZipMode:      metadata["zip_mode"],
+		OutputFormat: metadata["output_format"],
+		Sheet:        metadata["sheet"],
+		ErrorMode:    metadata["error_mode"],
+		Delimiter:    metadata["delimiter"],
+		Comment:      metadata["comment"],
+		Dedupe:       metadata["dedupe"],
+	}
+	if tags := metadata["tags"]; tags != "" {
+		options.Tags = []string{tags}
+	}
+
+	integers := map[string]*int{
+		"max_errors": &options.MaxErrors,
+		"skip_lines": &options.SkipLines,
+	}
+	for key, target := range integers {
+		if value := metadata[key]; value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return options, errors.New("invalid " + key + " metadata")
+			}
+			*target = parsed
+		}
+	}
+
+	booleans := map[string]*bool{
+		"lazy_quotes":        &options.LazyQuotes,
+		"variable_fields":    &options.VariableFields,
+		"trim_leading_space": &options.TrimLeadingSpace,
+	}
+	for key, target := range booleans {
+		if value := metadata[key]; value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return options, errors.New("invalid " + key + " metadata")
+			}
+			*target = parsed
+		}
+	}
+
+	return options, nil
+}
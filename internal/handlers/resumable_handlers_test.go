@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+)
+
+func createResumableUpload(t *testing.T, router http.Handler, filename string, length int) string {
+	req := httptest.NewRequest("POST", "/API/resumable", nil)
+	req.Header.Set("Upload-Length", strconv.Itoa(length))
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(filename)))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/API/resumable/") {
+		t.Fatalf("Expected a Location header, got %q", location)
+	}
+	return location
+}
+
+func patchResumableUpload(router http.Handler, location string, offset int, chunk string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PATCH", location, strings.NewReader(chunk))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestResumableUpload(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	csvContent := "name,email\nJohn,john@test.com\nJane,invalid-email\n"
+	location := createResumableUpload(t, router, "chunked.csv", len(csvContent))
+	split := 15
+
+	w := patchResumableUpload(router, location, 0, csvContent[:split])
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != strconv.Itoa(split) {
+		t.Fatalf("Expected 204 with offset %d, got %d offset %q", split, w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// HEAD reports the offset to resume from
+	req := httptest.NewRequest("HEAD", location, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(split) {
+		t.Fatalf("Expected HEAD offset %d, got %d offset %q", split, w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// A chunk at the wrong offset is rejected
+	w = patchResumableUpload(router, location, 0, csvContent)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for offset mismatch, got %d", w.Code)
+	}
+
+	w = patchResumableUpload(router, location, split, csvContent[split:])
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	jobID := w.Header().Get("Upload-Job-Id")
+	if jobID == "" {
+		t.Fatal("Expected Upload-Job-Id once the upload is complete")
+	}
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	req = httptest.NewRequest("GET", "/API/download/"+jobID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var download map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &download)
+	fileData, _ := base64.StdEncoding.DecodeString(download["file_data"].(string))
+
+	expected := "name,email,has_email\nJohn,john@test.com,true\nJane,invalid-email,false\n"
+	if string(fileData) != expected {
+		t.Errorf("Expected processed content %q, got %q", expected, string(fileData))
+	}
+}
+
+func TestResumableUploadValidation(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	req := httptest.NewRequest("POST", "/API/resumable", nil)
+	req.Header.Set("Upload-Length", "10")
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("notes.txt")))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unsupported file type, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/API/resumable", nil)
+	req.Header.Set("Upload-Length", strconv.Itoa(services.MaxFileSize+1))
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("big.csv")))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for oversized upload, got %d", w.Code)
+	}
+
+	location := createResumableUpload(t, router, "short.csv", 5)
+	w = patchResumableUpload(router, location, 0, "name,email\n")
+	if w.Code != http.StatusRequestEntityTooLarge || w.Header().Get("Upload-Offset") != "0" {
+		t.Errorf("Expected status 413 at offset 0 for chunk past upload length, got %d at %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+}
+
+func TestResumableUploadChunkOfUnknownLength(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	content := "name\nAda\n"
+	location := createResumableUpload(t, router, "unknown.csv", len(content))
+	req := httptest.NewRequest("PATCH", location, strings.NewReader(content+"Alan\n"))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", "0")
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge || w.Header().Get("Upload-Offset") != "0" {
+		t.Fatalf("Expected status 413 at offset 0 for a body past upload length, got %d at %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	// The discarded chunk can be sent again with the right length
+	w = patchResumableUpload(router, location, 0, content)
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Job-Id") == "" {
+		t.Fatalf("Expected the upload to complete and start a job, got %d: %s", w.Code, w.Body.String())
+	}
+	if details := waitForJob(t, router, w.Header().Get("Upload-Job-Id")); details.Status != models.JobStatusCompleted {
+		t.Errorf("Expected the job to complete, got %s", details.Status)
+	}
+}
+
+func TestResumableUploadExpiry(t *testing.T) {
+	router, handler := setupTestRouter()
+
+	defaultExpiry := services.ResumableUploadExpiry
+	services.ResumableUploadExpiry = 10 * time.Millisecond
+	defer func() { services.ResumableUploadExpiry = defaultExpiry }()
+
+	location := createResumableUpload(t, router, "abandoned.csv", 100)
+	time.Sleep(20 * time.Millisecond)
+
+	if removed := handler.csvService.ExpireResumableUploads(); removed == 0 {
+		t.Error("Expected the abandoned upload to be removed")
+	}
+
+	req := httptest.NewRequest("HEAD", location, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for expired upload, got %d", w.Code)
+	}
+}
+
+func TestResumableUploadDeleteWhileProcessing(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	var csvContent strings.Builder
+	csvContent.WriteString("name,email\n")
+	for i := 0; i < 20000; i++ {
+		csvContent.WriteString("User " + strconv.Itoa(i) + ",user" + strconv.Itoa(i) + "@test.com\n")
+	}
+	location := createResumableUpload(t, router, "busy.csv", csvContent.Len())
+
+	w := patchResumableUpload(router, location, 0, csvContent.String())
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	jobID := w.Header().Get("Upload-Job-Id")
+
+	// The job still reads the file, so it cannot be deleted yet
+	req := httptest.NewRequest("DELETE", location, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 while the job is running, got %d", w.Code)
+	}
+
+	// Retry until the job finishes; slow builds (e.g. -race) take a while
+	deadline := time.Now().Add(time.Minute)
+	for w.Code == http.StatusConflict && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		req = httptest.NewRequest("DELETE", location, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	}
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 once the job finished, got %d: %s", w.Code, w.Body.String())
+	}
+	if details := waitForJob(t, router, jobID); details.Status != models.JobStatusCompleted {
+		t.Errorf("Expected the job to complete, got %s", details.Status)
+	}
+}
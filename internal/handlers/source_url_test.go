@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"demandscience/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func postSourceURL(router http.Handler, sourceURL string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"source_url": sourceURL})
+	req := httptest.NewRequest("POST", "/API/upload", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// setupLoopbackRouter returns a test router whose source_url downloads may
+// reach httptest servers.
+func setupLoopbackRouter(t *testing.T) *gin.Engine {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	defaultNetworks := services.SourceURLAllowedNetworks
+	services.SourceURLAllowedNetworks = []*net.IPNet{loopback}
+	router, handler := setupTestRouter()
+	services.SourceURLAllowedNetworks = defaultNetworks
+	t.Cleanup(handler.csvService.CloseIdleConnections)
+	return router
+}
+
+func TestSourceURLUpload(t *testing.T) {
+	router := setupLoopbackRouter(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Write([]byte("name,email\nJohn,john@test.com\n"))
+	}))
+	defer server.Close()
+
+	w := postSourceURL(router, server.URL+"/exports/contacts.csv")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response map[string]string
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	// Wait for processing
+	time.Sleep(2 * time.Second)
+
+	req := httptest.NewRequest("GET", "/API/download/"+response["id"], nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var download map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &download)
+	if download["filename"] != "contacts.csv" {
+		t.Errorf("Expected filename taken from the URL, got %v", download["filename"])
+	}
+	fileData, _ := base64.StdEncoding.DecodeString(download["file_data"].(string))
+	if string(fileData) != "name,email,has_email\nJohn,john@test.com,true\n" {
+		t.Errorf("Unexpected processed content: %q", string(fileData))
+	}
+}
+
+func TestSourceURLBlocksPrivateAddresses(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Blocked source_url should not be requested")
+	}))
+	defer server.Close()
+
+	w := postSourceURL(router, server.URL+"/data.csv")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for loopback source_url, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = postSourceURL(router, "ftp://example.com/data.csv")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unsupported scheme, got %d", w.Code)
+	}
+}
+
+func TestSourceURLLimits(t *testing.T) {
+	router := setupLoopbackRouter(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large.csv":
+			// Streamed without Content-Length, so only the bytes read can be checked
+			w.Header().Set("Content-Type", "text/csv")
+			chunk := strings.Repeat("a", 64*1024)
+			for written := 0; written <= services.MaxFileSize; written += len(chunk) {
+				w.Write([]byte(chunk))
+				w.(http.Flusher).Flush()
+			}
+		case "/error.csv":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>Not here</html>"))
+		}
+	}))
+	defer server.Close()
+
+	w := postSourceURL(router, server.URL+"/large.csv")
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for oversized source, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = postSourceURL(router, server.URL+"/error.csv")
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415 for HTML response, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSourceURLFileScheme(t *testing.T) {
+	router, _ := setupTestRouter()
+
+	allowedDir := t.TempDir()
+	otherDir := t.TempDir()
+	os.WriteFile(filepath.Join(allowedDir, "drop.csv"), []byte("name,email\nJane,jane@test.com\n"), 0644)
+	os.WriteFile(filepath.Join(otherDir, "secret.csv"), []byte("name,email\n"), 0644)
+
+	defaultDirs := services.SourceURLAllowedDirs
+	services.SourceURLAllowedDirs = []string{allowedDir}
+	defer func() { services.SourceURLAllowedDirs = defaultDirs }()
+
+	w := postSourceURL(router, "file://"+filepath.Join(allowedDir, "drop.csv"))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for allowed file, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = postSourceURL(router, "file://"+filepath.Join(allowedDir, "..", filepath.Base(otherDir), "secret.csv"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for file outside allowed directories, got %d", w.Code)
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func createTenantKey(t *testing.T, keyService *services.APIKeyService, name, tenant string, scopes ...string) *models.CreateAPIKeyResponse {
+	t.Helper()
+	created, err := keyService.Create(name, scopes, tenant)
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	return created
+}
+
+func TestJobsAreIsolatedByTenant(t *testing.T) {
+	router, keyService, _ := setupAuthRouter(t)
+	acme := createTenantKey(t, keyService, "acme-ci", "acme", "upload", "read")
+	acmeAdmin := createTenantKey(t, keyService, "acme-ops", "acme", "admin")
+	globexAdmin := createTenantKey(t, keyService, "globex-ops", "globex", "admin")
+
+	w := uploadWithKey(router, acme.Key, "contacts.csv", "name,email\nJohn Smith,john@example.com\n")
+	var response models.UploadResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	var details models.JobDetails
+	for attempt := 0; attempt < 50; attempt++ {
+		w = authRequest(router, "GET", "/API/jobs/"+response.ID, acme.Key, nil, "")
+		json.Unmarshal(w.Body.Bytes(), &details)
+		if details.Status != models.JobStatusInProgress {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if details.Status != models.JobStatusCompleted || details.Tenant != "acme" {
+		t.Fatalf("Expected a completed job of tenant acme, got %s of %q", details.Status, details.Tenant)
+	}
+
+	// The output is stored under the tenant prefix
+	output := filepath.Join("processed_files", "tenants", "acme", response.ID+"_processed.csv")
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("Expected the output under the tenant prefix: %v", err)
+	}
+
+	// Admins of the tenant see the job; even admins of another tenant do not
+	if w := authRequest(router, "GET", "/API/jobs/"+response.ID+"/output", acmeAdmin.Key, nil, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected an admin of the tenant to download the output, got %d", w.Code)
+	}
+	for _, path := range []string{"/API/jobs/" + response.ID, "/API/download/" + response.ID, "/API/jobs/" + response.ID + "/output"} {
+		if w := authRequest(router, "GET", path, globexAdmin.Key, nil, ""); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for another tenant on %s, got %d", path, w.Code)
+		}
+	}
+
+	var listing models.JobListResponse
+	w = authRequest(router, "GET", "/API/jobs", globexAdmin.Key, nil, "")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Jobs) != 0 {
+		t.Errorf("Expected another tenant to list no jobs, got %d", len(listing.Jobs))
+	}
+	w = authRequest(router, "GET", "/API/jobs", acmeAdmin.Key, nil, "")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Jobs) != 1 {
+		t.Errorf("Expected the tenant admin to list the job, got %d", len(listing.Jobs))
+	}
+}
+
+func TestTenantKeyManagement(t *testing.T) {
+	router, keyService, _ := setupAuthRouter(t)
+	operator := createTestKey(t, keyService, "operator", "operator")
+	acmeAdmin := createTenantKey(t, keyService, "acme-ops", "acme", "admin")
+	globex := createTenantKey(t, keyService, "globex-ci", "globex", "upload")
+
+	// Keys default to the tenant of the admin creating them
+	w := authRequest(router, "POST", "/API/keys", acmeAdmin.Key, []byte(`{"name": "ci", "scopes": ["upload"]}`), "application/json")
+	var created models.CreateAPIKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusCreated || created.Tenant != "acme" {
+		t.Errorf("Expected a key of tenant acme, got %d: %s", w.Code, w.Body.String())
+	}
+	w = authRequest(router, "POST", "/API/keys", acmeAdmin.Key, []byte(`{"name": "ci", "scopes": ["upload"], "tenant": "globex"}`), "application/json")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a key of another tenant, got %d", w.Code)
+	}
+	w = authRequest(router, "POST", "/API/keys", operator.Key, []byte(`{"name": "ci", "scopes": ["upload"], "tenant": "../etc"}`), "application/json")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid tenant, got %d", w.Code)
+	}
+
+	var listing struct {
+		Keys []models.APIKey `json:"keys"`
+	}
+	w = authRequest(router, "GET", "/API/keys", acmeAdmin.Key, nil, "")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Keys) != 2 {
+		t.Errorf("Expected the tenant admin to list the 2 acme keys, got %d", len(listing.Keys))
+	}
+	if w := authRequest(router, "DELETE", "/API/keys/"+globex.ID, acmeAdmin.Key, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 deleting a key of another tenant, got %d", w.Code)
+	}
+
+	// Operators manage every tenant
+	w = authRequest(router, "GET", "/API/keys", operator.Key, nil, "")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Keys) != 4 {
+		t.Errorf("Expected the operator to list all 4 keys, got %d", len(listing.Keys))
+	}
+	if w := authRequest(router, "DELETE", "/API/keys/"+globex.ID, operator.Key, nil, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 deleting a key as the operator, got %d", w.Code)
+	}
+}
+
+func TestDefaultTenantAdminIsNotOperator(t *testing.T) {
+	router, keyService, _ := setupAuthRouter(t)
+	admin := createTestKey(t, keyService, "ops", "admin")
+	createTenantKey(t, keyService, "globex-ci", "globex", "upload")
+
+	w := authRequest(router, "POST", "/API/keys", admin.Key, []byte(`{"name": "ci", "scopes": ["admin"], "tenant": "globex"}`), "application/json")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a key of another tenant from an admin of the default tenant, got %d", w.Code)
+	}
+	w = authRequest(router, "POST", "/API/keys", admin.Key, []byte(`{"name": "root", "scopes": ["read,Operator"]}`), "application/json")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for an operator key from an admin, got %d", w.Code)
+	}
+
+	var listing struct {
+		Keys []models.APIKey `json:"keys"`
+	}
+	w = authRequest(router, "GET", "/API/keys", admin.Key, nil, "")
+	json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Keys) != 1 {
+		t.Errorf("Expected an admin of the default tenant to list its own key only, got %d", len(listing.Keys))
+	}
+
+	if _, err := keyService.Create("acme-root", []string{"operator"}, "acme"); err != services.ErrOperatorTenant {
+		t.Errorf("Expected operator keys of a tenant to be refused, got %v", err)
+	}
+}
+
+func TestBearerTokenTenantClaim(t *testing.T) {
+	signer := newTestSigner(t, "key-1")
+	router, keyService := setupTokenRouter(t, signer)
+	createTenantKey(t, keyService, "globex-ci", "globex", "upload")
+
+	// Without the tenant claim a token is rejected, even with the admin role
+	claims := testClaims("user-42", "admin")
+	delete(claims, "tenant")
+	token := signer.sign(t, claims)
+	if w := bearerRequest(router, "GET", "/API/jobs", token); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for a token without a tenant claim, got %d", w.Code)
+	}
+
+	// With a default tenant configured, the token belongs to it but an admin
+	// role does not reach other tenants
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(jwksPath, signer.jwks(), 0644)
+	tokens, err := services.DSTokenVerifier(services.TokenVerifierConfig{
+		JWKSFile:           jwksPath,
+		Issuer:             testIssuer,
+		Audience:           testAudience,
+		AllowDefaultTenant: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create token verifier: %v", err)
+	}
+	router, _, _ = setupAuthRouterWithTokens(t, tokens)
+	if w := bearerRequest(router, "GET", "/API/jobs", token); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with a default tenant, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := bearerRequest(router, "GET", "/API/usage?tenant=globex", token); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for the usage of another tenant, got %d", w.Code)
+	}
+
+	// The operator role is honoured for the default tenant only
+	operator := signer.sign(t, map[string]interface{}{
+		"iss": testIssuer, "aud": testAudience, "sub": "ops", "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{"operator"},
+	})
+	if w := bearerRequest(router, "GET", "/API/usage?tenant=globex", operator); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for an operator token, got %d", w.Code)
+	}
+	acmeOperator := signer.sign(t, testClaims("ops", "operator", "read"))
+	if w := bearerRequest(router, "GET", "/API/usage?tenant=globex", acmeOperator); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for the operator role of a tenant, got %d", w.Code)
+	}
+}
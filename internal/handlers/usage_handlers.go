@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"demandscience/internal/models"
+	"demandscience/internal/services"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultUsageDays = 7
+
+// Usage returns the quota and usage of the caller's tenant. Operators may ask
+// for another tenant with ?tenant=.
+func (handler *CsvProcessorHandler) Usage(ctx *gin.Context) {
+	clientIP := ctx.ClientIP()
+
+	tenant := principalTenant(ctx)
+	if requested, ok := ctx.GetQuery("tenant"); ok && requested != tenant {
+		principal := currentPrincipal(ctx)
+		if principal != nil && !principal.HasScope(models.ScopeOperator) {
+			log.Printf("[USAGE] [ERROR] Usage of another tenant refused - Principal: %s, Tenant: %s, IP: %s", principal.ID, requested, clientIP)
+			ctx.JSON(http.StatusForbidden, models.UploadResponse{
+				Error: "Only operators can see the usage of other tenants",
+			})
+			return
+		}
+		if err := services.ValidateTenant(requested); err != nil {
+			ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+				Error: err.Error(),
+			})
+			return
+		}
+		tenant = requested
+	}
+
+	days := defaultUsageDays
+	if value := ctx.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+				Error: "days must be a number",
+			})
+			return
+		}
+		days = parsed
+	}
+
+	usage, err := handler.csvService.GetUsage(tenant, days)
+	if err != nil {
+		log.Printf("[USAGE] [ERROR] Invalid usage request - Tenant: %s, IP: %s, Error: %v", tenant, clientIP, err)
+		ctx.JSON(http.StatusBadRequest, models.UploadResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, usage)
+}
+
+// respondQuotaError answers a quota error with its error code: 413 for the
+// file size and storage quotas, 429 with Retry-After when known for the
+// others. It reports whether err was a quota error.
+func respondQuotaError(ctx *gin.Context, err error) bool {
+	var quotaErr *services.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	status := http.StatusTooManyRequests
+	switch quotaErr.Code {
+	case models.ErrorCodeFileTooLarge, models.ErrorCodeStorageQuotaExceeded:
+		status = http.StatusRequestEntityTooLarge
+	}
+	if quotaErr.RetryAfter > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+	}
+
+	ctx.JSON(status, models.UploadResponse{
+		Error: quotaErr.Error(),
+		Code:  quotaErr.Code,
+	})
+	return true
+}
@@ -3,31 +3,499 @@ package models
 import "time"
 
 type UploadResponse struct {
-	ID    string `json:"id,omitempty"`
-	Error string `json:"error,omitempty"`
+	ID      string   `json:"id,omitempty"`
+	IDs     []string `json:"ids,omitempty"`
+	BatchID string   `json:"batchId,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	// Code identifies errors clients may want to handle, like exceeded quotas.
+	Code string `json:"code,omitempty"`
 }
 
+// Error codes of uploads refused for their size or a tenant quota.
+const (
+	ErrorCodeFileTooLarge         = "FILE_TOO_LARGE"
+	ErrorCodeConcurrentJobsLimit  = "CONCURRENT_JOBS_LIMIT"
+	ErrorCodeDailyRowLimit        = "DAILY_ROW_LIMIT"
+	ErrorCodeStorageQuotaExceeded = "STORAGE_QUOTA_EXCEEDED"
+)
+
 type JobStatus string
 
 const (
 	JobStatusInProgress JobStatus = "IN_PROGRESS"
 	JobStatusCompleted  JobStatus = "COMPLETED"
 	JobStatusFailed     JobStatus = "FAILED"
+	// JobStatusPartial is only used for batches where some, but not all, jobs failed.
+	JobStatusPartial JobStatus = "PARTIALLY_COMPLETED"
 )
 
+// ProcessingOptions are the per-upload settings sent alongside the file.
+type ProcessingOptions struct {
+	// Encoding forces the input character encoding; empty or "auto" probes it.
+	Encoding string `form:"encoding" json:"encoding,omitempty"`
+	// ZipMode is "combined" (one job for every CSV in a zip) or "per_entry" (one job each).
+	ZipMode string `form:"zip_mode" json:"zipMode,omitempty"`
+	// OutputFormat is the processed file format: csv (default), ndjson, json, parquet or sqlite.
+	OutputFormat string `form:"output_format" json:"outputFormat,omitempty"`
+	// Sheet selects the worksheet of an xlsx upload by name or 1-based position.
+	Sheet string `form:"sheet" json:"sheet,omitempty"`
+	// ErrorMode is "strict" (fail on the first malformed row) or "tolerant"
+	// (skip malformed rows and report them in an errors file).
+	ErrorMode string `form:"error_mode" json:"errorMode,omitempty"`
+	// MaxErrors is the number of malformed rows a tolerant job may skip before it fails.
+	MaxErrors int `form:"max_errors" json:"maxErrors,omitempty"`
+	// LazyQuotes accepts quotes inside unquoted fields and unescaped quotes in quoted ones.
+	LazyQuotes bool `form:"lazy_quotes" json:"lazyQuotes,omitempty"`
+	// VariableFields accepts rows whose field count differs from the header.
+	VariableFields bool `form:"variable_fields" json:"variableFields,omitempty"`
+	// Delimiter is the field delimiter of CSV input: a single character or
+	// "tab", "auto" to detect it from the first lines, or empty for a comma.
+	Delimiter string `form:"delimiter" json:"delimiter,omitempty"`
+	// Comment is a single character that marks lines to ignore when it starts them.
+	Comment string `form:"comment" json:"comment,omitempty"`
+	// TrimLeadingSpace drops leading white space in fields.
+	TrimLeadingSpace bool `form:"trim_leading_space" json:"trimLeadingSpace,omitempty"`
+	// SkipLines is the number of lines (spreadsheet rows for xlsx) above the header to ignore.
+	SkipLines int `form:"skip_lines" json:"skipLines,omitempty"`
+	// Tags label the job for searching; each value may hold a comma separated list.
+	Tags []string `form:"tags" json:"tags,omitempty"`
+	// Dedupe controls the cache of identical uploads: "new" (default) starts a
+	// job that reuses the cached output, "existing" returns the job that
+	// produced it and "off" always processes the upload.
+	Dedupe string `form:"dedupe" json:"dedupe,omitempty"`
+	// CreatedBy is the ID of the caller making the request. Handlers set it
+	// from the authenticated caller; it is never bound from the request.
+	CreatedBy string `form:"-" json:"-"`
+	// Tenant is the tenant of the caller, set by handlers like CreatedBy.
+	Tenant string `form:"-" json:"-"`
+	// InputDigest is the SHA-256 of the upload when a handler already hashed
+	// it, so the upload is not read again to look it up in the cache.
+	InputDigest string `form:"-" json:"-"`
+}
+
+// SourceURLRequest is the JSON body of an upload that fetches its file from a
+// URL instead of carrying it.
+type SourceURLRequest struct {
+	SourceURL string `json:"source_url" binding:"required"`
+	OptionsRequest
+}
+
+// OptionsRequest carries processing options in a JSON body, using the same
+// names as the form fields.
+type OptionsRequest struct {
+	Encoding         string   `json:"encoding"`
+	ZipMode          string   `json:"zip_mode"`
+	OutputFormat     string   `json:"output_format"`
+	Sheet            string   `json:"sheet"`
+	ErrorMode        string   `json:"error_mode"`
+	MaxErrors        int      `json:"max_errors"`
+	LazyQuotes       bool     `json:"lazy_quotes"`
+	VariableFields   bool     `json:"variable_fields"`
+	Delimiter        string   `json:"delimiter"`
+	Comment          string   `json:"comment"`
+	TrimLeadingSpace bool     `json:"trim_leading_space"`
+	SkipLines        int      `json:"skip_lines"`
+	Tags             []string `json:"tags"`
+	Dedupe           string   `json:"dedupe"`
+}
+
+// Options returns the processing options carried by the request.
+func (request OptionsRequest) Options() ProcessingOptions {
+	return ProcessingOptions{
+		Encoding:         request.Encoding,
+		ZipMode:          request.ZipMode,
+		OutputFormat:     request.OutputFormat,
+		Sheet:            request.Sheet,
+		ErrorMode:        request.ErrorMode,
+		MaxErrors:        request.MaxErrors,
+		LazyQuotes:       request.LazyQuotes,
+		VariableFields:   request.VariableFields,
+		Delimiter:        request.Delimiter,
+		Comment:          request.Comment,
+		TrimLeadingSpace: request.TrimLeadingSpace,
+		SkipLines:        request.SkipLines,
+		Tags:             request.Tags,
+		Dedupe:           request.Dedupe,
+	}
+}
+
 type ProcessingJob struct {
-	ID                string    `json:"id"`
-	Status            JobStatus `json:"status"`
-	OriginalFileName  string    `json:"originalFileName"`
-	ProcessedFilePath string    `json:"processedFilePath"`
-	CreatedAt         time.Time `json:"createdAt"`
+	ID               string            `json:"id"`
+	Status           JobStatus         `json:"status"`
+	OriginalFileName string            `json:"originalFileName"`
+	ProcessedFileKey string            `json:"processedFileKey"`
+	DetectedEncoding string            `json:"detectedEncoding,omitempty"`
+	RowErrorCount    int               `json:"rowErrorCount,omitempty"`
+	ErrorFileKey     string            `json:"errorFileKey,omitempty"`
+	ProfileKey       string            `json:"profileKey,omitempty"`
+	ArchiveEntry     string            `json:"archiveEntry,omitempty"`
+	BatchID          string            `json:"batchId,omitempty"`
+	Options          ProcessingOptions `json:"options"`
+	Stats            *JobStats         `json:"stats,omitempty"`
+	Failure          *JobFailure       `json:"failure,omitempty"`
+	Input            *JobInput         `json:"input,omitempty"`
+	InputDigest      string            `json:"inputDigest,omitempty"`
+	CachedFrom       string            `json:"cachedFrom,omitempty"`
+	RerunOf          string            `json:"rerunOf,omitempty"`
+	Reruns           []string          `json:"reruns,omitempty"`
+	CreatedBy        string            `json:"createdBy,omitempty"`
+	Tenant           string            `json:"tenant,omitempty"`
+	CreatedAt        time.Time         `json:"createdAt"`
+	CompletedAt      *time.Time        `json:"completedAt,omitempty"`
+}
+
+// JobInput is the original upload of a job, kept in storage until ExpiresAt
+// so the job can be re-run. Jobs re-run from it share the same input.
+type JobInput struct {
+	Key       string    `json:"-"`
+	FileName  string    `json:"fileName"`
+	Size      int64     `json:"size"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Failure codes of a failed job.
+const (
+	FailureHeaderReadFailed = "HEADER_READ_FAILED"
+	FailureMalformedRecord  = "MALFORMED_RECORD"
+	FailureIOError          = "IO_ERROR"
+	FailurePanic            = "PANIC"
+	FailureCancelled        = "CANCELLED"
+	FailureTimeout          = "TIMEOUT"
+	FailureDailyRowLimit    = ErrorCodeDailyRowLimit
+)
+
+// JobFailure explains why a job failed. Line is the input line the failure
+// happened on, when it is tied to one.
+type JobFailure struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// JobStats are the counters collected while a job processes its rows.
+type JobStats struct {
+	TotalRecords     int `json:"totalRecords"`
+	EmailsFound      int `json:"emailsFound"`
+	EmptyRecords     int `json:"emptyRecords"`
+	MalformedRecords int `json:"malformedRecords"`
+	// TopDomains are the most common domains of the valid emails found.
+	TopDomains []ValueCount `json:"topDomains"`
+	// InvalidReasons counts why rows without a valid email did not match.
+	InvalidReasons map[string]int `json:"invalidReasons"`
 }
 
-func DSProcessingJob(id, originalFileName string) *ProcessingJob {
+func DSProcessingJob(id, originalFileName string, options ProcessingOptions) *ProcessingJob {
 	return &ProcessingJob{
 		ID:               id,
 		OriginalFileName: originalFileName,
+		Options:          options,
 		Status:           JobStatusInProgress,
+		CreatedBy:        options.CreatedBy,
+		Tenant:           options.Tenant,
 		CreatedAt:        time.Now(),
 	}
 }
+
+// ProcessingBatch groups the jobs created by a single multi-file upload.
+type ProcessingBatch struct {
+	ID        string    `json:"id"`
+	JobIDs    []string  `json:"jobIds"`
+	CreatedBy string    `json:"createdBy,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func DSProcessingBatch(id string, jobIDs []string, createdBy, tenant string) *ProcessingBatch {
+	return &ProcessingBatch{
+		ID:        id,
+		JobIDs:    jobIDs,
+		CreatedBy: createdBy,
+		Tenant:    tenant,
+		CreatedAt: time.Now(),
+	}
+}
+
+// BatchJobStatus is the per-job line of a batch status response.
+type BatchJobStatus struct {
+	ID               string    `json:"id"`
+	OriginalFileName string    `json:"originalFileName"`
+	Status           JobStatus `json:"status"`
+}
+
+// BatchStatusResponse reports the combined progress of a batch.
+type BatchStatusResponse struct {
+	ID         string           `json:"id"`
+	Status     JobStatus        `json:"status"`
+	Total      int              `json:"total"`
+	Completed  int              `json:"completed"`
+	Failed     int              `json:"failed"`
+	InProgress int              `json:"inProgress"`
+	Progress   float64          `json:"progress"`
+	Jobs       []BatchJobStatus `json:"jobs"`
+	CreatedBy  string           `json:"createdBy,omitempty"`
+	Tenant     string           `json:"tenant,omitempty"`
+	CreatedAt  time.Time        `json:"createdAt"`
+}
+
+// ResumableUpload tracks a file that is sent in chunks over several requests.
+// JobIDs is set once the last chunk arrives and processing starts.
+type ResumableUpload struct {
+	ID        string            `json:"id"`
+	FileName  string            `json:"fileName"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Options   ProcessingOptions `json:"options"`
+	JobIDs    []string          `json:"jobIds,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+func DSResumableUpload(id, fileName string, length int64, options ProcessingOptions, expiresAt time.Time) *ResumableUpload {
+	return &ResumableUpload{
+		ID:        id,
+		FileName:  fileName,
+		Length:    length,
+		Options:   options,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// PreviewDialect describes how an upload was read.
+type PreviewDialect struct {
+	SourceFormat string `json:"sourceFormat"`
+	Encoding     string `json:"encoding"`
+	Delimiter    string `json:"delimiter,omitempty"`
+	// JobDelimiter is the delimiter a job with the same options splits rows on,
+	// which the previewed rows use as well.
+	JobDelimiter   string `json:"jobDelimiter,omitempty"`
+	Quote          string `json:"quote,omitempty"`
+	LineTerminator string `json:"lineTerminator,omitempty"`
+	Entry          string `json:"entry,omitempty"`
+	Sheet          string `json:"sheet,omitempty"`
+}
+
+// RowError is a malformed row found while reading an upload.
+type RowError struct {
+	Line  int    `json:"line"`
+	Raw   string `json:"raw"`
+	Error string `json:"error"`
+}
+
+// PreviewResponse shows the processed form of the first rows of an upload.
+type PreviewResponse struct {
+	FileName    string         `json:"fileName"`
+	Dialect     PreviewDialect `json:"dialect"`
+	Headers     []string       `json:"headers"`
+	Rows        [][]string     `json:"rows"`
+	EmailColumn string         `json:"emailColumn,omitempty"`
+	RowErrors   []RowError     `json:"rowErrors,omitempty"`
+	Warnings    []string       `json:"warnings,omitempty"`
+	// Truncated is true when the upload has more rows than were previewed.
+	Truncated bool `json:"truncated"`
+}
+
+// ValueCount is a column value and the number of rows holding it.
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// ColumnProfile summarizes the values of one input column.
+type ColumnProfile struct {
+	Name string `json:"name"`
+	// Type is the narrowest type of every filled value: boolean, integer,
+	// float, email, phone, string or empty.
+	Type     string  `json:"type"`
+	Filled   int     `json:"filled"`
+	FillRate float64 `json:"fillRate"`
+	Distinct int     `json:"distinct"`
+	// Approximate is true when the column had too many distinct values to
+	// count exactly; Distinct is then a HyperLogLog estimate and TopValues a
+	// space-saving estimate whose counts may be overstated.
+	Approximate       bool         `json:"approximate"`
+	TopValues         []ValueCount `json:"topValues"`
+	ValidEmailPercent float64      `json:"validEmailPercent"`
+	ValidPhonePercent float64      `json:"validPhonePercent"`
+}
+
+// JobProfile is the data quality report of a completed job.
+type JobProfile struct {
+	JobID   string          `json:"jobId"`
+	Rows    int             `json:"rows"`
+	Columns []ColumnProfile `json:"columns"`
+}
+
+// JobQuery filters and pages a job listing. Zero values do not filter.
+type JobQuery struct {
+	Status        JobStatus
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// FileName matches a case-insensitive substring of the original file name.
+	FileName string
+	Tag      string
+	// CreatedBy limits the listing to the jobs of one caller.
+	CreatedBy string
+	// Tenant limits the listing to the jobs of one tenant. It always applies:
+	// the empty tenant lists the jobs of the default tenant.
+	Tenant string
+	Limit  int
+	Cursor string
+}
+
+// JobSummary is the listing entry of a job.
+type JobSummary struct {
+	ID               string     `json:"id"`
+	Status           JobStatus  `json:"status"`
+	OriginalFileName string     `json:"originalFileName"`
+	Tags             []string   `json:"tags,omitempty"`
+	BatchID          string     `json:"batchId,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	CompletedAt      *time.Time `json:"completedAt,omitempty"`
+}
+
+// JobListResponse is a page of jobs, newest first.
+type JobListResponse struct {
+	Jobs       []JobSummary `json:"jobs"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// CacheStats counts lookups in the cache of identical uploads.
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// JobDetails is the status resource of a job. It carries metadata only; the
+// processed file is fetched from the output link.
+type JobDetails struct {
+	ID               string            `json:"id"`
+	Status           JobStatus         `json:"status"`
+	OriginalFileName string            `json:"originalFileName"`
+	ArchiveEntry     string            `json:"archiveEntry,omitempty"`
+	BatchID          string            `json:"batchId,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+	Options          ProcessingOptions `json:"options"`
+	DetectedEncoding string            `json:"detectedEncoding,omitempty"`
+	Stats            *JobStats         `json:"stats,omitempty"`
+	RowErrorCount    int               `json:"rowErrorCount"`
+	Failure          *JobFailure       `json:"failure,omitempty"`
+	// Input is set while the original upload is retained for re-runs.
+	Input *JobInput `json:"input,omitempty"`
+	// InputDigest is the hex SHA-256 of the upload.
+	InputDigest string `json:"inputDigest,omitempty"`
+	// CachedFrom is the job whose output an identical upload reused.
+	CachedFrom  string     `json:"cachedFrom,omitempty"`
+	CreatedBy   string     `json:"createdBy,omitempty"`
+	Tenant      string     `json:"tenant,omitempty"`
+	RerunOf     string     `json:"rerunOf,omitempty"`
+	Reruns      []string   `json:"reruns,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// DurationMs is the processing time of a finished job in milliseconds.
+	DurationMs int64             `json:"durationMs,omitempty"`
+	Links      map[string]string `json:"links"`
+	// HasOutput, HasRowErrors and HasProfile tell which links apply.
+	HasOutput    bool `json:"-"`
+	HasRowErrors bool `json:"-"`
+	HasProfile   bool `json:"-"`
+}
+
+// API key scopes. The admin scope grants upload and read within its tenant.
+// The operator scope grants every scope and manages the keys and usage of
+// every tenant; only keys of the default tenant may hold it.
+const (
+	ScopeUpload   = "upload"
+	ScopeRead     = "read"
+	ScopeAdmin    = "admin"
+	ScopeOperator = "operator"
+)
+
+// APIKey is a stored API key. Only the SHA-256 of the key is kept; the key
+// itself is shown once, when it is created.
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Prefix is the start of the key, to recognize it in listings.
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"hash,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	Tenant    string    `json:"tenant,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Principal returns the caller identity of requests made with the key.
+func (key *APIKey) Principal() *Principal {
+	return &Principal{ID: key.ID, Tenant: key.Tenant, Scopes: key.Scopes, Method: AuthMethodAPIKey}
+}
+
+// CreateAPIKeyRequest is the body of POST /API/keys. Tenant defaults to the
+// tenant of the caller.
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	Tenant string   `json:"tenant"`
+}
+
+// CreateAPIKeyResponse returns a new key in full, the only time it is shown.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// Authentication methods of a Principal.
+const (
+	AuthMethodAPIKey = "api_key"
+	AuthMethodJWT    = "jwt"
+)
+
+// Principal is the caller of a request, authenticated by an API key or a
+// bearer token. ID is what jobs record in CreatedBy: the key ID, or "jwt:"
+// followed by the token subject. Callers only see the jobs of their Tenant;
+// the empty tenant is the default one.
+type Principal struct {
+	ID     string
+	Tenant string
+	Scopes []string
+	Method string
+}
+
+// HasScope reports whether the principal has scope. Operator grants every
+// scope and admin every scope but operator.
+func (principal *Principal) HasScope(scope string) bool {
+	for _, granted := range principal.Scopes {
+		if granted == scope || granted == ScopeOperator || (granted == ScopeAdmin && scope != ScopeOperator) {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantQuota limits what a tenant may use. Zero leaves a limit off, and
+// MaxFileSize replaces MAX_FILE_SIZE for the tenant.
+type TenantQuota struct {
+	MaxConcurrentJobs int   `json:"maxConcurrentJobs,omitempty"`
+	MaxRowsPerDay     int64 `json:"maxRowsPerDay,omitempty"`
+	MaxBytesStored    int64 `json:"maxBytesStored,omitempty"`
+	MaxFileSize       int64 `json:"maxFileSize,omitempty"`
+}
+
+// DailyUsage is what a tenant used on one UTC day. BytesIn counts uploads and
+// BytesOut the processed output written.
+type DailyUsage struct {
+	Date          string `json:"date"`
+	Jobs          int    `json:"jobs"`
+	RowsProcessed int64  `json:"rowsProcessed"`
+	BytesIn       int64  `json:"bytesIn"`
+	BytesOut      int64  `json:"bytesOut"`
+}
+
+// UsageResponse is returned by GET /API/usage.
+type UsageResponse struct {
+	Tenant      string       `json:"tenant"`
+	Quota       TenantQuota  `json:"quota"`
+	RunningJobs int          `json:"runningJobs"`
+	BytesStored int64        `json:"bytesStored"`
+	Days        []DailyUsage `json:"days"`
+}
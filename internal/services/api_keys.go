@@ -0,0 +1,313 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"demandscience/internal/models"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIAuthEnabled requires an API key on every /API request.
+var APIAuthEnabled bool
+
+const (
+	apiKeyPrefix       = "dsk_"
+	apiKeyDisplayChars = 12
+	apiKeysFileName    = "api_keys.json"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned for an unknown API key ID.
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidScope is returned for a scope other than upload, read, admin or operator.
+	ErrInvalidScope = errors.New("scopes must be upload, read, admin or operator")
+	// ErrOperatorTenant is returned for an operator key of a tenant other
+	// than the default one.
+	ErrOperatorTenant = errors.New("operator keys must belong to the default tenant")
+)
+
+func init() {
+	if value := os.Getenv("API_AUTH_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("Invalid API_AUTH_ENABLED in .env: %v", err)
+		}
+		APIAuthEnabled = enabled
+	}
+}
+
+// APIKeyService keeps API keys in a JSON file. Keys are stored as their
+// SHA-256 only, so the file does not give access by itself. The file is
+// re-read when it changes, so keys managed from the command line apply to a
+// running server.
+type APIKeyService struct {
+	path      string
+	keys      map[string]*models.APIKey // by hash
+	modTime   time.Time
+	keysMutex sync.RWMutex
+}
+
+// DSAPIKeyService loads the keys at path, or API_KEYS_FILE in the storage
+// directory when path is empty. A missing file holds no keys.
+func DSAPIKeyService(path string) (*APIKeyService, error) {
+	if path == "" {
+		path = os.Getenv("API_KEYS_FILE")
+	}
+	if path == "" {
+		path = filepath.Join(storageDirFromEnv(), apiKeysFileName)
+	}
+
+	keyService := &APIKeyService{path: path, keys: make(map[string]*models.APIKey)}
+	if err := keyService.load(); err != nil {
+		return nil, err
+	}
+	log.Printf("[SERVICE] [API_KEYS] API keys loaded - File: %s, Keys: %d", path, len(keyService.keys))
+	return keyService, nil
+}
+
+// load replaces the keys in memory with the file. It must be called with
+// keysMutex held or before the service is shared.
+func (keyService *APIKeyService) load() error {
+	info, err := os.Stat(keyService.path)
+	if os.IsNotExist(err) {
+		keyService.keys = make(map[string]*models.APIKey)
+		keyService.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(keyService.path)
+	if err != nil {
+		return err
+	}
+	var stored []*models.APIKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return errors.New("invalid API keys file " + keyService.path + ": " + err.Error())
+	}
+
+	keys := make(map[string]*models.APIKey, len(stored))
+	for _, key := range stored {
+		keys[key.Hash] = key
+	}
+	keyService.keys = keys
+	keyService.modTime = info.ModTime()
+	return nil
+}
+
+// save writes the keys to a temporary file and renames it over the old one,
+// so a reader never sees a partial file. It must be called with keysMutex held.
+func (keyService *APIKeyService) save() error {
+	stored := make([]*models.APIKey, 0, len(keyService.keys))
+	for _, key := range keyService.keys {
+		stored = append(stored, key)
+	}
+	sortAPIKeys(stored)
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyService.path), 0755); err != nil {
+		return err
+	}
+	temporary := keyService.path + ".tmp"
+	if err := os.WriteFile(temporary, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(temporary, keyService.path); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	if info, err := os.Stat(keyService.path); err == nil {
+		keyService.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Create stores a new key with the given scopes for tenant and returns it in
+// full; the full key cannot be recovered later. An empty tenant is the
+// default one.
+func (keyService *APIKeyService) Create(name string, scopes []string, tenant string) (*models.CreateAPIKeyResponse, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	tenant = strings.TrimSpace(tenant)
+	if err := ValidateTenant(tenant); err != nil {
+		return nil, err
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range scopes {
+		if scope == models.ScopeOperator && tenant != "" {
+			return nil, ErrOperatorTenant
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	raw := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := &models.APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Prefix:    raw[:apiKeyDisplayChars],
+		Hash:      hashAPIKey(raw),
+		Scopes:    scopes,
+		Tenant:    tenant,
+		CreatedAt: time.Now(),
+	}
+
+	keyService.keysMutex.Lock()
+	defer keyService.keysMutex.Unlock()
+
+	keyService.keys[key.Hash] = key
+	if err := keyService.save(); err != nil {
+		delete(keyService.keys, key.Hash)
+		return nil, err
+	}
+
+	log.Printf("[SERVICE] [API_KEYS] API key created - ID: %s, Name: %s, Scopes: %v, Tenant: %s", key.ID, key.Name, key.Scopes, key.Tenant)
+	response := &models.CreateAPIKeyResponse{APIKey: *key, Key: raw}
+	response.Hash = ""
+	return response, nil
+}
+
+// List returns every key, oldest first, without hashes.
+func (keyService *APIKeyService) List() []models.APIKey {
+	keyService.keysMutex.RLock()
+	defer keyService.keysMutex.RUnlock()
+
+	stored := make([]*models.APIKey, 0, len(keyService.keys))
+	for _, key := range keyService.keys {
+		stored = append(stored, key)
+	}
+	sortAPIKeys(stored)
+
+	keys := make([]models.APIKey, 0, len(stored))
+	for _, key := range stored {
+		listed := *key
+		listed.Hash = ""
+		keys = append(keys, listed)
+	}
+	return keys
+}
+
+// Delete revokes the key with the given ID.
+func (keyService *APIKeyService) Delete(id string) error {
+	keyService.keysMutex.Lock()
+	defer keyService.keysMutex.Unlock()
+
+	for hash, key := range keyService.keys {
+		if key.ID == id {
+			delete(keyService.keys, hash)
+			if err := keyService.save(); err != nil {
+				keyService.keys[hash] = key
+				return err
+			}
+			log.Printf("[SERVICE] [API_KEYS] API key deleted - ID: %s, Name: %s", key.ID, key.Name)
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// Authenticate returns the key matching raw, or nil.
+func (keyService *APIKeyService) Authenticate(raw string) *models.APIKey {
+	hash := hashAPIKey(raw)
+
+	keyService.keysMutex.RLock()
+	key := keyService.keys[hash]
+	keyService.keysMutex.RUnlock()
+	return key
+}
+
+// ReloadIfChanged re-reads the keys file when another process changed it.
+func (keyService *APIKeyService) ReloadIfChanged() {
+	info, err := os.Stat(keyService.path)
+	var modTime time.Time
+	if err == nil {
+		modTime = info.ModTime()
+	} else if !os.IsNotExist(err) {
+		return
+	}
+
+	keyService.keysMutex.Lock()
+	defer keyService.keysMutex.Unlock()
+	if modTime.Equal(keyService.modTime) {
+		return
+	}
+	if err := keyService.load(); err != nil {
+		log.Printf("[SERVICE] [API_KEYS] [ERROR] Failed to reload API keys - File: %s, Error: %v", keyService.path, err)
+		return
+	}
+	log.Printf("[SERVICE] [API_KEYS] API keys reloaded - File: %s, Keys: %d", keyService.path, len(keyService.keys))
+}
+
+// ReloadPeriodically picks up changes to the keys file every interval.
+func (keyService *APIKeyService) ReloadPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		keyService.ReloadIfChanged()
+	}
+}
+
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeScopes splits comma separated scopes, lower-cases them and drops duplicates.
+func normalizeScopes(values []string) ([]string, error) {
+	var scopes []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, scope := range strings.Split(value, ",") {
+			scope = strings.ToLower(strings.TrimSpace(scope))
+			switch scope {
+			case "":
+				continue
+			case models.ScopeUpload, models.ScopeRead, models.ScopeAdmin, models.ScopeOperator:
+			default:
+				return nil, ErrInvalidScope
+			}
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+func sortAPIKeys(keys []*models.APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
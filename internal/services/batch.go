@@ -0,0 +1,241 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"demandscience/internal/models"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errBatchNotFound   = errors.New("batch not found")
+	errBatchInProgress = errors.New("batch is still in progress")
+	errBatchNoOutputs  = errors.New("no job in the batch completed successfully")
+)
+
+// ProcessBatch starts one job per uploaded file under a new batch. Every file is
+// validated before any job starts, so an invalid file rejects the whole batch.
+// Zip uploads in per_entry mode contribute one job per CSV entry.
+func (csvService *CsvProcessingService) ProcessBatch(fileHeaders []*multipart.FileHeader, options models.ProcessingOptions) (*models.ProcessingBatch, error) {
+	log.Printf("[SERVICE] [PROCESS_BATCH] Starting batch processing - Files: %d", len(fileHeaders))
+
+	if len(fileHeaders) == 0 {
+		return nil, errors.New("no files provided")
+	}
+
+	options, err := csvService.validateOptions(options)
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_BATCH] [ERROR] Option validation failed - Error: %v", err)
+		return nil, err
+	}
+	// Every batch member is a job of its own, so identical uploads reuse the
+	// cached output under a new ID rather than the ID of an outside job
+	if options.Dedupe == DedupeModeExisting {
+		options.Dedupe = DedupeModeNew
+	}
+
+	batchID := uuid.New().String()
+	var jobs []*models.ProcessingJob
+	var jobSources []uploadSource
+	// Zips in per_entry mode are hashed and retained once for all their entry jobs
+	archives := make(map[uploadSource][]*models.ProcessingJob)
+	var size int64
+
+	for _, fileHeader := range fileHeaders {
+		source := multipartSource{header: fileHeader}
+		if err := csvService.validateFile(source, options.Tenant); err != nil {
+			log.Printf("[SERVICE] [PROCESS_BATCH] [ERROR] File validation failed - BatchID: %s, File: %s, Error: %v",
+				batchID, fileHeader.Filename, err)
+			return nil, fmt.Errorf("%s: %w", fileHeader.Filename, err)
+		}
+
+		if options.ZipMode == ZipModePerEntry && uploadKind(fileHeader.Filename) == uploadKindZip {
+			entryJobs, err := csvService.archiveEntryJobs(source, options)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fileHeader.Filename, err)
+			}
+			archives[source] = entryJobs
+			for _, job := range entryJobs {
+				jobs = append(jobs, job)
+				jobSources = append(jobSources, source)
+			}
+			size += source.Size()
+			continue
+		}
+
+		jobs = append(jobs, csvService.newJob(fileHeader.Filename, options))
+		jobSources = append(jobSources, source)
+		size += source.Size()
+	}
+
+	if err := csvService.admitJobs(options.Tenant, len(jobs), size); err != nil {
+		log.Printf("[SERVICE] [PROCESS_BATCH] [ERROR] Batch refused by quota - BatchID: %s, Error: %v", batchID, err)
+		return nil, err
+	}
+	shared := make(map[uploadSource]*sharedInput, len(archives))
+	for source, entryJobs := range archives {
+		digest := digestUpload(source)
+		for _, job := range entryJobs {
+			job.InputDigest = digest
+		}
+		shared[source] = &sharedInput{}
+	}
+
+	jobIDs := make([]string, len(jobs))
+	for i, job := range jobs {
+		job.BatchID = batchID
+		jobIDs[i] = job.ID
+	}
+
+	batch := models.DSProcessingBatch(batchID, jobIDs, options.CreatedBy, options.Tenant)
+	csvService.jobsMutex.Lock()
+	csvService.batches[batchID] = batch
+	csvService.jobsMutex.Unlock()
+
+	for i, job := range jobs {
+		csvService.startJob(jobSources[i], job, shared[jobSources[i]])
+	}
+
+	log.Printf("[SERVICE] [PROCESS_BATCH] [SUCCESS] Batch processing initiated - BatchID: %s, Jobs: %d",
+		batchID, len(jobIDs))
+	return batch, nil
+}
+
+// GetBatchStatus returns the combined progress of a batch, or nil if it does not exist.
+func (csvService *CsvProcessingService) GetBatchStatus(batchID string) *models.BatchStatusResponse {
+	log.Printf("[SERVICE] [GET_BATCH] Retrieving batch - BatchID: %s", batchID)
+
+	csvService.jobsMutex.RLock()
+	defer csvService.jobsMutex.RUnlock()
+
+	batch := csvService.batches[batchID]
+	if batch == nil {
+		log.Printf("[SERVICE] [GET_BATCH] [ERROR] Batch not found - BatchID: %s", batchID)
+		return nil
+	}
+
+	status := &models.BatchStatusResponse{
+		ID:        batch.ID,
+		Total:     len(batch.JobIDs),
+		Jobs:      make([]models.BatchJobStatus, 0, len(batch.JobIDs)),
+		CreatedBy: batch.CreatedBy,
+		Tenant:    batch.Tenant,
+		CreatedAt: batch.CreatedAt,
+	}
+	for _, jobID := range batch.JobIDs {
+		job := csvService.jobs[jobID]
+		if job == nil {
+			// ProcessBatch registers the batch before startJob has registered
+			// every job, which copies and hashes its upload first
+			status.InProgress++
+			status.Jobs = append(status.Jobs, models.BatchJobStatus{
+				ID:     jobID,
+				Status: models.JobStatusInProgress,
+			})
+			continue
+		}
+		switch job.Status {
+		case models.JobStatusCompleted:
+			status.Completed++
+		case models.JobStatusFailed:
+			status.Failed++
+		default:
+			status.InProgress++
+		}
+		status.Jobs = append(status.Jobs, models.BatchJobStatus{
+			ID:               job.ID,
+			OriginalFileName: job.OriginalFileName,
+			Status:           job.Status,
+		})
+	}
+
+	switch {
+	case status.InProgress > 0:
+		status.Status = models.JobStatusInProgress
+	case status.Failed == 0:
+		status.Status = models.JobStatusCompleted
+	case status.Completed == 0:
+		status.Status = models.JobStatusFailed
+	default:
+		status.Status = models.JobStatusPartial
+	}
+	if status.Total > 0 {
+		status.Progress = float64(status.Completed+status.Failed) * 100 / float64(status.Total)
+	}
+
+	log.Printf("[SERVICE] [GET_BATCH] [SUCCESS] Batch retrieved - BatchID: %s, Status: %s, Completed: %d, Failed: %d, InProgress: %d",
+		batchID, status.Status, status.Completed, status.Failed, status.InProgress)
+	return status
+}
+
+// GetBatchArchive zips the processed files of every completed job in a batch.
+// It fails while any job is still running; failed jobs are left out.
+func (csvService *CsvProcessingService) GetBatchArchive(batchID string) ([]byte, error) {
+	log.Printf("[SERVICE] [GET_BATCH_FILE] Building batch archive - BatchID: %s", batchID)
+
+	status := csvService.GetBatchStatus(batchID)
+	if status == nil {
+		return nil, errBatchNotFound
+	}
+	if status.InProgress > 0 {
+		log.Printf("[SERVICE] [GET_BATCH_FILE] [ERROR] Batch still in progress - BatchID: %s, InProgress: %d",
+			batchID, status.InProgress)
+		return nil, errBatchInProgress
+	}
+	if status.Completed == 0 {
+		return nil, errBatchNoOutputs
+	}
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	usedNames := make(map[string]bool)
+
+	for _, jobStatus := range status.Jobs {
+		if jobStatus.Status != models.JobStatusCompleted {
+			continue
+		}
+		job := csvService.GetJob(jobStatus.ID)
+
+		name := strings.ReplaceAll(job.OriginalFileName, "/", "_") + "_processed." + OutputExtension(job.Options.OutputFormat)
+		if usedNames[name] {
+			name = job.ID + "_" + name
+		}
+		usedNames[name] = true
+
+		if err := csvService.addOutputToZip(writer, name, job.ID); err != nil {
+			log.Printf("[SERVICE] [GET_BATCH_FILE] [ERROR] Failed to add job output - BatchID: %s, JobID: %s, Error: %v",
+				batchID, job.ID, err)
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build batch archive: %w", err)
+	}
+
+	log.Printf("[SERVICE] [GET_BATCH_FILE] [SUCCESS] Batch archive built - BatchID: %s, Files: %d, Size: %d bytes",
+		batchID, status.Completed, archive.Len())
+	return archive.Bytes(), nil
+}
+
+func (csvService *CsvProcessingService) addOutputToZip(writer *zip.Writer, name, jobID string) error {
+	reader, err := csvService.OpenProcessedFile(jobID)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	entry, err := writer.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, reader)
+	return err
+}
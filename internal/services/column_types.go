@@ -0,0 +1,100 @@
+package services
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// columnType is the narrowest type that every non-empty value of a column fits.
+type columnType int
+
+const (
+	columnTypeEmpty columnType = iota
+	columnTypeBoolean
+	columnTypeInteger
+	columnTypeFloat
+	columnTypeString
+)
+
+var (
+	integerPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	floatPattern   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+)
+
+func (t columnType) String() string {
+	switch t {
+	case columnTypeBoolean:
+		return "boolean"
+	case columnTypeInteger:
+		return "integer"
+	case columnTypeFloat:
+		return "float"
+	case columnTypeEmpty:
+		return "empty"
+	default:
+		return "string"
+	}
+}
+
+// valueType classifies a single trimmed, non-empty value. Numbers with leading
+// zeros or a plus sign (zip codes, phone numbers) are kept as strings.
+func valueType(value string) columnType {
+	switch {
+	case strings.EqualFold(value, "true") || strings.EqualFold(value, "false"):
+		return columnTypeBoolean
+	case integerPattern.MatchString(value):
+		if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return columnTypeInteger
+		}
+		return columnTypeString
+	case floatPattern.MatchString(value):
+		return columnTypeFloat
+	default:
+		return columnTypeString
+	}
+}
+
+// widen returns the narrowest type that holds values of both t and other.
+func (t columnType) widen(other columnType) columnType {
+	switch {
+	case t == other || other == columnTypeEmpty:
+		return t
+	case t == columnTypeEmpty:
+		return other
+	case (t == columnTypeInteger && other == columnTypeFloat) || (t == columnTypeFloat && other == columnTypeInteger):
+		return columnTypeFloat
+	default:
+		return columnTypeString
+	}
+}
+
+func (t columnType) goType() reflect.Type {
+	switch t {
+	case columnTypeBoolean:
+		return reflect.TypeOf(false)
+	case columnTypeInteger:
+		return reflect.TypeOf(int64(0))
+	case columnTypeFloat:
+		return reflect.TypeOf(float64(0))
+	default:
+		return reflect.TypeOf("")
+	}
+}
+
+// parse converts a trimmed, non-empty value that is known to fit t.
+func (t columnType) parse(value string) reflect.Value {
+	switch t {
+	case columnTypeBoolean:
+		return reflect.ValueOf(strings.EqualFold(value, "true"))
+	case columnTypeInteger:
+		parsed, _ := strconv.ParseInt(value, 10, 64)
+		return reflect.ValueOf(parsed)
+	case columnTypeFloat:
+		parsed, _ := strconv.ParseFloat(value, 64)
+		return reflect.ValueOf(parsed)
+	default:
+		return reflect.ValueOf(value)
+	}
+}
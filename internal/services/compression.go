@@ -0,0 +1,90 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	ZipModeCombined = "combined"
+	ZipModePerEntry = "per_entry"
+)
+
+var (
+	errDecompressedTooLarge = errors.New("decompressed file size exceeds limit")
+	errCompressionRatio     = errors.New("compression ratio exceeds limit, refusing to decompress")
+	errNoCSVInArchive       = errors.New("zip archive contains no CSV files")
+)
+
+// zipCSVEntries returns the CSV files of a zip archive in archive order, skipping
+// directories and macOS resource forks.
+func zipCSVEntries(file io.ReaderAt, size int64) ([]*zip.File, error) {
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip archive: %w", err)
+	}
+
+	var files []*zip.File
+	for _, zipFile := range archive.File {
+		if zipFile.FileInfo().IsDir() || strings.HasPrefix(zipFile.Name, "__MACOSX/") {
+			continue
+		}
+		if uploadKind(zipFile.Name) != uploadKindCSV {
+			continue
+		}
+		files = append(files, zipFile)
+	}
+	if len(files) == 0 {
+		return nil, errNoCSVInArchive
+	}
+	return files, nil
+}
+
+// decompressionGuard caps the decompressed bytes read across all entries of a
+// job, both in absolute terms and relative to the compressed size.
+type decompressionGuard struct {
+	limit    int64
+	maxRatio int64
+	read     int64
+}
+
+// newDecompressionGuard allows limit decompressed bytes, the upload size limit
+// of the tenant.
+func newDecompressionGuard(limit int64) *decompressionGuard {
+	return &decompressionGuard{
+		limit:    limit,
+		maxRatio: int64(MaxCompressionRatio),
+	}
+}
+
+// wrap returns a reader that fails once the guard's limits are exceeded.
+// A compressedSize of zero disables the ratio check for plain inputs.
+func (guard *decompressionGuard) wrap(reader io.Reader, compressedSize int64) io.Reader {
+	return &guardedReader{guard: guard, reader: reader, compressedSize: compressedSize}
+}
+
+type guardedReader struct {
+	guard          *decompressionGuard
+	reader         io.Reader
+	compressedSize int64
+	read           int64
+}
+
+func (guarded *guardedReader) Read(p []byte) (int, error) {
+	n, err := guarded.reader.Read(p)
+	guarded.read += int64(n)
+	guarded.guard.read += int64(n)
+
+	if guarded.guard.read > guarded.guard.limit {
+		return n, errDecompressedTooLarge
+	}
+	// Small inputs compress extremely well, so only enforce the ratio past 1MB.
+	if guarded.compressedSize > 0 && guarded.read > 1024*1024 &&
+		guarded.read > guarded.compressedSize*guarded.guard.maxRatio {
+		return n, errCompressionRatio
+	}
+	return n, err
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bufio"
+	"demandscience/internal/models"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// DelimiterAuto detects the field delimiter of each CSV from its first lines.
+// Without it, CSV input is split on commas unless another delimiter is set.
+const DelimiterAuto = "auto"
+
+// delimiterSampleSize is the amount of text read ahead to detect the delimiter.
+const delimiterSampleSize = 64 * 1024
+
+// delimiterCandidates are the candidates checked when detecting the delimiter.
+var delimiterCandidates = []rune{',', ';', '\t', '|'}
+
+// validateCSVOptions checks the lenient parsing options of a job.
+func validateCSVOptions(options models.ProcessingOptions) error {
+	if options.SkipLines < 0 {
+		return errors.New("skip_lines must not be negative")
+	}
+	delimiter, fixed := csvDelimiter(options)
+	if fixed && (delimiter == utf8.RuneError || delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == '\uFEFF') {
+		return errors.New("delimiter must be auto, tab or a single character other than a quote or line break")
+	}
+	if options.Comment != "" {
+		comment, size := utf8.DecodeRuneInString(options.Comment)
+		if size != len(options.Comment) || comment == utf8.RuneError || comment == ',' || comment == '"' ||
+			comment == '\r' || comment == '\n' || comment == '\uFEFF' {
+			return errors.New("comment must be a single character other than a comma, quote or line break")
+		}
+		if fixed && comment == delimiter {
+			return errors.New("comment must differ from the delimiter")
+		}
+	}
+	return nil
+}
+
+// csvDelimiter returns the delimiter requested by options, a comma when none
+// is, and false when it is to be detected from the input instead. A value
+// longer than one character yields utf8.RuneError.
+func csvDelimiter(options models.ProcessingOptions) (rune, bool) {
+	switch options.Delimiter {
+	case "":
+		return ',', true
+	case DelimiterAuto:
+		return 0, false
+	case "tab":
+		return '\t', true
+	}
+	delimiter, size := utf8.DecodeRuneInString(options.Delimiter)
+	if size != len(options.Delimiter) {
+		return utf8.RuneError, true
+	}
+	return delimiter, true
+}
+
+// detectInputDelimiter reads ahead in input to detect its delimiter and
+// returns a reader that still yields the whole input. The comment character
+// is never picked, since csv.Reader rejects a delimiter equal to it.
+func detectInputDelimiter(input io.Reader, comment rune) (io.Reader, rune, error) {
+	buffered := bufio.NewReaderSize(input, delimiterSampleSize)
+	sample, err := buffered.Peek(delimiterSampleSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, 0, err
+	}
+	delimiter := detectDelimiter(string(sample))
+	if delimiter == comment {
+		delimiter = ','
+	}
+	return buffered, delimiter, nil
+}
+
+// configureCSVReader applies the lenient parsing options of a job.
+func configureCSVReader(reader *csv.Reader, options models.ProcessingOptions) {
+	reader.LazyQuotes = options.LazyQuotes
+	reader.TrimLeadingSpace = options.TrimLeadingSpace
+	if options.VariableFields {
+		reader.FieldsPerRecord = -1
+	}
+	if options.Comment != "" {
+		reader.Comment, _ = utf8.DecodeRuneInString(options.Comment)
+	}
+	if delimiter, fixed := csvDelimiter(options); fixed {
+		reader.Comma = delimiter
+	}
+}
+
+// skipLeadingLines drops the first count lines of input, such as report titles
+// above the header. They are skipped as plain text, so they do not need to be
+// valid CSV.
+func skipLeadingLines(input io.Reader, count int) (io.Reader, error) {
+	if count == 0 {
+		return input, nil
+	}
+	buffered := bufio.NewReader(input)
+	for skipped := 0; skipped < count; skipped++ {
+		if _, err := buffered.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				return buffered, nil
+			}
+			return nil, err
+		}
+	}
+	return buffered, nil
+}
+
+// skipLeadingRecords drops the first count rows of a record reader.
+func skipLeadingRecords(reader recordReader, count int) error {
+	for skipped := 0; skipped < count; skipped++ {
+		if _, err := reader.Read(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+	// Worksheet rows are padded to the width of the header, not of a title row
+	if sheetReader, ok := reader.(*xlsxRowReader); ok {
+		sheetReader.width = 0
+	}
+	return nil
+}
+
+// fitRecord pads or truncates a record to width fields, so rows of a
+// variable_fields job stay aligned with the header and the has_email column.
+func fitRecord(record []string, width int) []string {
+	if len(record) >= width {
+		return record[:width]
+	}
+	return append(record, make([]string, width-len(record))...)
+}
+
+// detectDelimiter picks the candidate that appears the same, non-zero number
+// of times outside quotes on the most lines, preferring a comma on ties.
+func detectDelimiter(sample string) rune {
+	lines := strings.Split(strings.ReplaceAll(sample, "\r\n", "\n"), "\n")
+	if len(lines) > 1 && !strings.HasSuffix(sample, "\n") {
+		lines = lines[:len(lines)-1]
+	}
+
+	best, bestScore := ',', 0
+	for _, candidate := range delimiterCandidates {
+		counts := make(map[int]int)
+		for _, line := range lines {
+			if line == "" {
+				continue
+			}
+			if count := countUnquoted(line, candidate); count > 0 {
+				counts[count]++
+			}
+		}
+		score := 0
+		for _, lineCount := range counts {
+			score = max(score, lineCount)
+		}
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+func countUnquoted(line string, delimiter rune) int {
+	count, quoted := 0, false
+	for _, char := range line {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case char == delimiter && !quoted:
+			count++
+		}
+	}
+	return count
+}
@@ -1,13 +1,16 @@
 package services
 
 import (
+	"context"
 	"demandscience/internal/models"
+	"demandscience/internal/storage"
 	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -15,6 +18,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
@@ -22,10 +26,38 @@ import (
 
 var MaxFileSize int
 
+// MaxCompressionRatio caps decompressed size relative to compressed size for gzip and zip uploads.
+var MaxCompressionRatio int
+
+// workDir holds output files while they are written, relative to the storage directory.
+const workDir = "work"
+
+// ResumableUploadExpiry is how long a resumable upload is kept after its last chunk.
+var ResumableUploadExpiry time.Duration
+
 type CsvProcessingService struct {
-	jobs       map[string]*models.ProcessingJob
-	jobsMutex  sync.RWMutex
-	storageDir string
+	jobs             map[string]*models.ProcessingJob
+	batches          map[string]*models.ProcessingBatch
+	index            *jobIndex
+	cancels          map[string]context.CancelFunc
+	inputs           map[string]retainedInput // by storage key
+	cache            *outputCache
+	jobsMutex        sync.RWMutex
+	uploads          map[string]*resumableUpload
+	uploadsMutex     sync.Mutex
+	idempotency      map[string]*idempotentUpload
+	idempotencyMutex sync.Mutex
+	quotas           map[string]models.TenantQuota // by tenant, "*" for the rest
+	quotasPath       string
+	quotasModTime    time.Time
+	usage            map[string]*tenantUsage
+	usagePath        string
+	usageDirty       bool // usage changed since it was last saved
+	usageMutex       sync.Mutex
+	usageSaveMutex   sync.Mutex   // serializes writes of the usage file
+	sourceClient     *http.Client // source_url downloads, allowing SourceURLAllowedNetworks
+	storageDir       string
+	storage          storage.Storage
 }
 
 func init() {
@@ -42,12 +74,55 @@ func init() {
 		}
 		MaxFileSize = val
 	}
+
+	maxRatioStr := os.Getenv("MAX_COMPRESSION_RATIO")
+	if maxRatioStr == "" {
+		MaxCompressionRatio = 100
+	} else {
+		val, err := strconv.Atoi(maxRatioStr)
+		if err != nil {
+			log.Fatalf("Invalid MAX_COMPRESSION_RATIO in .env: %v", err)
+		}
+		MaxCompressionRatio = val
+	}
+
+	expiryStr := os.Getenv("RESUMABLE_UPLOAD_EXPIRY")
+	if expiryStr == "" {
+		ResumableUploadExpiry = 24 * time.Hour
+	} else {
+		val, err := time.ParseDuration(expiryStr)
+		if err != nil {
+			log.Fatalf("Invalid RESUMABLE_UPLOAD_EXPIRY in .env: %v", err)
+		}
+		ResumableUploadExpiry = val
+	}
+
+	allowedNetworks, err := parseCIDRList(os.Getenv("SOURCE_URL_ALLOWED_NETWORKS"))
+	if err != nil {
+		log.Fatalf("Invalid SOURCE_URL_ALLOWED_NETWORKS in .env: %v", err)
+	}
+	SourceURLAllowedNetworks = allowedNetworks
+
+	for _, dir := range strings.Split(os.Getenv("SOURCE_URL_ALLOWED_DIRS"), ",") {
+		if dir = strings.TrimSpace(dir); dir != "" {
+			SourceURLAllowedDirs = append(SourceURLAllowedDirs, dir)
+		}
+	}
 }
 
-func DSCsvProcessingService() *CsvProcessingService {
+// storageDirFromEnv is STORAGE_DIR, or processed_files in the working directory.
+func storageDirFromEnv() string {
 	// storageDir := "processed_files"
-	workingDir, _ := os.Getwd()
-	storageDir := filepath.Join(workingDir, "processed_files")
+	storageDir := os.Getenv("STORAGE_DIR")
+	if storageDir == "" {
+		workingDir, _ := os.Getwd()
+		storageDir = filepath.Join(workingDir, "processed_files")
+	}
+	return storageDir
+}
+
+func DSCsvProcessingService() *CsvProcessingService {
+	storageDir := storageDirFromEnv()
 
 	log.Printf("[SERVICE] [INIT] Initializing CSV Processing Service")
 	log.Printf("[SERVICE] [INIT] Storage directory: %s", storageDir)
@@ -57,46 +132,236 @@ func DSCsvProcessingService() *CsvProcessingService {
 		log.Fatalf("[SERVICE] [INIT] [FATAL] Failed to create storage directory: %v", err)
 	}
 
-	log.Printf("[SERVICE] [INIT] CSV Processing Service initialized successfully")
-	return &CsvProcessingService{
-		jobs:       make(map[string]*models.ProcessingJob),
-		storageDir: storageDir,
+	for _, dir := range []string{resumableUploadsDir, workDir} {
+		if err := os.MkdirAll(filepath.Join(storageDir, dir), 0755); err != nil {
+			log.Fatalf("[SERVICE] [INIT] [FATAL] Failed to create %s directory: %v", dir, err)
+		}
 	}
+
+	// Processed files go to the configured backend; storageDir keeps working files
+	store, err := storage.DSStorageFromEnv(storageDir)
+	if err != nil {
+		log.Fatalf("[SERVICE] [INIT] [FATAL] Failed to initialize storage backend: %v", err)
+	}
+	log.Printf("[SERVICE] [INIT] Storage backend: %T", store)
+
+	csvService := &CsvProcessingService{
+		jobs:         make(map[string]*models.ProcessingJob),
+		batches:      make(map[string]*models.ProcessingBatch),
+		index:        newJobIndex(),
+		cancels:      make(map[string]context.CancelFunc),
+		inputs:       make(map[string]retainedInput),
+		cache:        newOutputCache(),
+		uploads:      make(map[string]*resumableUpload),
+		idempotency:  make(map[string]*idempotentUpload),
+		quotasPath:   tenantQuotasPath(storageDir),
+		usage:        make(map[string]*tenantUsage),
+		usagePath:    filepath.Join(storageDir, tenantUsageFileName),
+		sourceClient: sourceHTTPClient(SourceURLAllowedNetworks),
+		storageDir:   storageDir,
+		storage:      store,
+	}
+	if err := csvService.loadTenantQuotas(); err != nil {
+		log.Fatalf("[SERVICE] [INIT] [FATAL] Failed to load tenant quotas: %v", err)
+	}
+	if err := csvService.loadUsage(); err != nil {
+		log.Fatalf("[SERVICE] [INIT] [FATAL] Failed to load tenant usage: %v", err)
+	}
+	go csvService.expireResumableUploadsPeriodically(resumableUploadSweepEvery())
+	go csvService.expireRetainedInputsPeriodically(time.Minute)
+	go csvService.expireIdempotencyKeysPeriodically(time.Minute)
+	go csvService.reloadTenantQuotasPeriodically(10 * time.Second)
+	go csvService.saveUsagePeriodically(10 * time.Second)
+
+	log.Printf("[SERVICE] [INIT] CSV Processing Service initialized successfully")
+	return csvService
 }
 
-func (csvService *CsvProcessingService) ProcessFile(fileHeader *multipart.FileHeader) (string, error) {
+func (csvService *CsvProcessingService) ProcessFile(fileHeader *multipart.FileHeader, options models.ProcessingOptions) (string, error) {
+	return csvService.processUpload(multipartSource{header: fileHeader}, options)
+}
+
+// processUpload validates an upload and starts a single job for it.
+func (csvService *CsvProcessingService) processUpload(source uploadSource, options models.ProcessingOptions) (string, error) {
 	log.Printf("[SERVICE] [PROCESS] Starting file processing - File: %s, Size: %d bytes",
-		fileHeader.Filename, fileHeader.Size)
+		source.Name(), source.Size())
 
 	// Validate file
-	if err := csvService.validateFile(fileHeader); err != nil {
+	if err := csvService.validateFile(source, options.Tenant); err != nil {
 		log.Printf("[SERVICE] [PROCESS] [ERROR] File validation failed - File: %s, Error: %v",
-			fileHeader.Filename, err)
+			source.Name(), err)
 		return "", err
 	}
 
-	log.Printf("[SERVICE] [PROCESS] File validation passed - File: %s", fileHeader.Filename)
+	// Validate options
+	options, err := csvService.validateOptions(options)
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS] [ERROR] Option validation failed - File: %s, Error: %v",
+			source.Name(), err)
+		return "", err
+	}
+
+	log.Printf("[SERVICE] [PROCESS] File validation passed - File: %s", source.Name())
+
+	if err := csvService.admitJobs(options.Tenant, 1, source.Size()); err != nil {
+		return "", err
+	}
+	jobID := csvService.startJob(source, csvService.newJob(source.Name(), options), nil)
+
+	log.Printf("[SERVICE] [PROCESS] [SUCCESS] File processing initiated - JobID: %s, File: %s",
+		jobID, source.Name())
+	return jobID, nil
+}
+
+// ProcessArchiveEntries creates one job per CSV file inside a zip upload and
+// returns the job IDs in archive order.
+func (csvService *CsvProcessingService) ProcessArchiveEntries(fileHeader *multipart.FileHeader, options models.ProcessingOptions) ([]string, error) {
+	return csvService.processArchiveUpload(multipartSource{header: fileHeader}, options)
+}
+
+// processArchiveUpload validates a zip upload and starts one job per CSV entry.
+func (csvService *CsvProcessingService) processArchiveUpload(source uploadSource, options models.ProcessingOptions) ([]string, error) {
+	log.Printf("[SERVICE] [PROCESS_ARCHIVE] Starting archive processing - File: %s, Size: %d bytes",
+		source.Name(), source.Size())
+
+	if uploadKind(source.Name()) != uploadKindZip {
+		log.Printf("[SERVICE] [PROCESS_ARCHIVE] [ERROR] Not a zip archive - File: %s", source.Name())
+		return nil, errors.New("per_entry zip mode requires a .zip upload")
+	}
+
+	if err := csvService.validateFile(source, options.Tenant); err != nil {
+		log.Printf("[SERVICE] [PROCESS_ARCHIVE] [ERROR] File validation failed - File: %s, Error: %v",
+			source.Name(), err)
+		return nil, err
+	}
+
+	options, err := csvService.validateOptions(options)
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_ARCHIVE] [ERROR] Option validation failed - File: %s, Error: %v",
+			source.Name(), err)
+		return nil, err
+	}
+
+	jobs, err := csvService.archiveEntryJobs(source, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := csvService.admitJobs(options.Tenant, len(jobs), source.Size()); err != nil {
+		return nil, err
+	}
+
+	digest := options.InputDigest
+	if digest == "" {
+		digest = digestUpload(source)
+	}
+	shared := &sharedInput{}
+	jobIDs := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		job.InputDigest = digest
+		jobIDs = append(jobIDs, csvService.startJob(source, job, shared))
+	}
+
+	log.Printf("[SERVICE] [PROCESS_ARCHIVE] [SUCCESS] Archive processing initiated - File: %s, Jobs: %d",
+		source.Name(), len(jobIDs))
+	return jobIDs, nil
+}
+
+// processSource starts the jobs for an upload the same way the upload endpoint
+// does: one job per CSV entry for zips in per_entry mode, one job otherwise.
+func (csvService *CsvProcessingService) processSource(source uploadSource, options models.ProcessingOptions) ([]string, error) {
+	if options.ZipMode == ZipModePerEntry {
+		return csvService.processArchiveUpload(source, options)
+	}
+	jobID, err := csvService.processUpload(source, options)
+	if err != nil {
+		return nil, err
+	}
+	return []string{jobID}, nil
+}
+
+// archiveEntryJobs prepares one unstarted job per CSV entry of a zip upload.
+func (csvService *CsvProcessingService) archiveEntryJobs(source uploadSource, options models.ProcessingOptions) ([]*models.ProcessingJob, error) {
+	file, err := source.Open()
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_ARCHIVE] [ERROR] Failed to open uploaded file - File: %s, Error: %v",
+			source.Name(), err)
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer file.Close()
 
+	entries, err := zipCSVEntries(file, source.Size())
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_ARCHIVE] [ERROR] Failed to list archive entries - File: %s, Error: %v",
+			source.Name(), err)
+		return nil, err
+	}
+
+	jobs := make([]*models.ProcessingJob, 0, len(entries))
+	for _, entry := range entries {
+		job := csvService.newJob(source.Name()+"/"+entry.Name, options)
+		job.ArchiveEntry = entry.Name
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// newJob creates an in-progress job with a fresh ID without registering it.
+func (csvService *CsvProcessingService) newJob(originalFileName string, options models.ProcessingOptions) *models.ProcessingJob {
 	// Generate job ID
 	jobID := uuid.New().String()
-	log.Printf("[SERVICE] [PROCESS] Generated job ID: %s for file: %s", jobID, fileHeader.Filename)
+	log.Printf("[SERVICE] [PROCESS] Generated job ID: %s for file: %s", jobID, originalFileName)
+
+	return models.DSProcessingJob(jobID, originalFileName, options)
+}
+
+// startJob registers job and processes the upload in the background. The
+// upload is hashed unless the caller already did so. When an identical upload
+// already completed, the job reuses its output instead, or in the existing
+// dedupe mode the ID of that job is returned and job is dropped. Only jobs of
+// the same API key are returned that way, since other keys may not read them.
+// Otherwise the upload is retained for re-runs, through shared when several
+// jobs read it. The job must have been admitted with admitJobs.
+func (csvService *CsvProcessingService) startJob(source uploadSource, job *models.ProcessingJob, shared *sharedInput) string {
+	if job.InputDigest == "" {
+		job.InputDigest = job.Options.InputDigest
+	}
+	if job.InputDigest == "" {
+		job.InputDigest = digestUpload(source)
+	}
 
-	// Create job
-	job := models.DSProcessingJob(jobID, fileHeader.Filename)
+	// Re-runs exist to process the upload again, so they skip the cache
+	if job.RerunOf == "" {
+		if cached := csvService.cachedJob(job); cached != nil {
+			defer csvService.releaseJob(job)
+			if job.Options.Dedupe == DedupeModeExisting && cached.CreatedBy == job.CreatedBy {
+				return cached.ID
+			}
+			csvService.completeFromCache(job, cached)
+			return job.ID
+		}
+	}
+
+	if job.Input == nil {
+		if shared != nil {
+			job.Input = shared.retain(csvService, source, job.Tenant)
+		} else {
+			job.Input = csvService.retainInput(source, job.Tenant)
+		}
+	}
 
 	csvService.jobsMutex.Lock()
-	csvService.jobs[jobID] = job
+	csvService.jobs[job.ID] = job
+	csvService.index.add(job)
 	activeJobs := len(csvService.jobs)
 	csvService.jobsMutex.Unlock()
 
-	log.Printf("[SERVICE] [PROCESS] Job created and stored - JobID: %s, ActiveJobs: %d", jobID, activeJobs)
+	log.Printf("[SERVICE] [PROCESS] Job created and stored - JobID: %s, ActiveJobs: %d", job.ID, activeJobs)
 
 	// Process file asynchronously
-	go csvService.processFileAsync(fileHeader, job)
+	ctx, cancel := csvService.jobContext(job)
+	go csvService.processFileAsync(ctx, cancel, source, job)
 
-	log.Printf("[SERVICE] [PROCESS] [SUCCESS] File processing initiated - JobID: %s, File: %s",
-		jobID, fileHeader.Filename)
-	return jobID, nil
+	return job.ID
 }
 
 func (csvService *CsvProcessingService) GetJob(jobID string) *models.ProcessingJob {
@@ -117,6 +382,53 @@ func (csvService *CsvProcessingService) GetJob(jobID string) *models.ProcessingJ
 	return job
 }
 
+// GetJobDetails returns a consistent snapshot of a job's metadata, or nil when
+// the job does not exist.
+func (csvService *CsvProcessingService) GetJobDetails(jobID string) *models.JobDetails {
+	csvService.jobsMutex.RLock()
+	defer csvService.jobsMutex.RUnlock()
+
+	job := csvService.jobs[jobID]
+	if job == nil {
+		return nil
+	}
+
+	details := &models.JobDetails{
+		ID:               job.ID,
+		Status:           job.Status,
+		OriginalFileName: job.OriginalFileName,
+		ArchiveEntry:     job.ArchiveEntry,
+		BatchID:          job.BatchID,
+		Tags:             job.Options.Tags,
+		Options:          job.Options,
+		DetectedEncoding: job.DetectedEncoding,
+		Stats:            job.Stats,
+		RowErrorCount:    job.RowErrorCount,
+		Failure:          job.Failure,
+		InputDigest:      job.InputDigest,
+		CachedFrom:       job.CachedFrom,
+		CreatedBy:        job.CreatedBy,
+		Tenant:           job.Tenant,
+		RerunOf:          job.RerunOf,
+		Reruns:           append([]string(nil), job.Reruns...),
+		CreatedAt:        job.CreatedAt,
+		CompletedAt:      job.CompletedAt,
+		Links:            make(map[string]string),
+		HasOutput:        job.ProcessedFileKey != "",
+		HasRowErrors:     job.ErrorFileKey != "",
+		HasProfile:       job.ProfileKey != "",
+	}
+	if job.Input != nil {
+		if _, retained := csvService.inputs[job.Input.Key]; retained {
+			details.Input = job.Input
+		}
+	}
+	if job.CompletedAt != nil {
+		details.DurationMs = job.CompletedAt.Sub(job.CreatedAt).Milliseconds()
+	}
+	return details
+}
+
 func (csvService *CsvProcessingService) GetProcessedFile(jobID string) ([]byte, error) {
 	log.Printf("[SERVICE] [GET_FILE] Retrieving processed file - JobID: %s", jobID)
 	csvService.jobsMutex.RLock()
@@ -128,20 +440,20 @@ func (csvService *CsvProcessingService) GetProcessedFile(jobID string) ([]byte,
 		return nil, errors.New("job not found")
 	}
 
-	if job.ProcessedFilePath == "" {
-		log.Printf("[SERVICE] [GET_FILE] [ERROR] Processed file path empty - JobID: %s, Status: %s",
+	if job.ProcessedFileKey == "" {
+		log.Printf("[SERVICE] [GET_FILE] [ERROR] Processed file key empty - JobID: %s, Status: %s",
 			jobID, job.Status)
 		return nil, errors.New("processed file not found")
 	}
 
-	log.Printf("[SERVICE] [GET_FILE] Reading file from disk - JobID: %s, Path: %s",
-		jobID, job.ProcessedFilePath)
+	log.Printf("[SERVICE] [GET_FILE] Reading file from storage - JobID: %s, Key: %s",
+		jobID, job.ProcessedFileKey)
 
-	data, err := os.ReadFile(job.ProcessedFilePath)
+	data, err := csvService.storage.Get(context.Background(), job.ProcessedFileKey)
 
 	if err != nil {
-		log.Printf("[SERVICE] [GET_FILE] [ERROR] Failed to read file - JobID: %s, Path: %s, Error: %v",
-			jobID, job.ProcessedFilePath, err)
+		log.Printf("[SERVICE] [GET_FILE] [ERROR] Failed to read file - JobID: %s, Key: %s, Error: %v",
+			jobID, job.ProcessedFileKey, err)
 		return nil, fmt.Errorf("failed to read processed file: %v", err)
 	}
 
@@ -151,57 +463,137 @@ func (csvService *CsvProcessingService) GetProcessedFile(jobID string) ([]byte,
 	return data, nil
 }
 
-func (csvService *CsvProcessingService) validateFile(fileHeader *multipart.FileHeader) error {
-	log.Printf("[SERVICE] [VALIDATE] Starting file validation - File: %s", fileHeader.Filename)
+// validateFile checks the type of an upload and its size against the limit
+// of tenant.
+func (csvService *CsvProcessingService) validateFile(source uploadSource, tenant string) error {
+	log.Printf("[SERVICE] [VALIDATE] Starting file validation - File: %s", source.Name())
 
-	filename := strings.ToLower(fileHeader.Filename)
-	if !strings.HasSuffix(filename, ".csv") {
-		log.Printf("[SERVICE] [VALIDATE] [ERROR] Invalid file type - File: %s", fileHeader.Filename)
-		return errors.New("invalid file type. Only CSV files are allowed")
+	if uploadKind(source.Name()) == "" {
+		log.Printf("[SERVICE] [VALIDATE] [ERROR] Invalid file type - File: %s", source.Name())
+		return errors.New("invalid file type. Only CSV, CSV.GZ, ZIP and XLSX files are allowed")
 	}
 
-	if fileHeader.Size > int64(MaxFileSize) {
+	if limit := csvService.maxFileSize(tenant); source.Size() > limit {
 		log.Printf("[SERVICE] [VALIDATE] [ERROR] File too large - File: %s, Size: %d bytes, Limit: %d bytes",
-			fileHeader.Filename, fileHeader.Size, MaxFileSize)
-		return errors.New("file size exceeds 10MB limit")
+			source.Name(), source.Size(), limit)
+		return &QuotaError{
+			Code:    models.ErrorCodeFileTooLarge,
+			Message: fmt.Sprintf("file size exceeds the limit of %d bytes", limit),
+		}
 	}
 
 	log.Printf("[SERVICE] [VALIDATE] [SUCCESS] File validation passed - File: %s, Size: %d bytes",
-		fileHeader.Filename, fileHeader.Size)
+		source.Name(), source.Size())
 
 	return nil
 }
 
-func (csvService *CsvProcessingService) processFileAsync(fileHeader *multipart.FileHeader, job *models.ProcessingJob) {
+func (csvService *CsvProcessingService) validateOptions(options models.ProcessingOptions) (models.ProcessingOptions, error) {
+	encoding, err := normalizeEncoding(options.Encoding)
+	if err != nil {
+		log.Printf("[SERVICE] [VALIDATE] [ERROR] Invalid encoding option - Encoding: %s", options.Encoding)
+		return options, err
+	}
+	options.Encoding = encoding
+
+	outputFormat, err := normalizeOutputFormat(options.OutputFormat)
+	if err != nil {
+		log.Printf("[SERVICE] [VALIDATE] [ERROR] Invalid output format option - OutputFormat: %s", options.OutputFormat)
+		return options, err
+	}
+	options.OutputFormat = outputFormat
+
+	switch options.ZipMode {
+	case "":
+		options.ZipMode = ZipModeCombined
+	case ZipModeCombined, ZipModePerEntry:
+	default:
+		log.Printf("[SERVICE] [VALIDATE] [ERROR] Invalid zip mode option - ZipMode: %s", options.ZipMode)
+		return options, errors.New("unsupported zip_mode: " + options.ZipMode)
+	}
+
+	switch strings.ToLower(options.ErrorMode) {
+	case "", ErrorModeStrict:
+		options.ErrorMode = ErrorModeStrict
+	case ErrorModeTolerant:
+		options.ErrorMode = ErrorModeTolerant
+	default:
+		log.Printf("[SERVICE] [VALIDATE] [ERROR] Invalid error mode option - ErrorMode: %s", options.ErrorMode)
+		return options, errors.New("unsupported error_mode: " + options.ErrorMode)
+	}
+
+	if err := validateCSVOptions(options); err != nil {
+		log.Printf("[SERVICE] [VALIDATE] [ERROR] Invalid CSV parsing option - Error: %v", err)
+		return options, err
+	}
+
+	if options.MaxErrors < 0 {
+		return options, errors.New("max_errors must not be negative")
+	}
+	if options.ErrorMode == ErrorModeTolerant && options.MaxErrors == 0 {
+		options.MaxErrors = DefaultMaxRowErrors
+	}
+
+	tags, err := normalizeTags(options.Tags)
+	if err != nil {
+		log.Printf("[SERVICE] [VALIDATE] [ERROR] Invalid tags option - Tags: %v", options.Tags)
+		return options, err
+	}
+	options.Tags = tags
+
+	dedupe, err := normalizeDedupeMode(options.Dedupe)
+	if err != nil {
+		log.Printf("[SERVICE] [VALIDATE] [ERROR] Invalid dedupe option - Dedupe: %s", options.Dedupe)
+		return options, err
+	}
+	options.Dedupe = dedupe
+
+	return options, nil
+}
+
+func (csvService *CsvProcessingService) processFileAsync(ctx context.Context, cancel context.CancelFunc,
+	source uploadSource, job *models.ProcessingJob) {
 	startTime := time.Now()
 	log.Printf("[SERVICE] [ASYNC] Starting async processing - JobID: %s, File: %s",
 		job.ID, job.OriginalFileName)
 
+	defer csvService.releaseJob(job)
+	defer cancel()
 	defer func() {
 		if r := recover(); r != nil {
+			completedAt := time.Now()
 			csvService.jobsMutex.Lock()
 			job.Status = models.JobStatusFailed
+			job.Failure = &models.JobFailure{Code: models.FailurePanic, Message: fmt.Sprintf("internal error: %v", r)}
+			job.CompletedAt = &completedAt
 			csvService.jobsMutex.Unlock()
-			log.Printf("[SERVICE] [ASYNC] [ERROR] Job marked as failed due to panic - JobID: %s", job.ID)
+			log.Printf("[SERVICE] [ASYNC] [ERROR] Job marked as failed due to panic - JobID: %s, Panic: %v", job.ID, r)
 		}
 	}()
 
 	// time.Sleep(15 * time.Second)
 
-	if err := csvService.processFile(fileHeader, job); err != nil {
+	if err := csvService.processFile(ctx, source, job); err != nil {
 		duration := time.Since(startTime)
-		log.Printf("[SERVICE] [ASYNC] [ERROR] Processing failed - JobID: %s, Error: %v, Duration: %v",
-			job.ID, err, duration)
+		failure := classifyFailure(err)
+		log.Printf("[SERVICE] [ASYNC] [ERROR] Processing failed - JobID: %s, Code: %s, Line: %d, Error: %v, Duration: %v",
+			job.ID, failure.Code, failure.Line, err, duration)
 
+		completedAt := time.Now()
 		csvService.jobsMutex.Lock()
 		job.Status = models.JobStatusFailed
+		job.Failure = failure
+		job.CompletedAt = &completedAt
 		csvService.jobsMutex.Unlock()
 		return
 	}
 
 	duration := time.Since(startTime)
+	completedAt := time.Now()
 	csvService.jobsMutex.Lock()
 	job.Status = models.JobStatusCompleted
+	job.CompletedAt = &completedAt
+	csvService.cacheOutput(job)
 	activeJobs := len(csvService.jobs)
 	csvService.jobsMutex.Unlock()
 
@@ -209,11 +601,11 @@ func (csvService *CsvProcessingService) processFileAsync(fileHeader *multipart.F
 		job.ID, job.OriginalFileName, duration, activeJobs)
 }
 
-func (csvService *CsvProcessingService) processFile(fileHeader *multipart.FileHeader, job *models.ProcessingJob) error {
+func (csvService *CsvProcessingService) processFile(ctx context.Context, source uploadSource, job *models.ProcessingJob) error {
 	log.Printf("[SERVICE] [PROCESS_FILE] Starting file processing - JobID: %s", job.ID)
 
 	// Open uploaded file
-	file, err := fileHeader.Open()
+	file, err := source.Open()
 	if err != nil {
 		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to open uploaded file - JobID: %s, Error: %v",
 			job.ID, err)
@@ -221,123 +613,439 @@ func (csvService *CsvProcessingService) processFile(fileHeader *multipart.FileHe
 	}
 	defer file.Close()
 
-	// Create output file
-	outputPath := filepath.Join(csvService.storageDir, job.ID+"_processed.csv")
-	log.Printf("[SERVICE] [PROCESS_FILE] Creating output file - JobID: %s, Path: %s", job.ID, outputPath)
-	outputFile, err := os.Create(outputPath)
+	// Resolve the CSV streams inside the upload
+	maxSize := csvService.maxFileSize(job.Tenant)
+	entries, err := openInputEntries(file, source.Name(), source.Size(), job.ArchiveEntry, job.Options.Sheet, maxSize)
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to read upload - JobID: %s, Error: %v",
+			job.ID, err)
+		return err
+	}
+
+	// Create output file in the work directory; it is moved to storage once complete
+	outputName := job.ID + "_processed." + OutputExtension(job.Options.OutputFormat)
+	outputKey := tenantKey(job.Tenant, outputName)
+	outputPath := filepath.Join(csvService.storageDir, workDir, outputName)
+	defer os.Remove(outputPath)
+	log.Printf("[SERVICE] [PROCESS_FILE] Creating output file - JobID: %s, Path: %s, Format: %s",
+		job.ID, outputPath, job.Options.OutputFormat)
+	writer, err := createRecordWriter(job.Options.OutputFormat, outputPath)
 	if err != nil {
 		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to create output file - JobID: %s, Path: %s, Error: %v",
 			job.ID, outputPath, err)
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer outputFile.Close()
 
-	// Parse CSV
-	reader := csv.NewReader(file)
-	writer := csv.NewWriter(outputFile)
-	defer writer.Flush()
+	var rowErrors *rowErrorReport
+	if job.Options.ErrorMode == ErrorModeTolerant {
+		rowErrors = newRowErrorReport(filepath.Join(csvService.storageDir, workDir, job.ID+"_errors.csv"), job.Options.MaxErrors)
+		defer csvService.storeRowErrors(job, rowErrors)
+	}
+
+	guard := newDecompressionGuard(maxSize)
+	stats := &recordStats{}
+	var outputHeaders []string
+
+	for i, entry := range entries {
+		log.Printf("[SERVICE] [PROCESS_FILE] Processing input entry - JobID: %s, Entry: %s (%d/%d)",
+			job.ID, entry.name, i+1, len(entries))
+
+		headers, err := csvService.processEntry(ctx, entry, guard, writer, outputHeaders, job, stats, rowErrors)
+		if err != nil {
+			writer.Close()
+			return err
+		}
+		if outputHeaders == nil {
+			outputHeaders = headers
+		}
+	}
+
+	log.Printf("[SERVICE] [PROCESS_FILE] File processing statistics - JobID: %s, TotalRecords: %d, EmailsFound: %d, EmptyRecords: %d, MalformedRecords: %d",
+		job.ID, stats.recordCount, stats.emailFoundCount, stats.emptyRecordCount, stats.malformedRecordCount)
+
+	if summary, ok := writer.(summaryWriter); ok {
+		if err := summary.WriteSummary(jobSummary{
+			JobID:            job.ID,
+			OriginalFileName: job.OriginalFileName,
+			SourceFormat:     uploadKind(source.Name()),
+			Encoding:         job.DetectedEncoding,
+			Delimiter:        stats.delimiter,
+			TotalRecords:     stats.recordCount,
+			EmailsFound:      stats.emailFoundCount,
+			EmptyRecords:     stats.emptyRecordCount,
+			CreatedAt:        job.CreatedAt,
+		}); err != nil {
+			writer.Close()
+			log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to write job summary - JobID: %s, Error: %v", job.ID, err)
+			return fmt.Errorf("failed to write job summary: %w", err)
+		}
+	}
+
+	// Flush and close writer
+	if err := writer.Close(); err != nil {
+		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Output writer error - JobID: %s, Error: %v", job.ID, err)
+		return err
+	}
+
+	outputSize, err := csvService.storeOutput(job.Tenant, outputKey, outputPath)
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to store output - JobID: %s, Key: %s, Error: %v",
+			job.ID, outputKey, err)
+		return fmt.Errorf("failed to store processed file: %w", err)
+	}
+	csvService.recordOutput(job.Tenant, outputSize)
+	csvService.jobsMutex.Lock()
+	job.ProcessedFileKey = outputKey
+	job.Stats = stats.jobStats()
+	csvService.jobsMutex.Unlock()
+
+	// The profile is a report on the output; failing to store it does not fail the job
+	if stats.profiler != nil {
+		if err := csvService.storeProfile(job, stats.profiler); err != nil {
+			log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to store column profile - JobID: %s, Error: %v", job.ID, err)
+		}
+	}
+
+	// Get file size for logging
+	if info, err := csvService.storage.Stat(context.Background(), outputKey); err == nil {
+		log.Printf("[SERVICE] [PROCESS_FILE] [SUCCESS] File processing completed - JobID: %s, InputSize: %d bytes, OutputSize: %d bytes, OutputKey: %s",
+			job.ID, source.Size(), info.Size, outputKey)
+	} else {
+		log.Printf("[SERVICE] [PROCESS_FILE] [SUCCESS] File processing completed - JobID: %s, OutputKey: %s",
+			job.ID, outputKey)
+	}
+	return nil
+}
+
+// GetRowErrorsFile returns the errors file of a tolerant job that skipped malformed rows.
+func (csvService *CsvProcessingService) GetRowErrorsFile(jobID string) ([]byte, error) {
+	job := csvService.GetJob(jobID)
+	if job == nil {
+		return nil, errors.New("job not found")
+	}
+
+	csvService.jobsMutex.RLock()
+	key := job.ErrorFileKey
+	csvService.jobsMutex.RUnlock()
+	if key == "" {
+		return nil, errors.New("errors file not found")
+	}
+
+	data, err := csvService.storage.Get(context.Background(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read errors file: %w", err)
+	}
+	return data, nil
+}
+
+// storeRowErrors moves the errors file of a tolerant job to storage. It runs
+// whether or not the job succeeds, so a job that ran out of error budget still
+// reports the rows that failed.
+func (csvService *CsvProcessingService) storeRowErrors(job *models.ProcessingJob, rowErrors *rowErrorReport) {
+	written, err := rowErrors.close()
+	if written {
+		defer os.Remove(rowErrors.path)
+	}
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to write errors file - JobID: %s, Error: %v", job.ID, err)
+		return
+	}
+
+	key := ""
+	if written {
+		key = tenantKey(job.Tenant, job.ID+"_errors.csv")
+		if _, err := csvService.storeOutput(job.Tenant, key, rowErrors.path); err != nil {
+			log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to store errors file - JobID: %s, Error: %v", job.ID, err)
+			key = ""
+		}
+	}
+
+	csvService.jobsMutex.Lock()
+	job.RowErrorCount = rowErrors.count
+	job.ErrorFileKey = key
+	csvService.jobsMutex.Unlock()
+
+	log.Printf("[SERVICE] [PROCESS_FILE] Malformed rows reported - JobID: %s, Count: %d, Key: %s", job.ID, rowErrors.count, key)
+}
+
+// storeOutput uploads a finished output file from the work directory to
+// storage, counts it against the storage of tenant and returns its size.
+func (csvService *CsvProcessingService) storeOutput(tenant, key, path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := csvService.storage.Put(context.Background(), key, file, info.Size()); err != nil {
+		return 0, err
+	}
+	csvService.recordStored(tenant, info.Size())
+	return info.Size(), nil
+}
+
+// OpenProcessedFile streams the processed file of a job from storage.
+func (csvService *CsvProcessingService) OpenProcessedFile(jobID string) (io.ReadCloser, error) {
+	job := csvService.GetJob(jobID)
+	if job == nil {
+		return nil, errors.New("job not found")
+	}
+	if job.ProcessedFileKey == "" {
+		return nil, errors.New("processed file not found")
+	}
+
+	reader, err := csvService.storage.Open(context.Background(), job.ProcessedFileKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processed file: %w", err)
+	}
+	return reader, nil
+}
+
+// recordStats accumulates counters across every entry of a job.
+type recordStats struct {
+	recordCount          int
+	emailFoundCount      int
+	emptyRecordCount     int
+	malformedRecordCount int
+	// profiler collects the column profile; it is created from the first header
+	profiler *jobProfiler
+	// domains and invalidReasons feed the email breakdown of the job report
+	domains        map[string]int
+	invalidReasons map[string]int
+	// delimiter is the field delimiter of the first entry, "" for spreadsheets
+	delimiter string
+}
+
+var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// openEntryRecords opens an input entry as a record reader. CSV streams are
+// transcoded to UTF-8 first; spreadsheets are always Unicode. The resolved
+// encoding is returned alongside the reader.
+func (csvService *CsvProcessingService) openEntryRecords(entry inputEntry, guard *decompressionGuard,
+	job *models.ProcessingJob) (recordReader, io.Closer, string, error) {
+	if entry.openRecords != nil {
+		reader, closer, err := entry.openRecords()
+		if err != nil {
+			log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to open spreadsheet - JobID: %s, Entry: %s, Error: %v",
+				job.ID, entry.name, err)
+			return nil, nil, "", fmt.Errorf("failed to open %s: %w", entry.name, err)
+		}
+		if err := skipLeadingRecords(reader, job.Options.SkipLines); err != nil {
+			closer.Close()
+			return nil, nil, "", fmt.Errorf("failed to skip leading rows of %s: %w", entry.name, err)
+		}
+		if sheetReader, ok := reader.(*xlsxRowReader); ok {
+			log.Printf("[SERVICE] [PROCESS_FILE] Reading worksheet - JobID: %s, Entry: %s, Sheet: %s",
+				job.ID, entry.name, sheetReader.sheetName)
+		}
+		return reader, closer, EncodingUTF8, nil
+	}
+
+	stream, err := entry.open()
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to open input entry - JobID: %s, Entry: %s, Error: %v",
+			job.ID, entry.name, err)
+		return nil, nil, "", fmt.Errorf("failed to open %s: %w", entry.name, err)
+	}
+
+	// Transcode input to UTF-8
+	input, encoding, err := decodeInput(guard.wrap(stream, entry.compressedSize), job.Options.Encoding)
+	if err != nil {
+		stream.Close()
+		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to detect input encoding - JobID: %s, Error: %v",
+			job.ID, err)
+		return nil, nil, "", fmt.Errorf("failed to detect input encoding: %w", err)
+	}
+
+	log.Printf("[SERVICE] [PROCESS_FILE] Input encoding resolved - JobID: %s, Entry: %s, Requested: %s, Encoding: %s",
+		job.ID, entry.name, job.Options.Encoding, encoding)
+
+	input, err = skipLeadingLines(input, job.Options.SkipLines)
+	if err != nil {
+		stream.Close()
+		return nil, nil, "", fmt.Errorf("failed to skip leading lines of %s: %w", entry.name, err)
+	}
+
+	// With delimiter=auto, each entry is split on the one its first lines use
+	var delimiter rune
+	if _, fixed := csvDelimiter(job.Options); !fixed {
+		comment, _ := utf8.DecodeRuneInString(job.Options.Comment)
+		input, delimiter, err = detectInputDelimiter(input, comment)
+		if err != nil {
+			stream.Close()
+			return nil, nil, "", fmt.Errorf("failed to read %s: %w", entry.name, err)
+		}
+		log.Printf("[SERVICE] [PROCESS_FILE] Input delimiter detected - JobID: %s, Entry: %s, Delimiter: %q",
+			job.ID, entry.name, delimiter)
+	}
+
+	reader := newRawRecordReader(input)
+	configureCSVReader(reader.reader, job.Options)
+	if delimiter != 0 {
+		reader.reader.Comma = delimiter
+	}
+	return reader, stream, encoding, nil
+}
+
+// processEntry parses one tabular stream of the upload and appends its rows to writer.
+// The first entry writes the output header; later entries must share the same
+// header and only contribute their records. It returns the entry's header row.
+func (csvService *CsvProcessingService) processEntry(ctx context.Context, entry inputEntry, guard *decompressionGuard, writer recordWriter,
+	outputHeaders []string, job *models.ProcessingJob, stats *recordStats, rowErrors *rowErrorReport) ([]string, error) {
+	reader, closer, encoding, err := csvService.openEntryRecords(entry, guard, job)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	if outputHeaders == nil {
+		csvService.jobsMutex.Lock()
+		job.DetectedEncoding = encoding
+		csvService.jobsMutex.Unlock()
+		if rawReader, ok := reader.(*rawRecordReader); ok {
+			stats.delimiter = string(rawReader.reader.Comma)
+		}
+	}
 
-	log.Printf("[SERVICE] [PROCESS_FILE] Reading CSV headers - JobID: %s", job.ID)
+	log.Printf("[SERVICE] [PROCESS_FILE] Reading headers - JobID: %s", job.ID)
 
 	// Read and process header
 	headers, err := reader.Read()
 	if err != nil {
 		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to read headers - JobID: %s, Error: %v",
 			job.ID, err)
-		return fmt.Errorf("failed to read headers: %w", err)
+		line := job.Options.SkipLines + 1
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			line = parseErr.StartLine + job.Options.SkipLines
+		}
+		return nil, newJobError(models.FailureHeaderReadFailed, line, fmt.Errorf("failed to read headers: %w", err))
 	}
 
-	// Add email flag column to headers
-	newHeaders := append(headers, "has_email")
-	if err := writer.Write(newHeaders); err != nil {
-		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to write headers - JobID: %s, Error: %v",
-			job.ID, err)
-		return fmt.Errorf("failed to write headers: %w", err)
-	}
+	if outputHeaders == nil {
+		// Add email flag column to headers
+		newHeaders := append(headers, "has_email")
+		if err := writer.WriteHeader(newHeaders); err != nil {
+			log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to write headers - JobID: %s, Error: %v",
+				job.ID, err)
+			return nil, fmt.Errorf("failed to write headers: %w", err)
+		}
 
-	log.Printf("[SERVICE] [PROCESS_FILE] Headers written with has_email column - JobID: %s", job.ID)
+		log.Printf("[SERVICE] [PROCESS_FILE] Headers written with has_email column - JobID: %s", job.ID)
+		stats.profiler = newJobProfiler(headers)
+	} else if strings.Join(headers, "\x00") != strings.Join(outputHeaders, "\x00") {
+		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Header mismatch between archive entries - JobID: %s, Entry: %s",
+			job.ID, entry.name)
+		return nil, newJobError(models.FailureHeaderReadFailed, 0,
+			fmt.Errorf("headers of %s do not match the first CSV in the archive", entry.name))
+	}
 
 	// Process each record
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-
-	recordCount := 0
-	emailFoundCount := 0
-	emptyRecordCount := 0
-
 	for {
+		if err := ctx.Err(); err != nil {
+			log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Processing stopped - JobID: %s, Record: %d, Error: %v",
+				job.ID, stats.recordCount, err)
+			return nil, err
+		}
+
 		record, err := reader.Read()
 		if err == io.EOF {
 			log.Printf("[SERVICE] [PROCESS_FILE] Reached end of file - JobID: %s", job.ID)
 			break
 		}
+		var parseErr *csv.ParseError
+		if err != nil && rowErrors != nil && errors.As(err, &parseErr) {
+			// Tolerant mode: report the row and carry on with the next one
+			stats.malformedRecordCount++
+			raw := ""
+			if rawReader, ok := reader.(*rawRecordReader); ok {
+				raw = rawReader.rawText()
+			}
+			log.Printf("[SERVICE] [PROCESS_FILE] Skipping malformed record - JobID: %s, Line: %d, Error: %v",
+				job.ID, parseErr.StartLine+job.Options.SkipLines, parseErr.Err)
+			if err := rowErrors.add(entry.name, parseErr.StartLine+job.Options.SkipLines, raw, parseErr.Err); err != nil {
+				log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Malformed record budget exceeded - JobID: %s, Budget: %d",
+					job.ID, rowErrors.budget)
+				if errors.Is(err, errRowErrorBudget) {
+					return nil, newJobError(models.FailureMalformedRecord, parseErr.StartLine+job.Options.SkipLines, err)
+				}
+				return nil, err
+			}
+			continue
+		}
 		if err != nil {
 			log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to read record - JobID: %s, Record: %d, Error: %v",
-				job.ID, recordCount+1, err)
-			return fmt.Errorf("failed to read record: %w", err)
+				job.ID, stats.recordCount+1, err)
+			if errors.As(err, &parseErr) {
+				return nil, newJobError(models.FailureMalformedRecord, parseErr.StartLine+job.Options.SkipLines,
+					fmt.Errorf("failed to read record: %w", err))
+			}
+			return nil, fmt.Errorf("failed to read record: %w", err)
+		}
+		if err := csvService.chargeRow(job.Tenant); err != nil {
+			log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Daily row limit reached - JobID: %s, Record: %d",
+				job.ID, stats.recordCount+1)
+			return nil, newJobError(models.FailureDailyRowLimit, 0, err)
+		}
+		stats.recordCount++
+
+		if job.Options.VariableFields {
+			record = fitRecord(record, len(headers))
 		}
-		recordCount++
 
 		// Skip empty records
 		if csvService.isEmptyRecord(record) {
-			emptyRecordCount++
+			stats.emptyRecordCount++
 			log.Printf("[SERVICE] [PROCESS_FILE] Skipping empty record - JobID: %s, Record: %d",
-				job.ID, recordCount)
+				job.ID, stats.recordCount)
 			continue
 		}
 
-		// Check if any field contains a valid email
-		hasEmail := false
-		emailField := ""
-		for _, field := range record {
-			if emailRegex.MatchString(strings.TrimSpace(field)) {
-				hasEmail = true
-				emailField = field
-				emailFoundCount++
-				break
-			}
-		}
+		stats.profiler.add(record)
 
-		if hasEmail {
+		// Check if any field contains a valid email
+		newRecord, emailColumn := processRecord(record)
+		if emailColumn >= 0 {
+			stats.emailFoundCount++
+			stats.countEmail(strings.TrimSpace(record[emailColumn]))
 			log.Printf("[SERVICE] [PROCESS_FILE] Valid email found - JobID: %s, Record: %d, Email: %s",
-				job.ID, recordCount, emailField)
+				job.ID, stats.recordCount, record[emailColumn])
+		} else {
+			stats.countInvalid(record)
 		}
 
-		// Add email flag to record
-		newRecord := append(record, fmt.Sprintf("%t", hasEmail))
+		// Write record with email flag
 		if err := writer.Write(newRecord); err != nil {
 			log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] Failed to write record - JobID: %s, Record: %d, Error: %v",
-				job.ID, recordCount, err)
-			return fmt.Errorf("failed to write record: %w", err)
+				job.ID, stats.recordCount, err)
+			return nil, fmt.Errorf("failed to write record: %w", err)
 		}
 
 		// Log progress for large files
-		if recordCount%100 == 0 {
+		if stats.recordCount%100 == 0 {
 			log.Printf("[SERVICE] [PROCESS_FILE] Progress update - JobID: %s, ProcessedRecords: %d, EmailsFound: %d",
-				job.ID, recordCount, emailFoundCount)
+				job.ID, stats.recordCount, stats.emailFoundCount)
 		}
 	}
 
-	log.Printf("[SERVICE] [PROCESS_FILE] File processing statistics - JobID: %s, TotalRecords: %d, EmailsFound: %d, EmptyRecords: %d",
-		job.ID, recordCount, emailFoundCount, emptyRecordCount)
-
-	// Flush and close writer
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		log.Printf("[SERVICE] [PROCESS_FILE] [ERROR] CSV writer error - JobID: %s, Error: %v", job.ID, err)
-		return fmt.Errorf("CSV writer error: %w", err)
-	}
-
-	job.ProcessedFilePath = outputPath
+	return headers, nil
+}
 
-	// Get file size for logging
-	if fileInfo, err := os.Stat(outputPath); err == nil {
-		log.Printf("[SERVICE] [PROCESS_FILE] [SUCCESS] File processing completed - JobID: %s, InputSize: %d bytes, OutputSize: %d bytes, OutputPath: %s",
-			job.ID, fileHeader.Size, fileInfo.Size(), outputPath)
-	} else {
-		log.Printf("[SERVICE] [PROCESS_FILE] [SUCCESS] File processing completed - JobID: %s, OutputPath: %s",
-			job.ID, outputPath)
+// processRecord appends the has_email flag to a record. It also returns the
+// index of the first field holding a valid email, or -1 when there is none.
+func processRecord(record []string) ([]string, int) {
+	emailColumn := -1
+	for i, field := range record {
+		if emailRegex.MatchString(strings.TrimSpace(field)) {
+			emailColumn = i
+			break
+		}
 	}
-	return nil
+	return append(record, fmt.Sprintf("%t", emailColumn >= 0)), emailColumn
 }
 
 func (csvService *CsvProcessingService) isEmptyRecord(record []string) bool {
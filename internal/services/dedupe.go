@@ -0,0 +1,129 @@
+package services
+
+import (
+	"crypto/sha256"
+	"demandscience/internal/models"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// Dedupe modes select how an upload identical to a finished one is handled.
+const (
+	DedupeModeNew      = "new"
+	DedupeModeExisting = "existing"
+	DedupeModeOff      = "off"
+)
+
+// outputCache maps the cache key of every completed job to its ID, so an
+// identical upload with identical options can reuse the output. It is guarded
+// by jobsMutex.
+type outputCache struct {
+	jobs   map[string]string
+	hits   int64
+	misses int64
+}
+
+func newOutputCache() *outputCache {
+	return &outputCache{jobs: make(map[string]string)}
+}
+
+func normalizeDedupeMode(mode string) (string, error) {
+	switch strings.ToLower(mode) {
+	case "", DedupeModeNew:
+		return DedupeModeNew, nil
+	case DedupeModeExisting:
+		return DedupeModeExisting, nil
+	case DedupeModeOff:
+		return DedupeModeOff, nil
+	}
+	return "", errors.New("unsupported dedupe: " + mode)
+}
+
+// cacheKey identifies the output of a job: the tenant, the upload digest,
+// the archive entry and every option that changes the output. Tags and the
+// dedupe mode do not, so they are left out. Jobs without a digest have no
+// key. Tenants never share outputs, since each keeps its files under its own
+// storage prefix.
+func cacheKey(job *models.ProcessingJob) string {
+	if job.InputDigest == "" {
+		return ""
+	}
+	options := job.Options
+	options.Tags = nil
+	options.Dedupe = ""
+	encoded, _ := json.Marshal(options)
+
+	hash := sha256.New()
+	hash.Write([]byte(job.Tenant + "\n" + job.InputDigest + "\n" + job.ArchiveEntry + "\n"))
+	hash.Write(encoded)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// cachedJob returns the completed job whose output job can reuse, or nil.
+// Jobs with dedupe turned off are neither looked up nor counted.
+func (csvService *CsvProcessingService) cachedJob(job *models.ProcessingJob) *models.ProcessingJob {
+	key := cacheKey(job)
+	if key == "" || job.Options.Dedupe == DedupeModeOff {
+		return nil
+	}
+
+	csvService.jobsMutex.Lock()
+	defer csvService.jobsMutex.Unlock()
+
+	cached := csvService.jobs[csvService.cache.jobs[key]]
+	if cached == nil {
+		csvService.cache.misses++
+		return nil
+	}
+	csvService.cache.hits++
+	log.Printf("[SERVICE] [CACHE] Cache hit - JobID: %s, CachedJobID: %s", job.ID, cached.ID)
+	return cached
+}
+
+// cacheOutput records the output of a job that completed. It must be called
+// with jobsMutex held.
+func (csvService *CsvProcessingService) cacheOutput(job *models.ProcessingJob) {
+	if key := cacheKey(job); key != "" {
+		csvService.cache.jobs[key] = job.ID
+	}
+}
+
+// completeFromCache finishes job with the output of cached without
+// processing its upload again.
+func (csvService *CsvProcessingService) completeFromCache(job, cached *models.ProcessingJob) {
+	completedAt := time.Now()
+
+	csvService.jobsMutex.Lock()
+	job.Status = models.JobStatusCompleted
+	job.CachedFrom = cached.ID
+	job.ProcessedFileKey = cached.ProcessedFileKey
+	job.ErrorFileKey = cached.ErrorFileKey
+	job.ProfileKey = cached.ProfileKey
+	// The cached job read the same upload, so its retained copy serves re-runs
+	job.Input = cached.Input
+	job.RowErrorCount = cached.RowErrorCount
+	job.DetectedEncoding = cached.DetectedEncoding
+	job.Stats = cached.Stats
+	job.CompletedAt = &completedAt
+	csvService.jobs[job.ID] = job
+	csvService.index.add(job)
+	csvService.jobsMutex.Unlock()
+
+	log.Printf("[SERVICE] [CACHE] Job completed from cache - JobID: %s, CachedJobID: %s", job.ID, cached.ID)
+}
+
+// GetCacheStats returns the hit and miss counts of the upload cache.
+func (csvService *CsvProcessingService) GetCacheStats() models.CacheStats {
+	csvService.jobsMutex.RLock()
+	defer csvService.jobsMutex.RUnlock()
+
+	return models.CacheStats{
+		Hits:    csvService.cache.hits,
+		Misses:  csvService.cache.misses,
+		Entries: len(csvService.cache.jobs),
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"demandscience/internal/models"
+	"strings"
+)
+
+// Reasons a row has no valid email, from the first field that contains an @.
+const (
+	InvalidReasonNoEmailField      = "no_email_field"
+	InvalidReasonMissingLocalPart  = "missing_local_part"
+	InvalidReasonMissingDomain     = "missing_domain"
+	InvalidReasonMultipleAt        = "multiple_at"
+	InvalidReasonMissingTLD        = "missing_tld"
+	InvalidReasonInvalidCharacters = "invalid_characters"
+)
+
+// reportTopDomains is the number of email domains kept in the job stats.
+const reportTopDomains = 10
+
+// countEmail records the domain of a valid email address.
+func (stats *recordStats) countEmail(address string) {
+	if stats.domains == nil {
+		stats.domains = make(map[string]int)
+	}
+	domain := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	// Past the limit only domains already seen are counted, keeping memory bounded
+	if _, ok := stats.domains[domain]; ok || len(stats.domains) < profileExactDistinct {
+		stats.domains[domain]++
+	}
+}
+
+// countInvalid records why a non-empty row has no valid email.
+func (stats *recordStats) countInvalid(record []string) {
+	if stats.invalidReasons == nil {
+		stats.invalidReasons = make(map[string]int)
+	}
+	stats.invalidReasons[invalidEmailReason(record)]++
+}
+
+func invalidEmailReason(record []string) string {
+	candidate := ""
+	for _, field := range record {
+		if field = strings.TrimSpace(field); strings.Contains(field, "@") {
+			candidate = field
+			break
+		}
+	}
+
+	at := strings.Index(candidate, "@")
+	switch {
+	case candidate == "":
+		return InvalidReasonNoEmailField
+	case strings.Count(candidate, "@") > 1:
+		return InvalidReasonMultipleAt
+	case at == 0:
+		return InvalidReasonMissingLocalPart
+	case at == len(candidate)-1:
+		return InvalidReasonMissingDomain
+	}
+
+	domain := candidate[at+1:]
+	dot := strings.LastIndex(domain, ".")
+	if dot < 0 || len(domain)-dot-1 < 2 {
+		return InvalidReasonMissingTLD
+	}
+	return InvalidReasonInvalidCharacters
+}
+
+// jobStats converts the counters of a finished job for the job record.
+func (stats *recordStats) jobStats() *models.JobStats {
+	invalidReasons := make(map[string]int, len(stats.invalidReasons))
+	for reason, count := range stats.invalidReasons {
+		invalidReasons[reason] = count
+	}
+	return &models.JobStats{
+		TotalRecords:     stats.recordCount,
+		EmailsFound:      stats.emailFoundCount,
+		EmptyRecords:     stats.emptyRecordCount,
+		MalformedRecords: stats.malformedRecordCount,
+		TopDomains:       topValueCounts(stats.domains, reportTopDomains),
+		InvalidReasons:   invalidReasons,
+	}
+}
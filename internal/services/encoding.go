@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const (
+	EncodingAuto        = "auto"
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+	EncodingLatin1      = "iso-8859-1"
+)
+
+// encodingProbeSize is how much of the input is inspected when no BOM is present.
+const encodingProbeSize = 64 * 1024
+
+var encodingAliases = map[string]string{
+	"":             EncodingAuto,
+	"auto":         EncodingAuto,
+	"utf-8":        EncodingUTF8,
+	"utf8":         EncodingUTF8,
+	"utf-16":       EncodingUTF16LE,
+	"utf-16le":     EncodingUTF16LE,
+	"utf16le":      EncodingUTF16LE,
+	"utf-16be":     EncodingUTF16BE,
+	"utf16be":      EncodingUTF16BE,
+	"windows-1252": EncodingWindows1252,
+	"cp1252":       EncodingWindows1252,
+	"iso-8859-1":   EncodingLatin1,
+	"latin1":       EncodingLatin1,
+	"latin-1":      EncodingLatin1,
+}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// normalizeEncoding maps a user supplied encoding name onto one of the Encoding constants.
+func normalizeEncoding(name string) (string, error) {
+	normalized, ok := encodingAliases[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return "", errors.New("unsupported encoding: " + name)
+	}
+	return normalized, nil
+}
+
+// decodeInput wraps reader so that it yields UTF-8. When forced is EncodingAuto the
+// encoding is taken from the BOM, or probed from the first bytes of the input.
+// The name of the encoding that was applied is returned alongside the reader.
+func decodeInput(reader io.Reader, forced string) (io.Reader, string, error) {
+	buffered := bufio.NewReaderSize(reader, encodingProbeSize)
+	sample, err := buffered.Peek(encodingProbeSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+
+	name := forced
+	if name == EncodingAuto {
+		name = detectEncoding(sample)
+	}
+
+	// A UTF-8 BOM would otherwise end up glued to the first header.
+	if name == EncodingUTF8 && bytes.HasPrefix(sample, bomUTF8) {
+		if _, err := buffered.Discard(len(bomUTF8)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var decoder encoding.Encoding
+	switch name {
+	case EncodingUTF8:
+		return buffered, name, nil
+	case EncodingUTF16LE:
+		decoder = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case EncodingUTF16BE:
+		decoder = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	case EncodingWindows1252:
+		decoder = charmap.Windows1252
+	case EncodingLatin1:
+		decoder = charmap.ISO8859_1
+	default:
+		return nil, "", errors.New("unsupported encoding: " + name)
+	}
+
+	return transform.NewReader(buffered, decoder.NewDecoder()), name, nil
+}
+
+// detectEncoding guesses the encoding of sample, preferring a BOM when present.
+func detectEncoding(sample []byte) string {
+	switch {
+	case bytes.HasPrefix(sample, bomUTF8):
+		return EncodingUTF8
+	case bytes.HasPrefix(sample, bomUTF16LE):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(sample, bomUTF16BE):
+		return EncodingUTF16BE
+	}
+
+	// BOM-less UTF-16 text that is mostly ASCII has a zero in every other byte.
+	evenZeros, oddZeros := 0, 0
+	for i, b := range sample {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+	if len(sample) >= 2 {
+		half := len(sample) / 2
+		if oddZeros > half/2 && evenZeros < oddZeros/4 {
+			return EncodingUTF16LE
+		}
+		if evenZeros > half/2 && oddZeros < evenZeros/4 {
+			return EncodingUTF16BE
+		}
+	}
+
+	if utf8.Valid(trimPartialRune(sample)) {
+		return EncodingUTF8
+	}
+
+	// Windows-1252 assigns printable characters to 0x80-0x9F where Latin-1 has
+	// control codes, so their presence tells the two apart.
+	for _, b := range sample {
+		if b >= 0x80 && b <= 0x9F {
+			return EncodingWindows1252
+		}
+	}
+	return EncodingLatin1
+}
+
+// trimPartialRune drops a multi-byte UTF-8 sequence cut off at the end of the probe window.
+func trimPartialRune(sample []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(sample); i++ {
+		b := sample[len(sample)-i]
+		if !utf8.RuneStart(b) {
+			continue
+		}
+		if !utf8.FullRune(sample[len(sample)-i:]) {
+			return sample[:len(sample)-i]
+		}
+		break
+	}
+	return sample
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"demandscience/internal/models"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	hotFolderDoneDir   = "done"
+	hotFolderFailedDir = "failed"
+)
+
+// HotFolderWatcher polls an inbox directory and processes every new CSV file
+// through a CsvProcessingService, so the jobs are also visible in the API.
+// Processed files are written to the outbox and inputs are moved to done/ or
+// failed/ inside the inbox. Polling is used instead of file system events so
+// the watcher also works on network shares.
+type HotFolderWatcher struct {
+	csvService *CsvProcessingService
+	inbox      string
+	outbox     string
+	// PollInterval is the time between two scans of the inbox.
+	PollInterval time.Duration
+	// StableFor is how long a file's size and modification time must stay
+	// unchanged before it is considered fully written.
+	StableFor time.Duration
+
+	candidates map[string]hotFolderCandidate
+	running    map[string]string
+}
+
+// hotFolderCandidate is the last observed state of a file in the inbox.
+type hotFolderCandidate struct {
+	size      int64
+	modTime   time.Time
+	firstSeen time.Time
+}
+
+func DSHotFolderWatcher(csvService *CsvProcessingService, inbox, outbox string) (*HotFolderWatcher, error) {
+	log.Printf("[SERVICE] [HOT_FOLDER] Initializing hot folder watcher - Inbox: %s, Outbox: %s", inbox, outbox)
+
+	for _, dir := range []string{inbox, outbox, filepath.Join(inbox, hotFolderDoneDir), filepath.Join(inbox, hotFolderFailedDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create hot folder directory: %w", err)
+		}
+	}
+
+	return &HotFolderWatcher{
+		csvService:   csvService,
+		inbox:        inbox,
+		outbox:       outbox,
+		PollInterval: 2 * time.Second,
+		StableFor:    5 * time.Second,
+		candidates:   make(map[string]hotFolderCandidate),
+		running:      make(map[string]string),
+	}, nil
+}
+
+// Run scans the inbox every PollInterval until ctx is cancelled.
+func (watcher *HotFolderWatcher) Run(ctx context.Context) {
+	log.Printf("[SERVICE] [HOT_FOLDER] Watching inbox - Inbox: %s, PollInterval: %v, StableFor: %v",
+		watcher.inbox, watcher.PollInterval, watcher.StableFor)
+
+	ticker := time.NewTicker(watcher.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[SERVICE] [HOT_FOLDER] Stopped watching inbox - Inbox: %s", watcher.inbox)
+			return
+		case <-ticker.C:
+			watcher.Scan()
+		}
+	}
+}
+
+// Scan makes a single pass: finished jobs are delivered to the outbox and
+// stable new files are started. It is not safe to call concurrently.
+func (watcher *HotFolderWatcher) Scan() {
+	watcher.collectFinishedJobs()
+
+	entries, err := os.ReadDir(watcher.inbox)
+	if err != nil {
+		log.Printf("[SERVICE] [HOT_FOLDER] [ERROR] Failed to read inbox - Inbox: %s, Error: %v", watcher.inbox, err)
+		return
+	}
+
+	now := time.Now()
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.EqualFold(filepath.Ext(entry.Name()), ".csv") ||
+			strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(watcher.inbox, entry.Name())
+		present[path] = true
+		if watcher.isRunning(path) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		previous, seen := watcher.candidates[path]
+		if !seen || previous.size != info.Size() || !previous.modTime.Equal(info.ModTime()) {
+			watcher.candidates[path] = hotFolderCandidate{size: info.Size(), modTime: info.ModTime(), firstSeen: now}
+			continue
+		}
+		if now.Sub(previous.firstSeen) < watcher.StableFor {
+			continue
+		}
+
+		delete(watcher.candidates, path)
+		watcher.startFile(path, info.Size())
+	}
+
+	for path := range watcher.candidates {
+		if !present[path] {
+			delete(watcher.candidates, path)
+		}
+	}
+}
+
+func (watcher *HotFolderWatcher) startFile(path string, size int64) {
+	source := localFileSource{path: path, name: filepath.Base(path), size: size}
+	jobID, err := watcher.csvService.processUpload(source, models.ProcessingOptions{})
+	if err != nil {
+		log.Printf("[SERVICE] [HOT_FOLDER] [ERROR] Failed to start job - File: %s, Error: %v", path, err)
+		watcher.moveInput(path, hotFolderFailedDir, "")
+		return
+	}
+
+	watcher.running[jobID] = path
+	log.Printf("[SERVICE] [HOT_FOLDER] Job started for inbox file - JobID: %s, File: %s", jobID, path)
+}
+
+// collectFinishedJobs writes the output of completed jobs to the outbox and
+// moves their input to done/, or to failed/ when the job or the copy failed.
+func (watcher *HotFolderWatcher) collectFinishedJobs() {
+	for jobID, path := range watcher.running {
+		job := watcher.csvService.GetJob(jobID)
+		status := models.JobStatusFailed
+		if job != nil {
+			watcher.csvService.jobsMutex.RLock()
+			status = job.Status
+			watcher.csvService.jobsMutex.RUnlock()
+		}
+		if status == models.JobStatusInProgress {
+			continue
+		}
+		delete(watcher.running, jobID)
+
+		if status == models.JobStatusCompleted {
+			if err := watcher.deliverOutput(job, path); err != nil {
+				log.Printf("[SERVICE] [HOT_FOLDER] [ERROR] Failed to write output - JobID: %s, Error: %v", jobID, err)
+				watcher.moveInput(path, hotFolderFailedDir, jobID)
+				continue
+			}
+			watcher.moveInput(path, hotFolderDoneDir, jobID)
+			continue
+		}
+
+		log.Printf("[SERVICE] [HOT_FOLDER] [ERROR] Job failed - JobID: %s, File: %s", jobID, path)
+		watcher.moveInput(path, hotFolderFailedDir, jobID)
+	}
+}
+
+// deliverOutput writes the processed file under a temporary name and renames
+// it, so consumers of the outbox never see a partial file.
+func (watcher *HotFolderWatcher) deliverOutput(job *models.ProcessingJob, inputPath string) error {
+	data, err := watcher.csvService.GetProcessedFile(job.ID)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath)) + "_processed." + OutputExtension(job.Options.OutputFormat)
+	destination := availablePath(filepath.Join(watcher.outbox, name), job.ID)
+	temporary := filepath.Join(watcher.outbox, "."+job.ID+".tmp")
+
+	if err := os.WriteFile(temporary, data, 0644); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	if err := os.Rename(temporary, destination); err != nil {
+		os.Remove(temporary)
+		return err
+	}
+
+	log.Printf("[SERVICE] [HOT_FOLDER] [SUCCESS] Output written to outbox - JobID: %s, Path: %s", job.ID, destination)
+	return nil
+}
+
+func (watcher *HotFolderWatcher) moveInput(path, dir, jobID string) {
+	destination := availablePath(filepath.Join(watcher.inbox, dir, filepath.Base(path)), jobID)
+	if err := os.Rename(path, destination); err != nil {
+		log.Printf("[SERVICE] [HOT_FOLDER] [ERROR] Failed to move input - File: %s, Destination: %s, Error: %v",
+			path, destination, err)
+		return
+	}
+	log.Printf("[SERVICE] [HOT_FOLDER] Input moved - File: %s, Destination: %s", path, destination)
+}
+
+func (watcher *HotFolderWatcher) isRunning(path string) bool {
+	for _, runningPath := range watcher.running {
+		if runningPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// availablePath returns path, or path prefixed with the job ID (or a
+// timestamp) when a file with that name already exists.
+func availablePath(path, jobID string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	prefix := jobID
+	if prefix == "" {
+		prefix = time.Now().Format("20060102T150405.000000000")
+	}
+	return filepath.Join(filepath.Dir(path), prefix+"_"+filepath.Base(path))
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"crypto/sha256"
+	"demandscience/internal/models"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"time"
+)
+
+// IdempotencyWindow is how long an Idempotency-Key is remembered after its
+// upload was accepted; zero turns the header off.
+var IdempotencyWindow = 24 * time.Hour
+
+const maxIdempotencyKeyLength = 255
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key comes back with a different request.
+	ErrIdempotencyKeyReused = errors.New("Idempotency-Key was already used for a different request")
+	// ErrIdempotencyKeyInvalid is returned for a key that is too long.
+	ErrIdempotencyKeyInvalid = errors.New("Idempotency-Key must be at most 255 characters")
+
+	errIdempotentUploadAborted = errors.New("upload aborted")
+)
+
+func init() {
+	if value := os.Getenv("IDEMPOTENCY_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid IDEMPOTENCY_WINDOW in .env: %v", err)
+		}
+		IdempotencyWindow = window
+	}
+}
+
+// idempotentUpload is the outcome of the first request with a key. done is
+// closed once jobIDs or err are set; expiresAt is zero until then.
+type idempotentUpload struct {
+	fingerprint string
+	jobIDs      []string
+	err         error
+	done        chan struct{}
+	expiresAt   time.Time
+}
+
+// UploadFingerprint hashes what an upload request asks for: the file content
+// and name, or the source URL, and the options. Unlike a hash of the raw body,
+// it does not change when a client retries with a new multipart boundary.
+// For a file it also returns the SHA-256 of its content, which callers pass
+// on as ProcessingOptions.InputDigest so the file is hashed only once.
+func UploadFingerprint(fileHeader *multipart.FileHeader, sourceURL string, options models.ProcessingOptions) (string, string, error) {
+	hash := sha256.New()
+	digest := ""
+	if fileHeader != nil {
+		var err error
+		if digest, err = fileDigest(fileHeader); err != nil {
+			return "", "", err
+		}
+		hash.Write([]byte("file\n" + fileHeader.Filename + "\n" + digest + "\n"))
+	} else {
+		hash.Write([]byte("url\n" + sourceURL + "\n"))
+	}
+
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return "", "", err
+	}
+	hash.Write(encoded)
+	return hex.EncodeToString(hash.Sum(nil)), digest, nil
+}
+
+func fileDigest(fileHeader *multipart.FileHeader) (string, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// IdempotentUpload runs start once per key of an API key owner within
+// IdempotencyWindow, so keys of different owners never collide. A replay
+// with the same fingerprint returns the job IDs of the first request, waiting
+// for it when it is still running, and reports true. A replay with another
+// fingerprint fails with ErrIdempotencyKeyReused. A failed upload releases
+// its key so the request can be retried.
+func (csvService *CsvProcessingService) IdempotentUpload(owner, key, fingerprint string,
+	start func() ([]string, error)) ([]string, bool, error) {
+	if IdempotencyWindow <= 0 {
+		jobIDs, err := start()
+		return jobIDs, false, err
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, false, ErrIdempotencyKeyInvalid
+	}
+	key = owner + "/" + key
+
+	for {
+		csvService.idempotencyMutex.Lock()
+		upload := csvService.idempotency[key]
+		if upload != nil && !upload.expiresAt.IsZero() && time.Now().After(upload.expiresAt) {
+			delete(csvService.idempotency, key)
+			upload = nil
+		}
+		if upload == nil {
+			upload = &idempotentUpload{fingerprint: fingerprint, done: make(chan struct{})}
+			csvService.idempotency[key] = upload
+			csvService.idempotencyMutex.Unlock()
+			return csvService.runIdempotentUpload(key, upload, start)
+		}
+		csvService.idempotencyMutex.Unlock()
+
+		if upload.fingerprint != fingerprint {
+			log.Printf("[SERVICE] [IDEMPOTENCY] [ERROR] Key reused with a different request - Key: %s", key)
+			return nil, false, ErrIdempotencyKeyReused
+		}
+
+		<-upload.done
+		if upload.err == nil {
+			log.Printf("[SERVICE] [IDEMPOTENCY] Replaying upload - Key: %s, Jobs: %d", key, len(upload.jobIDs))
+			return upload.jobIDs, true, nil
+		}
+		// The first request failed and released the key, so try again
+	}
+}
+
+// runIdempotentUpload runs start for the first request with key. The outcome
+// is recorded in a deferred call, so a panicking start still releases the key
+// and wakes the replays waiting for it.
+func (csvService *CsvProcessingService) runIdempotentUpload(key string, upload *idempotentUpload,
+	start func() ([]string, error)) (jobIDs []string, replayed bool, err error) {
+	err = errIdempotentUploadAborted
+	defer func() {
+		csvService.idempotencyMutex.Lock()
+		upload.jobIDs = jobIDs
+		upload.err = err
+		if err != nil {
+			delete(csvService.idempotency, key)
+		} else {
+			upload.expiresAt = time.Now().Add(IdempotencyWindow)
+		}
+		csvService.idempotencyMutex.Unlock()
+		close(upload.done)
+	}()
+
+	jobIDs, err = start()
+	return jobIDs, false, err
+}
+
+// ExpireIdempotencyKeys forgets keys older than IdempotencyWindow and returns
+// how many were removed.
+func (csvService *CsvProcessingService) ExpireIdempotencyKeys() int {
+	now := time.Now()
+	removed := 0
+
+	csvService.idempotencyMutex.Lock()
+	for key, upload := range csvService.idempotency {
+		if !upload.expiresAt.IsZero() && now.After(upload.expiresAt) {
+			delete(csvService.idempotency, key)
+			removed++
+		}
+	}
+	csvService.idempotencyMutex.Unlock()
+
+	if removed > 0 {
+		log.Printf("[SERVICE] [IDEMPOTENCY] Expired idempotency keys removed - Count: %d", removed)
+	}
+	return removed
+}
+
+func (csvService *CsvProcessingService) expireIdempotencyKeysPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		csvService.ExpireIdempotencyKeys()
+	}
+}
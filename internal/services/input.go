@@ -0,0 +1,145 @@
+package services
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	uploadKindCSV  = "csv"
+	uploadKindGzip = "gzip"
+	uploadKindZip  = "zip"
+	uploadKindXLSX = "xlsx"
+
+	// xlsxMaxExpansion bounds the worksheet XML of an xlsx upload to this
+	// multiple of the upload size limit, since XML is many times larger than
+	// the cell data it holds.
+	xlsxMaxExpansion = 20
+)
+
+// recordReader yields one row of fields per call and io.EOF at the end.
+// *csv.Reader and *xlsxRowReader both satisfy it.
+type recordReader interface {
+	Read() ([]string, error)
+}
+
+// uploadSource is the file a job reads from: a multipart upload or a file
+// already on disk. Open may be called more than once.
+type uploadSource interface {
+	Name() string
+	Size() int64
+	Open() (multipart.File, error)
+}
+
+type multipartSource struct {
+	header *multipart.FileHeader
+}
+
+func (source multipartSource) Name() string                  { return source.header.Filename }
+func (source multipartSource) Size() int64                   { return source.header.Size }
+func (source multipartSource) Open() (multipart.File, error) { return source.header.Open() }
+
+// localFileSource is an upload stored on disk under the service's storage
+// directory, such as a completed resumable upload. digest is the SHA-256 of
+// the file when it was hashed while being written, "" otherwise.
+type localFileSource struct {
+	path   string
+	name   string
+	size   int64
+	digest string
+}
+
+func (source localFileSource) Name() string                  { return source.name }
+func (source localFileSource) Size() int64                   { return source.size }
+func (source localFileSource) Open() (multipart.File, error) { return os.Open(source.path) }
+
+// inputEntry is one tabular stream inside an upload. Plain, gzip and xlsx
+// uploads have a single entry, zip uploads have one per CSV file in the archive.
+// CSV entries provide open; spreadsheet entries provide openRecords instead.
+type inputEntry struct {
+	name           string
+	compressedSize int64
+	open           func() (io.ReadCloser, error)
+	openRecords    func() (recordReader, io.Closer, error)
+}
+
+// uploadKind classifies an upload by its file name, returning "" when unsupported.
+func uploadKind(filename string) string {
+	filename = strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(filename, ".csv"):
+		return uploadKindCSV
+	case strings.HasSuffix(filename, ".csv.gz"):
+		return uploadKindGzip
+	case strings.HasSuffix(filename, ".zip"):
+		return uploadKindZip
+	case strings.HasSuffix(filename, ".xlsx"):
+		return uploadKindXLSX
+	}
+	return ""
+}
+
+// openInputEntries lists the tabular streams of an upload. When entryName is set
+// only that zip entry is returned; sheet selects the worksheet of an xlsx upload.
+// maxSize is the upload size limit of the tenant.
+func openInputEntries(file multipart.File, filename string, size int64, entryName, sheet string, maxSize int64) ([]inputEntry, error) {
+	switch uploadKind(filename) {
+	case uploadKindGzip:
+		return []inputEntry{{
+			name:           strings.TrimSuffix(path.Base(filename), path.Ext(filename)),
+			compressedSize: size,
+			open: func() (io.ReadCloser, error) {
+				return gzip.NewReader(file)
+			},
+		}}, nil
+
+	case uploadKindZip:
+		files, err := zipCSVEntries(file, size)
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []inputEntry
+		for _, zipFile := range files {
+			if entryName != "" && zipFile.Name != entryName {
+				continue
+			}
+			zipFile := zipFile
+			entries = append(entries, inputEntry{
+				name:           zipFile.Name,
+				compressedSize: int64(zipFile.CompressedSize64),
+				open:           zipFile.Open,
+			})
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("zip entry not found: %s", entryName)
+		}
+		return entries, nil
+
+	case uploadKindXLSX:
+		return []inputEntry{{
+			name: filename,
+			openRecords: func() (recordReader, io.Closer, error) {
+				guard := newDecompressionGuard(maxSize * xlsxMaxExpansion)
+				reader, err := openXLSXSheet(file, size, sheet, guard)
+				if err != nil {
+					return nil, nil, err
+				}
+				return reader, reader, nil
+			},
+		}}, nil
+
+	default:
+		return []inputEntry{{
+			name: filename,
+			open: func() (io.ReadCloser, error) {
+				return io.NopCloser(file), nil
+			},
+		}}, nil
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"demandscience/internal/models"
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// JobTimeout bounds the processing time of a job; zero means no limit.
+var JobTimeout time.Duration
+
+var (
+	// ErrJobNotFound is returned for an unknown job ID.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotRunning is returned when cancelling a job that already finished.
+	ErrJobNotRunning = errors.New("job is not in progress")
+)
+
+func init() {
+	if value := os.Getenv("JOB_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid JOB_TIMEOUT in .env: %v", err)
+		}
+		JobTimeout = timeout
+	}
+}
+
+// jobError tags a processing error with its failure code and the input line
+// it happened on, when known.
+type jobError struct {
+	code string
+	line int
+	err  error
+}
+
+func newJobError(code string, line int, err error) error {
+	return &jobError{code: code, line: line, err: err}
+}
+
+func (failure *jobError) Error() string {
+	return failure.err.Error()
+}
+
+func (failure *jobError) Unwrap() error {
+	return failure.err
+}
+
+// classifyFailure turns the error a job failed with into the failure recorded
+// on the job. Errors that were not tagged are I/O errors.
+func classifyFailure(err error) *models.JobFailure {
+	failure := &models.JobFailure{Code: models.FailureIOError, Message: err.Error()}
+
+	var tagged *jobError
+	switch {
+	case errors.Is(err, context.Canceled):
+		failure.Code = models.FailureCancelled
+		failure.Message = "job was cancelled"
+	case errors.Is(err, context.DeadlineExceeded):
+		failure.Code = models.FailureTimeout
+		failure.Message = "job did not finish within JOB_TIMEOUT"
+	case errors.As(err, &tagged):
+		failure.Code = tagged.code
+		failure.Line = tagged.line
+	}
+	return failure
+}
+
+// jobContext returns the context a job is processed under, bounded by
+// JobTimeout, and registers its cancel function for CancelJob.
+func (csvService *CsvProcessingService) jobContext(job *models.ProcessingJob) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if JobTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), JobTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	csvService.jobsMutex.Lock()
+	csvService.cancels[job.ID] = cancel
+	csvService.jobsMutex.Unlock()
+
+	return ctx, func() {
+		cancel()
+		csvService.jobsMutex.Lock()
+		delete(csvService.cancels, job.ID)
+		csvService.jobsMutex.Unlock()
+	}
+}
+
+// CancelJob stops a job that is still in progress. The job then fails with
+// the CANCELLED code.
+func (csvService *CsvProcessingService) CancelJob(jobID string) error {
+	csvService.jobsMutex.RLock()
+	job := csvService.jobs[jobID]
+	cancel := csvService.cancels[jobID]
+	csvService.jobsMutex.RUnlock()
+
+	if job == nil {
+		return ErrJobNotFound
+	}
+	if cancel == nil {
+		return ErrJobNotRunning
+	}
+
+	log.Printf("[SERVICE] [CANCEL] Cancelling job - JobID: %s", jobID)
+	cancel()
+	return nil
+}
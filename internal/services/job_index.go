@@ -0,0 +1,211 @@
+package services
+
+import (
+	"demandscience/internal/models"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultJobListLimit is the page size of job listings that do not set one.
+	DefaultJobListLimit = 20
+	// MaxJobListLimit caps the page size of job listings.
+	MaxJobListLimit = 100
+	maxTags         = 10
+	maxTagLength    = 64
+)
+
+// ErrInvalidCursor is returned for a job listing cursor that was not issued by ListJobs.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// jobIndex keeps jobs ordered by creation so listings can seek to a cursor or
+// time range with a binary search instead of scanning every job. Jobs with a
+// tag are also kept in a per-tag list in the same order. It is guarded by
+// jobsMutex.
+type jobIndex struct {
+	ordered []*models.ProcessingJob
+	byTag   map[string][]*models.ProcessingJob
+}
+
+func newJobIndex() *jobIndex {
+	return &jobIndex{byTag: make(map[string][]*models.ProcessingJob)}
+}
+
+// jobPosition is the sort key of a job: creation time, then ID.
+type jobPosition struct {
+	createdAt time.Time
+	id        string
+}
+
+func (position jobPosition) before(job *models.ProcessingJob) bool {
+	if !position.createdAt.Equal(job.CreatedAt) {
+		return position.createdAt.Before(job.CreatedAt)
+	}
+	return position.id < job.ID
+}
+
+func (position jobPosition) after(job *models.ProcessingJob) bool {
+	if !position.createdAt.Equal(job.CreatedAt) {
+		return position.createdAt.After(job.CreatedAt)
+	}
+	return position.id > job.ID
+}
+
+func (index *jobIndex) add(job *models.ProcessingJob) {
+	index.ordered = insertJob(index.ordered, job)
+	for _, tag := range job.Options.Tags {
+		index.byTag[tag] = insertJob(index.byTag[tag], job)
+	}
+}
+
+// insertJob adds job to an ordered list. Jobs are created in order, so this
+// is almost always an append.
+func insertJob(jobs []*models.ProcessingJob, job *models.ProcessingJob) []*models.ProcessingJob {
+	position := jobPosition{createdAt: job.CreatedAt, id: job.ID}
+	at := sort.Search(len(jobs), func(i int) bool { return position.before(jobs[i]) })
+	jobs = append(jobs, nil)
+	copy(jobs[at+1:], jobs[at:])
+	jobs[at] = job
+	return jobs
+}
+
+// list returns up to limit jobs matching query, newest first, and whether more follow.
+func (index *jobIndex) list(query models.JobQuery, after *jobPosition, limit int) ([]*models.ProcessingJob, bool) {
+	candidates := index.ordered
+	if query.Tag != "" {
+		candidates = index.byTag[query.Tag]
+	}
+
+	// Everything from end onwards is newer than the cursor or the time range
+	end := len(candidates)
+	if after != nil {
+		end = sort.Search(len(candidates), func(i int) bool { return !after.after(candidates[i]) })
+	}
+	if !query.CreatedBefore.IsZero() {
+		end = min(end, sort.Search(len(candidates), func(i int) bool {
+			return !candidates[i].CreatedAt.Before(query.CreatedBefore)
+		}))
+	}
+
+	fileName := strings.ToLower(query.FileName)
+	var jobs []*models.ProcessingJob
+	for i := end - 1; i >= 0; i-- {
+		job := candidates[i]
+		if !query.CreatedAfter.IsZero() && job.CreatedAt.Before(query.CreatedAfter) {
+			break
+		}
+		if query.Status != "" && job.Status != query.Status {
+			continue
+		}
+		if fileName != "" && !strings.Contains(strings.ToLower(job.OriginalFileName), fileName) {
+			continue
+		}
+		if query.CreatedBy != "" && job.CreatedBy != query.CreatedBy {
+			continue
+		}
+		if job.Tenant != query.Tenant {
+			continue
+		}
+		if len(jobs) == limit {
+			return jobs, true
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, false
+}
+
+// ListJobs returns a page of jobs, newest first. Pass the returned NextCursor
+// back in query.Cursor for the following page.
+func (csvService *CsvProcessingService) ListJobs(query models.JobQuery) (*models.JobListResponse, error) {
+	limit := query.Limit
+	switch {
+	case limit == 0:
+		limit = DefaultJobListLimit
+	case limit < 0 || limit > MaxJobListLimit:
+		return nil, fmt.Errorf("limit must be between 1 and %d", MaxJobListLimit)
+	}
+
+	var after *jobPosition
+	if query.Cursor != "" {
+		position, err := decodeJobCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &position
+	}
+
+	csvService.jobsMutex.RLock()
+	defer csvService.jobsMutex.RUnlock()
+
+	jobs, more := csvService.index.list(query, after, limit)
+	response := &models.JobListResponse{Jobs: make([]models.JobSummary, 0, len(jobs))}
+	for _, job := range jobs {
+		response.Jobs = append(response.Jobs, models.JobSummary{
+			ID:               job.ID,
+			Status:           job.Status,
+			OriginalFileName: job.OriginalFileName,
+			Tags:             job.Options.Tags,
+			BatchID:          job.BatchID,
+			CreatedAt:        job.CreatedAt,
+			CompletedAt:      job.CompletedAt,
+		})
+	}
+	if more {
+		last := jobs[len(jobs)-1]
+		response.NextCursor = encodeJobCursor(jobPosition{createdAt: last.CreatedAt, id: last.ID})
+	}
+
+	log.Printf("[SERVICE] [LIST_JOBS] Jobs listed - Returned: %d, More: %t, Status: %s, Tag: %s",
+		len(response.Jobs), more, query.Status, query.Tag)
+	return response, nil
+}
+
+func encodeJobCursor(position jobPosition) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(strconv.FormatInt(position.createdAt.UnixNano(), 10) + "|" + position.id))
+}
+
+func decodeJobCursor(cursor string) (jobPosition, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return jobPosition{}, ErrInvalidCursor
+	}
+	nanos, id, found := strings.Cut(string(raw), "|")
+	if !found || id == "" {
+		return jobPosition{}, ErrInvalidCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return jobPosition{}, ErrInvalidCursor
+	}
+	return jobPosition{createdAt: time.Unix(0, unixNano), id: id}, nil
+}
+
+// normalizeTags splits comma separated tags, trims them and drops duplicates.
+func normalizeTags(values []string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || seen[tag] {
+				continue
+			}
+			if len(tag) > maxTagLength {
+				return nil, fmt.Errorf("tags must be at most %d characters", maxTagLength)
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", maxTags)
+	}
+	return tags, nil
+}
@@ -0,0 +1,449 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"demandscience/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwtClockSkew tolerates clocks of the issuer and this server drifting apart.
+	jwtClockSkew = time.Minute
+	// jwksMinRefresh limits how often an unknown key ID triggers a JWKS reload.
+	jwksMinRefresh = time.Minute
+	// jwksRetryInterval limits how often a JWKS that failed to load is fetched again.
+	jwksRetryInterval = time.Second
+	maxJWKSSize       = 1 << 20
+)
+
+// ErrInvalidToken is wrapped by every bearer token validation failure.
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// TokenVerifierConfig configures bearer token validation. Exactly one of
+// JWKSFile and JWKSURL is set.
+type TokenVerifierConfig struct {
+	JWKSFile string
+	JWKSURL  string
+	Issuer   string
+	Audience string
+	// TenantClaim and RolesClaim name the claims holding the tenant and the
+	// roles; roles named upload, read, admin or operator become scopes. The
+	// operator role is only honoured for the default tenant.
+	TenantClaim string
+	RolesClaim  string
+	// DefaultTenant is the tenant of tokens without the tenant claim. Such
+	// tokens are rejected unless AllowDefaultTenant is set; the empty
+	// DefaultTenant is the default tenant.
+	DefaultTenant      string
+	AllowDefaultTenant bool
+	// RefreshInterval is how long keys fetched from JWKSURL are cached.
+	RefreshInterval time.Duration
+}
+
+// TokenVerifier validates JWT bearer tokens against the keys of a JWKS.
+// RS256, RS384, RS512, ES256, ES384 and ES512 signatures are supported.
+// fetchedAt is the time of the last successful load, attemptedAt that of the
+// last load whatever its outcome.
+type TokenVerifier struct {
+	config      TokenVerifierConfig
+	client      *http.Client
+	keys        map[string]crypto.PublicKey // by key ID
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	keysMutex   sync.RWMutex
+	fetchMutex  sync.Mutex
+}
+
+// DSTokenVerifierFromEnv configures a verifier from JWT_JWKS_FILE or
+// JWT_JWKS_URL, JWT_ISSUER, JWT_AUDIENCE, JWT_TENANT_CLAIM, JWT_ROLES_CLAIM,
+// JWT_DEFAULT_TENANT and JWT_JWKS_REFRESH. It returns nil when no JWKS is
+// configured. Setting JWT_DEFAULT_TENANT, even to nothing, admits tokens
+// without the tenant claim.
+func DSTokenVerifierFromEnv() (*TokenVerifier, error) {
+	config := TokenVerifierConfig{
+		JWKSFile:    os.Getenv("JWT_JWKS_FILE"),
+		JWKSURL:     os.Getenv("JWT_JWKS_URL"),
+		Issuer:      os.Getenv("JWT_ISSUER"),
+		Audience:    os.Getenv("JWT_AUDIENCE"),
+		TenantClaim: os.Getenv("JWT_TENANT_CLAIM"),
+		RolesClaim:  os.Getenv("JWT_ROLES_CLAIM"),
+	}
+	config.DefaultTenant, config.AllowDefaultTenant = os.LookupEnv("JWT_DEFAULT_TENANT")
+	if config.JWKSFile == "" && config.JWKSURL == "" {
+		return nil, nil
+	}
+	if value := os.Getenv("JWT_JWKS_REFRESH"); value != "" {
+		refresh, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_JWKS_REFRESH: %w", err)
+		}
+		config.RefreshInterval = refresh
+	}
+	return DSTokenVerifier(config)
+}
+
+// DSTokenVerifier loads the JWKS of config. The issuer and audience are
+// required. A JWKS URL that cannot be reached yet does not fail: tokens are
+// refused until a later load succeeds.
+func DSTokenVerifier(config TokenVerifierConfig) (*TokenVerifier, error) {
+	if (config.JWKSFile == "") == (config.JWKSURL == "") {
+		return nil, errors.New("exactly one of a JWKS file and a JWKS URL is required")
+	}
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, errors.New("JWT issuer and audience are required")
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = "tenant"
+	}
+	if config.RolesClaim == "" {
+		config.RolesClaim = "roles"
+	}
+	if err := ValidateTenant(config.DefaultTenant); err != nil {
+		return nil, fmt.Errorf("invalid JWT default tenant: %w", err)
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = time.Hour
+	}
+
+	verifier := &TokenVerifier{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if err := verifier.refresh(time.Time{}); err != nil {
+		if config.JWKSURL == "" {
+			return nil, err
+		}
+		log.Printf("[SERVICE] [JWT] [ERROR] Failed to load JWKS, retrying on the next token - URL: %s, Error: %v",
+			config.JWKSURL, err)
+	}
+	log.Printf("[SERVICE] [JWT] Token verifier initialized - Issuer: %s, Audience: %s, Keys: %d",
+		config.Issuer, config.Audience, len(verifier.keys))
+	return verifier, nil
+}
+
+// Verify checks the signature, issuer, audience, expiry and not-before time
+// of token and returns the principal its claims describe.
+func (verifier *TokenVerifier) Verify(token string) (*models.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	hash, ok := jwtAlgorithmHash(header.Alg)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	digest := hash.New()
+	digest.Write([]byte(parts[0] + "." + parts[1]))
+	if !verifier.verifySignature(header.Alg, header.Kid, hash, digest.Sum(nil), signature) {
+		return nil, fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	return verifier.principal(claims)
+}
+
+// principal checks the registered claims and maps the rest to a principal.
+func (verifier *TokenVerifier) principal(claims map[string]interface{}) (*models.Principal, error) {
+	now := time.Now()
+
+	expiry, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(time.Unix(int64(expiry), 0).Add(jwtClockSkew)) {
+		return nil, fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	}
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(jwtClockSkew).Before(time.Unix(int64(notBefore), 0)) {
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	}
+	if issuer, _ := claims["iss"].(string); issuer != verifier.config.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, issuer)
+	}
+	if !containsClaim(claims["aud"], verifier.config.Audience) {
+		return nil, fmt.Errorf("%w: token is not meant for audience %q", ErrInvalidToken, verifier.config.Audience)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+	tenant, _ := claims[verifier.config.TenantClaim].(string)
+	if tenant == "" {
+		if !verifier.config.AllowDefaultTenant {
+			return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, verifier.config.TenantClaim)
+		}
+		tenant = verifier.config.DefaultTenant
+	}
+	if err := ValidateTenant(tenant); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var scopes []string
+	for _, role := range claimStrings(claims[verifier.config.RolesClaim]) {
+		switch role {
+		case models.ScopeUpload, models.ScopeRead, models.ScopeAdmin:
+			scopes = append(scopes, role)
+		case models.ScopeOperator:
+			if tenant == "" {
+				scopes = append(scopes, role)
+			}
+		}
+	}
+
+	return &models.Principal{
+		ID:     "jwt:" + subject,
+		Tenant: tenant,
+		Scopes: scopes,
+		Method: models.AuthMethodJWT,
+	}, nil
+}
+
+// verifySignature checks signature with the key named kid, or with every key
+// when the token names none. An unknown kid, or a JWKS that never loaded,
+// reloads the JWKS before checking, since the issuer may have rotated its
+// keys. Keys past their refresh interval stay in use while they reload in the
+// background.
+func (verifier *TokenVerifier) verifySignature(alg, kid string, hash crypto.Hash, digest, signature []byte) bool {
+	verifier.keysMutex.RLock()
+	_, known := verifier.keys[kid]
+	loaded := len(verifier.keys) > 0
+	fetchedAt, attemptedAt := verifier.fetchedAt, verifier.attemptedAt
+	verifier.keysMutex.RUnlock()
+
+	retry := time.Since(attemptedAt) > jwksRetryInterval
+	if (!loaded || kid != "" && !known) && time.Since(fetchedAt) > jwksMinRefresh && retry {
+		if err := verifier.refresh(attemptedAt); err != nil {
+			log.Printf("[SERVICE] [JWT] [ERROR] Failed to reload JWKS - Error: %v", err)
+		}
+	} else if time.Since(fetchedAt) > verifier.config.RefreshInterval && verifier.config.JWKSURL != "" && retry {
+		go func() {
+			if err := verifier.refresh(attemptedAt); err != nil {
+				log.Printf("[SERVICE] [JWT] [ERROR] Failed to refresh JWKS - Error: %v", err)
+			}
+		}()
+	}
+
+	verifier.keysMutex.RLock()
+	defer verifier.keysMutex.RUnlock()
+
+	if kid != "" {
+		return verifyWithKey(alg, verifier.keys[kid], hash, digest, signature)
+	}
+	for _, key := range verifier.keys {
+		if verifyWithKey(alg, key, hash, digest, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func verifyWithKey(alg string, key crypto.PublicKey, hash crypto.Hash, digest, signature []byte) bool {
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(publicKey, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(publicKey, digest, r, s)
+	}
+	return false
+}
+
+// refresh reloads the JWKS from its file or URL, unless another load was
+// attempted since the caller saw attemptedAt. Callers that queued behind that
+// load use its outcome instead of fetching once each.
+func (verifier *TokenVerifier) refresh(attemptedAt time.Time) error {
+	verifier.fetchMutex.Lock()
+	defer verifier.fetchMutex.Unlock()
+
+	verifier.keysMutex.RLock()
+	loadedSince := !verifier.attemptedAt.Equal(attemptedAt)
+	verifier.keysMutex.RUnlock()
+	if loadedSince {
+		return nil
+	}
+
+	data, err := verifier.readJWKS()
+	var keys map[string]crypto.PublicKey
+	if err == nil {
+		keys, err = parseJWKS(data)
+	}
+
+	verifier.keysMutex.Lock()
+	defer verifier.keysMutex.Unlock()
+	// Set once the load ends, so tokens arriving meanwhile queue behind it
+	verifier.attemptedAt = time.Now()
+	if err != nil {
+		return err
+	}
+	verifier.keys = keys
+	verifier.fetchedAt = verifier.attemptedAt
+	return nil
+}
+
+func (verifier *TokenVerifier) readJWKS() ([]byte, error) {
+	if verifier.config.JWKSFile != "" {
+		return os.ReadFile(verifier.config.JWKSFile)
+	}
+
+	response, err := verifier.client.Get(verifier.config.JWKSURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", response.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(response.Body, maxJWKSSize))
+}
+
+// parseJWKS reads the RSA and EC signing keys of a JWK set. Keys of other
+// types or meant for encryption are skipped.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("invalid JWKS: RSA key %q", jwk.Kid)
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				return nil, fmt.Errorf("invalid JWKS: EC key %q", jwk.Kid)
+			}
+			publicKey := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if !curve.IsOnCurve(publicKey.X, publicKey.Y) {
+				return nil, fmt.Errorf("invalid JWKS: EC key %q is not on its curve", jwk.Kid)
+			}
+			keys[jwk.Kid] = publicKey
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("invalid JWKS: no RSA or EC signing keys")
+	}
+	return keys, nil
+}
+
+func jwtAlgorithmHash(alg string) (crypto.Hash, bool) {
+	switch alg {
+	case "RS256", "ES256":
+		return crypto.SHA256, true
+	case "RS384", "ES384":
+		return crypto.SHA384, true
+	case "RS512", "ES512":
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+func decodeJWTPart(part string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// claimStrings reads a claim that is either a list of strings or a single
+// string of space or comma separated values, like the OAuth scope claim.
+func claimStrings(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' })
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func containsClaim(claim interface{}, want string) bool {
+	if value, ok := claim.(string); ok {
+		return value == want
+	}
+	for _, value := range claimStrings(claim) {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
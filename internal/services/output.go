@@ -0,0 +1,284 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	OutputFormatCSV     = "csv"
+	OutputFormatNDJSON  = "ndjson"
+	OutputFormatJSON    = "json"
+	OutputFormatParquet = "parquet"
+	OutputFormatSQLite  = "sqlite"
+)
+
+var outputExtensions = map[string]string{
+	OutputFormatCSV:     "csv",
+	OutputFormatNDJSON:  "ndjson",
+	OutputFormatJSON:    "json",
+	OutputFormatParquet: "parquet",
+	OutputFormatSQLite:  "db",
+}
+
+var outputContentTypes = map[string]string{
+	OutputFormatCSV:     "text/csv",
+	OutputFormatNDJSON:  "application/x-ndjson",
+	OutputFormatJSON:    "application/json",
+	OutputFormatParquet: "application/vnd.apache.parquet",
+	OutputFormatSQLite:  "application/vnd.sqlite3",
+}
+
+// OutputExtension returns the file extension used for processed files of the given format.
+func OutputExtension(format string) string {
+	if extension, ok := outputExtensions[format]; ok {
+		return extension
+	}
+	return outputExtensions[OutputFormatCSV]
+}
+
+// OutputContentType returns the MIME type of processed files of the given format.
+func OutputContentType(format string) string {
+	if contentType, ok := outputContentTypes[format]; ok {
+		return contentType
+	}
+	return outputContentTypes[OutputFormatCSV]
+}
+
+func normalizeOutputFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "":
+		return OutputFormatCSV, nil
+	case "jsonl":
+		return OutputFormatNDJSON, nil
+	case "sqlite3", "db":
+		return OutputFormatSQLite, nil
+	}
+	if _, ok := outputExtensions[format]; !ok {
+		return "", errors.New("unsupported output_format: " + format)
+	}
+	return format, nil
+}
+
+// recordWriter receives the processed header followed by every processed row.
+// Close finalizes the output and must be called exactly once.
+type recordWriter interface {
+	WriteHeader(headers []string) error
+	Write(record []string) error
+	Close() error
+}
+
+// createRecordWriter creates the output file at outputPath in the given format.
+func createRecordWriter(format, outputPath string) (recordWriter, error) {
+	if format == OutputFormatSQLite {
+		return createSQLiteRecordWriter(outputPath)
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case OutputFormatNDJSON:
+		return &jsonRecordWriter{file: file, buffered: bufio.NewWriter(file)}, nil
+	case OutputFormatJSON:
+		return &jsonRecordWriter{file: file, buffered: bufio.NewWriter(file), array: true}, nil
+	case OutputFormatParquet:
+		spool, err := createRowSpool(outputPath)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return &parquetRecordWriter{file: file, spool: spool}, nil
+	default:
+		return &csvRecordWriter{file: file, writer: csv.NewWriter(file)}, nil
+	}
+}
+
+type csvRecordWriter struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func (output *csvRecordWriter) WriteHeader(headers []string) error {
+	return output.writer.Write(headers)
+}
+
+func (output *csvRecordWriter) Write(record []string) error {
+	return output.writer.Write(record)
+}
+
+func (output *csvRecordWriter) Close() error {
+	output.writer.Flush()
+	if err := output.writer.Error(); err != nil {
+		output.file.Close()
+		return fmt.Errorf("CSV writer error: %w", err)
+	}
+	return output.file.Close()
+}
+
+// jsonRecordWriter writes one object per row keyed by header, either as JSON
+// Lines or wrapped in a single JSON array. Keys keep the column order.
+type jsonRecordWriter struct {
+	file     *os.File
+	buffered *bufio.Writer
+	array    bool
+	headers  []string
+	rows     int
+}
+
+func (output *jsonRecordWriter) WriteHeader(headers []string) error {
+	output.headers = append([]string(nil), headers...)
+	if output.array {
+		_, err := output.buffered.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+func (output *jsonRecordWriter) Write(record []string) error {
+	if output.array && output.rows > 0 {
+		if _, err := output.buffered.WriteString(","); err != nil {
+			return err
+		}
+	}
+	if output.array {
+		output.buffered.WriteString("\n")
+	}
+
+	output.buffered.WriteString("{")
+	for i, header := range output.headers {
+		if i > 0 {
+			output.buffered.WriteString(",")
+		}
+		key, _ := json.Marshal(header)
+		value := ""
+		if i < len(record) {
+			value = record[i]
+		}
+		encoded, _ := json.Marshal(value)
+		output.buffered.Write(key)
+		output.buffered.WriteString(":")
+		output.buffered.Write(encoded)
+	}
+	_, err := output.buffered.WriteString("}")
+	if !output.array {
+		output.buffered.WriteString("\n")
+	}
+	output.rows++
+	return err
+}
+
+func (output *jsonRecordWriter) Close() error {
+	if output.array {
+		if output.headers == nil {
+			output.buffered.WriteString("[")
+		}
+		output.buffered.WriteString("\n]\n")
+	}
+	if err := output.buffered.Flush(); err != nil {
+		output.file.Close()
+		return fmt.Errorf("JSON writer error: %w", err)
+	}
+	return output.file.Close()
+}
+
+// parquetRowGroupRows bounds the rows of a parquet row group, which the
+// writer holds in memory until it is flushed.
+const parquetRowGroupRows = 100_000
+
+// parquetRecordWriter spools the rows of a job so each column's type can be
+// inferred from all of its values, then writes them in row groups of at most
+// parquetRowGroupRows on Close.
+type parquetRecordWriter struct {
+	file    *os.File
+	spool   *rowSpool
+	headers []string
+}
+
+func (output *parquetRecordWriter) WriteHeader(headers []string) error {
+	output.headers = append([]string(nil), headers...)
+	output.spool.setColumns(len(headers))
+	return nil
+}
+
+func (output *parquetRecordWriter) Write(record []string) error {
+	return output.spool.add(record)
+}
+
+func (output *parquetRecordWriter) Close() error {
+	defer output.spool.remove()
+	columnTypes := output.spool.types
+
+	// Build a struct type whose fields mirror the columns in order, so the
+	// parquet schema keeps the CSV column order and per-column types.
+	names := uniqueColumnNames(output.headers)
+	fields := make([]reflect.StructField, len(output.headers))
+	for column := range output.headers {
+		fields[column] = reflect.StructField{
+			Name: "Column" + strconv.Itoa(column),
+			Type: reflect.PointerTo(columnTypes[column].goType()),
+			Tag:  reflect.StructTag(`parquet:"` + names[column] + `,optional"`),
+		}
+	}
+	rowType := reflect.StructOf(fields)
+
+	writer := parquet.NewWriter(output.file, parquet.SchemaOf(reflect.New(rowType).Interface()),
+		parquet.MaxRowsPerRowGroup(parquetRowGroupRows))
+	err := output.spool.each(func(record []string) error {
+		row := reflect.New(rowType).Elem()
+		for column := range output.headers {
+			if column >= len(record) || strings.TrimSpace(record[column]) == "" {
+				continue
+			}
+			value := columnTypes[column].parse(strings.TrimSpace(record[column]))
+			pointer := reflect.New(value.Type())
+			pointer.Elem().Set(value)
+			row.Field(column).Set(pointer)
+		}
+		return writer.Write(row.Addr().Interface())
+	})
+	if err != nil {
+		output.file.Close()
+		return fmt.Errorf("parquet writer error: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		output.file.Close()
+		return fmt.Errorf("parquet writer error: %w", err)
+	}
+	return output.file.Close()
+}
+
+// uniqueColumnNames makes header names usable as schema column names: blank
+// and duplicate headers are renamed and characters reserved by struct tags dropped.
+// Names differing only in case count as duplicates, since SQLite column names
+// are case-insensitive.
+func uniqueColumnNames(headers []string) []string {
+	names := make([]string, len(headers))
+	seen := make(map[string]bool, len(headers))
+	for i, header := range headers {
+		name := strings.NewReplacer(",", "_", "\"", "", "`", "").Replace(strings.TrimSpace(header))
+		if name == "" {
+			name = "column_" + strconv.Itoa(i+1)
+		}
+		candidate := name
+		for suffix := 2; seen[strings.ToLower(candidate)]; suffix++ {
+			candidate = name + "_" + strconv.Itoa(suffix)
+		}
+		seen[strings.ToLower(candidate)] = true
+		names[i] = candidate
+	}
+	return names
+}
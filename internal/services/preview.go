@@ -0,0 +1,175 @@
+package services
+
+import (
+	"bytes"
+	"demandscience/internal/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"strings"
+)
+
+const (
+	// DefaultPreviewRows is the number of rows previewed when none is requested.
+	DefaultPreviewRows = 10
+	// MaxPreviewRows caps the rows of a preview, which is processed synchronously.
+	MaxPreviewRows = 1000
+	// previewSampleLimit is the amount of text kept to detect the dialect.
+	previewSampleLimit = 64 * 1024
+)
+
+// Preview reads the first rows of an upload and processes them the way a job
+// would, without registering a job or writing an output file. Zip uploads are
+// previewed from their first CSV entry.
+func (csvService *CsvProcessingService) Preview(fileHeader *multipart.FileHeader, options models.ProcessingOptions, rows int) (*models.PreviewResponse, error) {
+	source := multipartSource{header: fileHeader}
+	log.Printf("[SERVICE] [PREVIEW] Starting preview - File: %s, Rows: %d", source.Name(), rows)
+
+	if rows <= 0 || rows > MaxPreviewRows {
+		return nil, fmt.Errorf("rows must be between 1 and %d", MaxPreviewRows)
+	}
+	if err := csvService.validateFile(source, options.Tenant); err != nil {
+		return nil, err
+	}
+	options, err := csvService.validateOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := source.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer file.Close()
+
+	maxSize := csvService.maxFileSize(options.Tenant)
+	entries, err := openInputEntries(file, source.Name(), source.Size(), "", options.Sheet, maxSize)
+	if err != nil {
+		log.Printf("[SERVICE] [PREVIEW] [ERROR] Failed to read upload - File: %s, Error: %v", source.Name(), err)
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errNoCSVInArchive
+	}
+	entry := entries[0]
+
+	// The job is only used to carry options and logging context; it is never registered
+	job := models.DSProcessingJob("preview", source.Name(), options)
+	reader, closer, encoding, err := csvService.openEntryRecords(entry, newDecompressionGuard(maxSize), job)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var sample bytes.Buffer
+	rawReader, isCSV := reader.(*rawRecordReader)
+	if isCSV {
+		rawReader.sample = &sample
+		rawReader.sampleLimit = previewSampleLimit
+	}
+
+	preview := &models.PreviewResponse{
+		FileName: source.Name(),
+		Dialect: models.PreviewDialect{
+			SourceFormat: uploadKind(source.Name()),
+			Encoding:     encoding,
+		},
+		Rows: [][]string{},
+	}
+	if len(entries) > 1 || uploadKind(source.Name()) == uploadKindZip {
+		preview.Dialect.Entry = entry.name
+	}
+	if sheetReader, ok := reader.(*xlsxRowReader); ok {
+		preview.Dialect.Sheet = sheetReader.sheetName
+	}
+
+	headers, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("file is empty")
+		}
+		return nil, fmt.Errorf("failed to read headers: %w", err)
+	}
+	preview.Headers = append(append([]string(nil), headers...), "has_email")
+
+	emailColumns := make([]int, len(headers))
+	for len(preview.Rows) < rows {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			preview.RowErrors = append(preview.RowErrors, models.RowError{
+				Line:  parseErr.StartLine + options.SkipLines,
+				Raw:   rawReader.rawText(),
+				Error: parseErr.Err.Error(),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read record: %w", err)
+		}
+
+		if options.VariableFields {
+			record = fitRecord(record, len(headers))
+		}
+		if csvService.isEmptyRecord(record) {
+			continue
+		}
+
+		processed, emailColumn := processRecord(record)
+		if emailColumn >= 0 && emailColumn < len(emailColumns) {
+			emailColumns[emailColumn]++
+		}
+		preview.Rows = append(preview.Rows, processed)
+	}
+	if len(preview.Rows) == rows {
+		_, err := reader.Read()
+		preview.Truncated = err != io.EOF
+	}
+
+	best := -1
+	for column, count := range emailColumns {
+		if count > 0 && (best < 0 || count > emailColumns[best]) {
+			best = column
+		}
+	}
+	if best >= 0 {
+		preview.EmailColumn = headers[best]
+	}
+
+	if isCSV {
+		describeCSVDialect(preview, rawReader, sample.String())
+	}
+	if len(preview.RowErrors) > 0 && options.ErrorMode == ErrorModeStrict {
+		preview.Warnings = append(preview.Warnings,
+			"malformed rows found; a job with error_mode=strict would fail on the first one")
+	}
+
+	log.Printf("[SERVICE] [PREVIEW] [SUCCESS] Preview built - File: %s, Rows: %d, EmailColumn: %s, RowErrors: %d",
+		source.Name(), len(preview.Rows), preview.EmailColumn, len(preview.RowErrors))
+	return preview, nil
+}
+
+// describeCSVDialect fills in the dialect detected from the previewed text
+// and the delimiter the rows were split on, which a job uses as well. When
+// the two differ, a warning says so.
+func describeCSVDialect(preview *models.PreviewResponse, reader *rawRecordReader, sample string) {
+	preview.Dialect.Quote = `"`
+	preview.Dialect.LineTerminator = "\n"
+	if strings.Contains(sample, "\r\n") {
+		preview.Dialect.LineTerminator = "\r\n"
+	}
+
+	detected, used := detectDelimiter(sample), reader.reader.Comma
+	preview.Dialect.Delimiter = string(detected)
+	preview.Dialect.JobDelimiter = string(used)
+	if detected != used {
+		preview.Warnings = append(preview.Warnings,
+			fmt.Sprintf("the file looks %q-delimited but a job splits it on %q; set delimiter to change that", detected, used))
+	}
+}
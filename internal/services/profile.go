@@ -0,0 +1,349 @@
+package services
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"demandscience/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// profileExactDistinct is the number of distinct values per column that are
+	// counted exactly before switching to a HyperLogLog estimate.
+	profileExactDistinct = 10000
+	// profileTopValues is the number of most frequent values reported per column.
+	profileTopValues = 10
+	// profileHeavyHitters is the number of values tracked per column to find
+	// the most frequent ones once counting is no longer exact.
+	profileHeavyHitters = profileTopValues * 100
+	// hyperLogLogPrecision sets 2^14 registers, a standard error of about 0.8%.
+	hyperLogLogPrecision = 14
+)
+
+var phoneRegex = regexp.MustCompile(`^\+?\(?[0-9][0-9 ().\-]{5,}[0-9]$`)
+
+// validPhone accepts international or national numbers of 7 to 15 digits with
+// the usual separators.
+func validPhone(value string) bool {
+	if !phoneRegex.MatchString(value) {
+		return false
+	}
+	digits := 0
+	for _, char := range value {
+		if char >= '0' && char <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
+
+// jobProfiler builds the column profile of a job from the records it processes.
+type jobProfiler struct {
+	rows    int
+	columns []*columnProfiler
+}
+
+func newJobProfiler(headers []string) *jobProfiler {
+	profiler := &jobProfiler{}
+	for _, header := range headers {
+		profiler.columns = append(profiler.columns, newColumnProfiler(header))
+	}
+	return profiler
+}
+
+// add profiles one non-empty input record. Fields beyond the header are ignored.
+func (profiler *jobProfiler) add(record []string) {
+	profiler.rows++
+	for i, field := range record {
+		if i >= len(profiler.columns) {
+			break
+		}
+		profiler.columns[i].add(strings.TrimSpace(field))
+	}
+}
+
+func (profiler *jobProfiler) profile(jobID string) *models.JobProfile {
+	profile := &models.JobProfile{JobID: jobID, Rows: profiler.rows, Columns: []models.ColumnProfile{}}
+	for _, column := range profiler.columns {
+		profile.Columns = append(profile.Columns, column.profile(profiler.rows))
+	}
+	return profile
+}
+
+type columnProfiler struct {
+	name   string
+	filled int
+	emails int
+	phones int
+	kind   columnType
+	counts map[string]int
+	// distinct and frequent take over from counts once it holds
+	// profileExactDistinct values
+	distinct *hyperLogLog
+	frequent *spaceSaving
+}
+
+func newColumnProfiler(name string) *columnProfiler {
+	return &columnProfiler{name: name, counts: make(map[string]int)}
+}
+
+func (column *columnProfiler) add(value string) {
+	if value == "" {
+		return
+	}
+	column.filled++
+	column.kind = column.kind.widen(valueType(value))
+	if emailRegex.MatchString(value) {
+		column.emails++
+	}
+	if validPhone(value) {
+		column.phones++
+	}
+
+	if column.distinct != nil {
+		column.distinct.add(value)
+		column.frequent.add(value)
+		return
+	}
+
+	column.counts[value]++
+	if len(column.counts) > profileExactDistinct {
+		column.distinct = newHyperLogLog()
+		for seen := range column.counts {
+			column.distinct.add(seen)
+		}
+		column.frequent = newSpaceSaving(profileHeavyHitters)
+		for _, top := range topValueCounts(column.counts, profileHeavyHitters) {
+			column.frequent.insert(top.Value, top.Count)
+		}
+		column.counts = nil
+	}
+}
+
+func (column *columnProfiler) profile(rows int) models.ColumnProfile {
+	profile := models.ColumnProfile{
+		Name:              column.name,
+		Type:              column.kind.String(),
+		Filled:            column.filled,
+		FillRate:          percentage(column.filled, rows),
+		Distinct:          len(column.counts),
+		ValidEmailPercent: percentage(column.emails, column.filled),
+		ValidPhonePercent: percentage(column.phones, column.filled),
+	}
+	profile.TopValues = topValueCounts(column.counts, profileTopValues)
+	if column.distinct != nil {
+		profile.Approximate = true
+		profile.Distinct = column.distinct.estimate()
+		profile.TopValues = column.frequent.top(profileTopValues)
+	}
+
+	// Strings that are all emails or phone numbers get a more useful type
+	if column.kind == columnTypeString {
+		switch {
+		case column.emails == column.filled:
+			profile.Type = "email"
+		case column.phones == column.filled:
+			profile.Type = "phone"
+		}
+	}
+
+	return profile
+}
+
+// topValueCounts returns the limit most frequent values, ties broken by value.
+func topValueCounts(counts map[string]int, limit int) []models.ValueCount {
+	top := make([]models.ValueCount, 0, len(counts))
+	for value, count := range counts {
+		top = append(top, models.ValueCount{Value: value, Count: count})
+	}
+	return limitValueCounts(top, limit)
+}
+
+// limitValueCounts sorts top by descending count, ties broken by value, and
+// keeps the first limit entries.
+func limitValueCounts(top []models.ValueCount, limit int) []models.ValueCount {
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Value < top[j].Value
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	return top
+}
+
+// spaceSaving finds the most frequent strings of a stream in a fixed number
+// of slots. When the slots are full, a new value replaces the least counted
+// one and inherits its count, so counts are upper bounds. It is a min-heap of
+// slots by count.
+type spaceSaving struct {
+	slots []*heavyHitter
+	index map[string]*heavyHitter
+	size  int
+}
+
+type heavyHitter struct {
+	value    string
+	count    int
+	position int
+}
+
+func newSpaceSaving(size int) *spaceSaving {
+	return &spaceSaving{index: make(map[string]*heavyHitter, size), size: size}
+}
+
+func (counter *spaceSaving) add(value string) {
+	if slot, ok := counter.index[value]; ok {
+		slot.count++
+		heap.Fix(counter, slot.position)
+		return
+	}
+	if len(counter.slots) < counter.size {
+		counter.insert(value, 1)
+		return
+	}
+	least := counter.slots[0]
+	delete(counter.index, least.value)
+	least.value = value
+	least.count++
+	counter.index[value] = least
+	heap.Fix(counter, 0)
+}
+
+// insert adds a value that is not tracked yet with the given count.
+func (counter *spaceSaving) insert(value string, count int) {
+	slot := &heavyHitter{value: value, count: count}
+	counter.index[value] = slot
+	heap.Push(counter, slot)
+}
+
+// top returns the limit most counted values.
+func (counter *spaceSaving) top(limit int) []models.ValueCount {
+	top := make([]models.ValueCount, 0, len(counter.slots))
+	for _, slot := range counter.slots {
+		top = append(top, models.ValueCount{Value: slot.value, Count: slot.count})
+	}
+	return limitValueCounts(top, limit)
+}
+
+func (counter *spaceSaving) Len() int { return len(counter.slots) }
+func (counter *spaceSaving) Less(i, j int) bool {
+	return counter.slots[i].count < counter.slots[j].count
+}
+
+func (counter *spaceSaving) Swap(i, j int) {
+	counter.slots[i], counter.slots[j] = counter.slots[j], counter.slots[i]
+	counter.slots[i].position = i
+	counter.slots[j].position = j
+}
+
+func (counter *spaceSaving) Push(slot interface{}) {
+	slot.(*heavyHitter).position = len(counter.slots)
+	counter.slots = append(counter.slots, slot.(*heavyHitter))
+}
+
+func (counter *spaceSaving) Pop() interface{} {
+	last := counter.slots[len(counter.slots)-1]
+	counter.slots = counter.slots[:len(counter.slots)-1]
+	return last
+}
+
+// percentage returns part as a percentage of total, rounded to two decimals.
+func percentage(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*10000/float64(total)) / 100
+}
+
+// hyperLogLog estimates the number of distinct strings added to it.
+type hyperLogLog struct {
+	seed      maphash.Seed
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{seed: maphash.MakeSeed(), registers: make([]uint8, 1<<hyperLogLogPrecision)}
+}
+
+func (sketch *hyperLogLog) add(value string) {
+	hash := maphash.String(sketch.seed, value)
+	index := hash >> (64 - hyperLogLogPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hyperLogLogPrecision|1<<(hyperLogLogPrecision-1)) + 1)
+	if rank > sketch.registers[index] {
+		sketch.registers[index] = rank
+	}
+}
+
+func (sketch *hyperLogLog) estimate() int {
+	registers := float64(len(sketch.registers))
+	sum, zeros := 0.0, 0
+	for _, rank := range sketch.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := 0.7213 / (1 + 1.079/registers) * registers * registers / sum
+	if estimate <= 2.5*registers && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities
+		estimate = registers * math.Log(registers/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+// storeProfile saves the column profile of a completed job as JSON.
+func (csvService *CsvProcessingService) storeProfile(job *models.ProcessingJob, profiler *jobProfiler) error {
+	data, err := json.Marshal(profiler.profile(job.ID))
+	if err != nil {
+		return err
+	}
+
+	key := tenantKey(job.Tenant, job.ID+"_profile.json")
+	if err := csvService.storage.Put(context.Background(), key, bytes.NewReader(data), int64(len(data))); err != nil {
+		return err
+	}
+	csvService.recordStored(job.Tenant, int64(len(data)))
+
+	csvService.jobsMutex.Lock()
+	job.ProfileKey = key
+	csvService.jobsMutex.Unlock()
+	return nil
+}
+
+// GetJobProfile returns the column profile of a completed job.
+func (csvService *CsvProcessingService) GetJobProfile(jobID string) (*models.JobProfile, error) {
+	job := csvService.GetJob(jobID)
+	if job == nil {
+		return nil, errors.New("job not found")
+	}
+
+	csvService.jobsMutex.RLock()
+	key := job.ProfileKey
+	csvService.jobsMutex.RUnlock()
+	if key == "" {
+		return nil, errors.New("profile not found")
+	}
+
+	data, err := csvService.storage.Get(context.Background(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profile: %w", err)
+	}
+	var profile models.JobProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode profile: %w", err)
+	}
+	return &profile, nil
+}
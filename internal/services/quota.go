@@ -0,0 +1,390 @@
+package services
+
+import (
+	"demandscience/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	tenantQuotasFileName = "tenant_quotas.json"
+	tenantUsageFileName  = "tenant_usage.json"
+	// defaultQuotaTenant names the quota of tenants without one of their own.
+	defaultQuotaTenant = "*"
+	// usageHistoryDays is how many days of usage are kept per tenant.
+	usageHistoryDays = 31
+	usageDateLayout  = "2006-01-02"
+)
+
+// QuotaError is returned when an upload would take a tenant over a quota.
+// Code is one of the models.ErrorCode* values.
+type QuotaError struct {
+	Code    string
+	Message string
+	// RetryAfter is how long until the quota frees up, when that is known.
+	RetryAfter time.Duration
+}
+
+func (quotaErr *QuotaError) Error() string {
+	return quotaErr.Message
+}
+
+// tenantUsage is what a tenant uses now and used on each recent UTC day.
+// Everything but the running jobs is saved to the usage file.
+type tenantUsage struct {
+	runningJobs int
+	bytesStored int64
+	days        map[string]*models.DailyUsage // by date
+}
+
+// savedUsage is the usage of a tenant in the usage file.
+type savedUsage struct {
+	BytesStored int64               `json:"bytesStored"`
+	Days        []models.DailyUsage `json:"days"`
+}
+
+// loadTenantQuotas reads the quotas file. A missing file sets no quotas.
+func (csvService *CsvProcessingService) loadTenantQuotas() error {
+	info, err := os.Stat(csvService.quotasPath)
+	if os.IsNotExist(err) {
+		csvService.setTenantQuotas(make(map[string]models.TenantQuota), time.Time{})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(csvService.quotasPath)
+	if err != nil {
+		return err
+	}
+	quotas := make(map[string]models.TenantQuota)
+	if err := json.Unmarshal(data, &quotas); err != nil {
+		return fmt.Errorf("invalid tenant quotas file %s: %w", csvService.quotasPath, err)
+	}
+	for tenant := range quotas {
+		if tenant != defaultQuotaTenant {
+			if err := ValidateTenant(tenant); err != nil {
+				return fmt.Errorf("invalid tenant quotas file %s: %q: %w", csvService.quotasPath, tenant, err)
+			}
+		}
+	}
+	csvService.setTenantQuotas(quotas, info.ModTime())
+	return nil
+}
+
+func (csvService *CsvProcessingService) setTenantQuotas(quotas map[string]models.TenantQuota, modTime time.Time) {
+	csvService.usageMutex.Lock()
+	csvService.quotas = quotas
+	csvService.quotasModTime = modTime
+	csvService.usageMutex.Unlock()
+}
+
+// reloadTenantQuotasPeriodically picks up changes to the quotas file every interval.
+func (csvService *CsvProcessingService) reloadTenantQuotasPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		var modTime time.Time
+		if info, err := os.Stat(csvService.quotasPath); err == nil {
+			modTime = info.ModTime()
+		} else if !os.IsNotExist(err) {
+			continue
+		}
+
+		csvService.usageMutex.Lock()
+		unchanged := modTime.Equal(csvService.quotasModTime)
+		csvService.usageMutex.Unlock()
+		if unchanged {
+			continue
+		}
+		if err := csvService.loadTenantQuotas(); err != nil {
+			log.Printf("[SERVICE] [QUOTA] [ERROR] Failed to reload tenant quotas - File: %s, Error: %v", csvService.quotasPath, err)
+			continue
+		}
+		log.Printf("[SERVICE] [QUOTA] Tenant quotas reloaded - File: %s", csvService.quotasPath)
+	}
+}
+
+// SetTenantQuota replaces the quota of tenant, or of every tenant without
+// its own when tenant is "*", until the quotas file changes.
+func (csvService *CsvProcessingService) SetTenantQuota(tenant string, quota models.TenantQuota) {
+	csvService.usageMutex.Lock()
+	defer csvService.usageMutex.Unlock()
+
+	quotas := make(map[string]models.TenantQuota, len(csvService.quotas)+1)
+	for name, existing := range csvService.quotas {
+		quotas[name] = existing
+	}
+	quotas[tenant] = quota
+	csvService.quotas = quotas
+}
+
+// quotaFor returns the quota of tenant. It must be called with usageMutex held.
+func (csvService *CsvProcessingService) quotaFor(tenant string) models.TenantQuota {
+	if quota, ok := csvService.quotas[tenant]; ok {
+		return quota
+	}
+	return csvService.quotas[defaultQuotaTenant]
+}
+
+// maxFileSize is the largest upload tenant may send: its own limit, or
+// MAX_FILE_SIZE when it has none.
+func (csvService *CsvProcessingService) maxFileSize(tenant string) int64 {
+	csvService.usageMutex.Lock()
+	quota := csvService.quotaFor(tenant)
+	csvService.usageMutex.Unlock()
+
+	if quota.MaxFileSize > 0 {
+		return quota.MaxFileSize
+	}
+	return int64(MaxFileSize)
+}
+
+// tenantUsage returns the usage of tenant, creating it on first use. It must
+// be called with usageMutex held.
+func (csvService *CsvProcessingService) tenantUsage(tenant string) *tenantUsage {
+	usage := csvService.usage[tenant]
+	if usage == nil {
+		usage = &tenantUsage{days: make(map[string]*models.DailyUsage)}
+		csvService.usage[tenant] = usage
+	}
+	return usage
+}
+
+// today returns the usage of the current UTC day and forgets days older than
+// usageHistoryDays.
+func (usage *tenantUsage) today() *models.DailyUsage {
+	date := time.Now().UTC().Format(usageDateLayout)
+	day := usage.days[date]
+	if day == nil {
+		day = &models.DailyUsage{Date: date}
+		usage.days[date] = day
+
+		oldest := time.Now().UTC().AddDate(0, 0, -usageHistoryDays).Format(usageDateLayout)
+		for existing := range usage.days {
+			if existing <= oldest {
+				delete(usage.days, existing)
+			}
+		}
+	}
+	return day
+}
+
+// admitJobs checks that tenant may start count jobs for an upload of size
+// bytes and reserves their concurrent job slots. Every admitted job must be
+// released with releaseJob once it stops.
+func (csvService *CsvProcessingService) admitJobs(tenant string, count int, size int64) error {
+	csvService.usageMutex.Lock()
+	defer csvService.usageMutex.Unlock()
+
+	quota := csvService.quotaFor(tenant)
+	usage := csvService.tenantUsage(tenant)
+	today := usage.today()
+
+	if quota.MaxConcurrentJobs > 0 && usage.runningJobs+count > quota.MaxConcurrentJobs {
+		log.Printf("[SERVICE] [QUOTA] [ERROR] Concurrent job limit reached - Tenant: %s, Running: %d, Limit: %d",
+			tenant, usage.runningJobs, quota.MaxConcurrentJobs)
+		return &QuotaError{
+			Code:    models.ErrorCodeConcurrentJobsLimit,
+			Message: fmt.Sprintf("the tenant may run at most %d jobs at a time; %d are running", quota.MaxConcurrentJobs, usage.runningJobs),
+		}
+	}
+	if quota.MaxRowsPerDay > 0 && today.RowsProcessed >= quota.MaxRowsPerDay {
+		log.Printf("[SERVICE] [QUOTA] [ERROR] Daily row limit reached - Tenant: %s, Rows: %d, Limit: %d",
+			tenant, today.RowsProcessed, quota.MaxRowsPerDay)
+		tomorrow := time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return &QuotaError{
+			Code:       models.ErrorCodeDailyRowLimit,
+			Message:    fmt.Sprintf("the tenant processed its limit of %d rows today (UTC)", quota.MaxRowsPerDay),
+			RetryAfter: time.Until(tomorrow),
+		}
+	}
+	if quota.MaxBytesStored > 0 && usage.bytesStored+size > quota.MaxBytesStored {
+		log.Printf("[SERVICE] [QUOTA] [ERROR] Storage quota exceeded - Tenant: %s, Stored: %d bytes, Upload: %d bytes, Limit: %d bytes",
+			tenant, usage.bytesStored, size, quota.MaxBytesStored)
+		return &QuotaError{
+			Code:    models.ErrorCodeStorageQuotaExceeded,
+			Message: fmt.Sprintf("the upload would take the tenant over its storage quota of %d bytes; %d are in use", quota.MaxBytesStored, usage.bytesStored),
+		}
+	}
+
+	usage.runningJobs += count
+	today.Jobs += count
+	today.BytesIn += size
+	csvService.usageDirty = true
+	return nil
+}
+
+// chargeRow counts a row read by a job of tenant. Once the tenant has read
+// its rows for the day it fails with a DAILY_ROW_LIMIT QuotaError, so jobs
+// stop at the limit rather than when they finish.
+func (csvService *CsvProcessingService) chargeRow(tenant string) error {
+	csvService.usageMutex.Lock()
+	defer csvService.usageMutex.Unlock()
+
+	quota := csvService.quotaFor(tenant)
+	today := csvService.tenantUsage(tenant).today()
+	if quota.MaxRowsPerDay > 0 && today.RowsProcessed >= quota.MaxRowsPerDay {
+		return &QuotaError{
+			Code:    models.ErrorCodeDailyRowLimit,
+			Message: fmt.Sprintf("the tenant processed its limit of %d rows today (UTC)", quota.MaxRowsPerDay),
+		}
+	}
+	today.RowsProcessed++
+	csvService.usageDirty = true
+	return nil
+}
+
+// releaseJob frees the concurrent job slot of an admitted job.
+func (csvService *CsvProcessingService) releaseJob(job *models.ProcessingJob) {
+	csvService.usageMutex.Lock()
+	usage := csvService.tenantUsage(job.Tenant)
+	if usage.runningJobs > 0 {
+		usage.runningJobs--
+	}
+	csvService.usageMutex.Unlock()
+}
+
+// recordStored adds delta bytes to what tenant keeps in storage.
+func (csvService *CsvProcessingService) recordStored(tenant string, delta int64) {
+	csvService.usageMutex.Lock()
+	usage := csvService.tenantUsage(tenant)
+	usage.bytesStored = max(usage.bytesStored+delta, 0)
+	csvService.usageDirty = true
+	csvService.usageMutex.Unlock()
+}
+
+// recordOutput counts size bytes of output produced by a job of tenant.
+func (csvService *CsvProcessingService) recordOutput(tenant string, size int64) {
+	csvService.usageMutex.Lock()
+	csvService.tenantUsage(tenant).today().BytesOut += size
+	csvService.usageDirty = true
+	csvService.usageMutex.Unlock()
+}
+
+// loadUsage reads the usage file, so stored bytes and daily usage survive a
+// restart. A missing file starts from no usage.
+func (csvService *CsvProcessingService) loadUsage() error {
+	data, err := os.ReadFile(csvService.usagePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	saved := make(map[string]savedUsage)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("invalid tenant usage file %s: %w", csvService.usagePath, err)
+	}
+
+	csvService.usageMutex.Lock()
+	defer csvService.usageMutex.Unlock()
+	for tenant, tenantSaved := range saved {
+		usage := csvService.tenantUsage(tenant)
+		usage.bytesStored = tenantSaved.BytesStored
+		for _, day := range tenantSaved.Days {
+			day := day
+			usage.days[day.Date] = &day
+		}
+		usage.today()
+	}
+	return nil
+}
+
+// SaveUsage writes the usage of every tenant to the usage file when it
+// changed, through a temporary file so a reader never sees a partial file.
+func (csvService *CsvProcessingService) SaveUsage() error {
+	csvService.usageSaveMutex.Lock()
+	defer csvService.usageSaveMutex.Unlock()
+
+	csvService.usageMutex.Lock()
+	if !csvService.usageDirty {
+		csvService.usageMutex.Unlock()
+		return nil
+	}
+	saved := make(map[string]savedUsage, len(csvService.usage))
+	for tenant, usage := range csvService.usage {
+		tenantSaved := savedUsage{BytesStored: usage.bytesStored, Days: make([]models.DailyUsage, 0, len(usage.days))}
+		for _, day := range usage.days {
+			tenantSaved.Days = append(tenantSaved.Days, *day)
+		}
+		sort.Slice(tenantSaved.Days, func(i, j int) bool {
+			return tenantSaved.Days[i].Date < tenantSaved.Days[j].Date
+		})
+		saved[tenant] = tenantSaved
+	}
+	csvService.usageDirty = false
+	csvService.usageMutex.Unlock()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err == nil {
+		temporary := csvService.usagePath + ".tmp"
+		if err = os.WriteFile(temporary, data, 0644); err == nil {
+			if err = os.Rename(temporary, csvService.usagePath); err != nil {
+				os.Remove(temporary)
+			}
+		}
+	}
+	if err != nil {
+		csvService.usageMutex.Lock()
+		csvService.usageDirty = true
+		csvService.usageMutex.Unlock()
+	}
+	return err
+}
+
+// saveUsagePeriodically saves changed usage every interval.
+func (csvService *CsvProcessingService) saveUsagePeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := csvService.SaveUsage(); err != nil {
+			log.Printf("[SERVICE] [QUOTA] [ERROR] Failed to save tenant usage - File: %s, Error: %v", csvService.usagePath, err)
+		}
+	}
+}
+
+// GetUsage returns the quota of tenant, what it uses now and its usage over
+// the last days UTC days, most recent first. Days without activity are left out.
+func (csvService *CsvProcessingService) GetUsage(tenant string, days int) (*models.UsageResponse, error) {
+	if days < 1 || days > usageHistoryDays {
+		return nil, fmt.Errorf("days must be between 1 and %d", usageHistoryDays)
+	}
+
+	csvService.usageMutex.Lock()
+	defer csvService.usageMutex.Unlock()
+
+	usage := csvService.tenantUsage(tenant)
+	response := &models.UsageResponse{
+		Tenant:      tenant,
+		Quota:       csvService.quotaFor(tenant),
+		RunningJobs: usage.runningJobs,
+		BytesStored: usage.bytesStored,
+		Days:        make([]models.DailyUsage, 0, days),
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days).Format(usageDateLayout)
+	for date, day := range usage.days {
+		if date > since {
+			response.Days = append(response.Days, *day)
+		}
+	}
+	sort.Slice(response.Days, func(i, j int) bool {
+		return response.Days[i].Date > response.Days[j].Date
+	})
+	return response, nil
+}
+
+// tenantQuotasPath is TENANT_QUOTAS_FILE, or tenant_quotas.json in storageDir.
+func tenantQuotasPath(storageDir string) string {
+	if path := os.Getenv("TENANT_QUOTAS_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join(storageDir, tenantQuotasFileName)
+}
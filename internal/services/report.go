@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"demandscience/internal/models"
+	"embed"
+	"errors"
+	"html/template"
+	"sort"
+	"time"
+)
+
+//go:embed templates/*.html
+var reportTemplates embed.FS
+
+var reportTemplate = template.Must(template.ParseFS(reportTemplates, "templates/report.html"))
+
+const (
+	// reportChartWidth is the width in pixels of the longest bar of a chart.
+	reportChartWidth = 360
+	reportBarHeight  = 22
+)
+
+var invalidReasonLabels = map[string]string{
+	InvalidReasonNoEmailField:      "No email-like field",
+	InvalidReasonMissingLocalPart:  "Nothing before @",
+	InvalidReasonMissingDomain:     "Nothing after @",
+	InvalidReasonMultipleAt:        "More than one @",
+	InvalidReasonMissingTLD:        "Missing top-level domain",
+	InvalidReasonInvalidCharacters: "Invalid characters",
+}
+
+// reportBar is one bar of a horizontal SVG bar chart.
+type reportBar struct {
+	Label string
+	Count int
+	Width int
+	Y     int
+}
+
+// reportChart is a horizontal bar chart with its SVG height.
+type reportChart struct {
+	Bars   []reportBar
+	Height int
+}
+
+type reportData struct {
+	Job            *models.ProcessingJob
+	Stats          *models.JobStats
+	ProcessedRows  int
+	InvalidEmails  int
+	ValidPercent   float64
+	InvalidPercent float64
+	// ValidWidth is the share of the validity bar, out of reportChartWidth.
+	ValidWidth     int
+	ChartWidth     int
+	ProcessingTime time.Duration
+	Domains        reportChart
+	Reasons        reportChart
+	GeneratedAt    time.Time
+}
+
+// newReportChart scales counts so the largest bar spans reportChartWidth.
+func newReportChart(values []models.ValueCount) reportChart {
+	chart := reportChart{}
+	largest := 0
+	for _, value := range values {
+		largest = max(largest, value.Count)
+	}
+	for i, value := range values {
+		width := 0
+		if largest > 0 {
+			width = max(1, value.Count*reportChartWidth/largest)
+		}
+		chart.Bars = append(chart.Bars, reportBar{
+			Label: value.Value,
+			Count: value.Count,
+			Width: width,
+			Y:     i * (reportBarHeight + 6),
+		})
+	}
+	chart.Height = len(chart.Bars) * (reportBarHeight + 6)
+	return chart
+}
+
+// RenderJobReport renders the HTML summary of a completed job. The page is
+// self-contained: styles and SVG charts are inline.
+func (csvService *CsvProcessingService) RenderJobReport(jobID string) ([]byte, error) {
+	job := csvService.GetJob(jobID)
+	if job == nil {
+		return nil, errors.New("job not found")
+	}
+
+	csvService.jobsMutex.RLock()
+	snapshot := *job
+	csvService.jobsMutex.RUnlock()
+	if snapshot.Status != models.JobStatusCompleted || snapshot.Stats == nil || snapshot.CompletedAt == nil {
+		return nil, errors.New("report not available")
+	}
+
+	stats := snapshot.Stats
+	data := reportData{
+		Job:            &snapshot,
+		Stats:          stats,
+		ProcessedRows:  stats.TotalRecords - stats.EmptyRecords,
+		ChartWidth:     reportChartWidth,
+		ProcessingTime: snapshot.CompletedAt.Sub(snapshot.CreatedAt).Round(time.Millisecond),
+		Domains:        newReportChart(stats.TopDomains),
+		GeneratedAt:    time.Now().UTC(),
+	}
+	data.InvalidEmails = data.ProcessedRows - stats.EmailsFound
+	data.ValidPercent = percentage(stats.EmailsFound, data.ProcessedRows)
+	data.InvalidPercent = percentage(data.InvalidEmails, data.ProcessedRows)
+	if data.ProcessedRows > 0 {
+		data.ValidWidth = stats.EmailsFound * reportChartWidth / data.ProcessedRows
+	}
+
+	reasons := make([]models.ValueCount, 0, len(stats.InvalidReasons))
+	for reason, count := range stats.InvalidReasons {
+		label := invalidReasonLabels[reason]
+		if label == "" {
+			label = reason
+		}
+		reasons = append(reasons, models.ValueCount{Value: label, Count: count})
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if reasons[i].Count != reasons[j].Count {
+			return reasons[i].Count > reasons[j].Count
+		}
+		return reasons[i].Value < reasons[j].Value
+	})
+	data.Reasons = newReportChart(reasons)
+
+	var page bytes.Buffer
+	if err := reportTemplate.Execute(&page, data); err != nil {
+		return nil, err
+	}
+	return page.Bytes(), nil
+}
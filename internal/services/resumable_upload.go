@@ -0,0 +1,338 @@
+package services
+
+import (
+	"crypto/sha256"
+	"demandscience/internal/models"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// resumableUploadsDir holds the partial files of resumable uploads, relative to the storage directory.
+const resumableUploadsDir = "uploads"
+
+// resumableUploadSweepInterval is the longest time an expired upload stays on disk.
+const resumableUploadSweepInterval = time.Minute
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match the current offset")
+	ErrUploadTooLarge       = errors.New("upload length exceeds the maximum file size")
+	ErrUploadExceedsLength  = errors.New("chunk extends past the declared upload length")
+	ErrUploadProcessing     = errors.New("upload is still being processed")
+)
+
+// resumableUpload is the service-side state of an upload. mutex serializes
+// chunk writes so concurrent PATCH requests cannot interleave. hash covers the
+// bytes written so far; it is nil once a write failed part way.
+type resumableUpload struct {
+	mutex sync.Mutex
+	info  models.ResumableUpload
+	path  string
+	hash  hash.Hash
+}
+
+// CreateResumableUpload registers an empty upload of the given length. The
+// file name and options are validated up front so a bad upload fails before
+// any bytes are sent.
+func (csvService *CsvProcessingService) CreateResumableUpload(fileName string, length int64, options models.ProcessingOptions) (*models.ResumableUpload, error) {
+	log.Printf("[SERVICE] [RESUMABLE] Creating resumable upload - File: %s, Length: %d bytes", fileName, length)
+
+	if length < 0 {
+		return nil, errors.New("upload length must not be negative")
+	}
+	if limit := csvService.maxFileSize(options.Tenant); length > limit {
+		log.Printf("[SERVICE] [RESUMABLE] [ERROR] Upload too large - File: %s, Length: %d bytes, Limit: %d bytes",
+			fileName, length, limit)
+		return nil, ErrUploadTooLarge
+	}
+	if uploadKind(fileName) == "" || filepath.Base(fileName) != fileName {
+		log.Printf("[SERVICE] [RESUMABLE] [ERROR] Invalid file type - File: %s", fileName)
+		return nil, errors.New("invalid file type. Only CSV, CSV.GZ, ZIP and XLSX files are allowed")
+	}
+
+	options, err := csvService.validateOptions(options)
+	if err != nil {
+		log.Printf("[SERVICE] [RESUMABLE] [ERROR] Option validation failed - File: %s, Error: %v", fileName, err)
+		return nil, err
+	}
+
+	uploadID := uuid.New().String()
+	path := filepath.Join(csvService.storageDir, resumableUploadsDir, uploadID+".part")
+	file, err := os.Create(path)
+	if err != nil {
+		log.Printf("[SERVICE] [RESUMABLE] [ERROR] Failed to create upload file - UploadID: %s, Error: %v", uploadID, err)
+		return nil, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	file.Close()
+
+	upload := &resumableUpload{
+		info: *models.DSResumableUpload(uploadID, fileName, length, options, time.Now().Add(ResumableUploadExpiry)),
+		path: path,
+		hash: sha256.New(),
+	}
+
+	csvService.uploadsMutex.Lock()
+	csvService.uploads[uploadID] = upload
+	csvService.uploadsMutex.Unlock()
+
+	log.Printf("[SERVICE] [RESUMABLE] [SUCCESS] Resumable upload created - UploadID: %s, File: %s, ExpiresAt: %s",
+		uploadID, fileName, upload.info.ExpiresAt.Format(time.RFC3339))
+
+	// An empty file is complete as soon as it is created.
+	if length == 0 {
+		return csvService.WriteResumableChunk(uploadID, 0, strings.NewReader(""), 0)
+	}
+	return csvService.GetResumableUpload(uploadID), nil
+}
+
+// GetResumableUpload returns a snapshot of an upload, or nil if it does not exist or expired.
+func (csvService *CsvProcessingService) GetResumableUpload(uploadID string) *models.ResumableUpload {
+	upload := csvService.resumableUpload(uploadID)
+	if upload == nil {
+		return nil
+	}
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+	return upload.snapshot()
+}
+
+// WriteResumableChunk appends chunk to an upload at offset, which must equal
+// the current offset. Bytes received before a broken connection are kept so
+// the client can resume from the reported offset. A chunk that extends past
+// the declared length is rejected without moving the offset: up front when
+// chunkLength is known, otherwise by rolling back what was written. chunkLength
+// is -1 when unknown. Once the declared length is reached the file is handed
+// to processing and the job IDs are recorded.
+func (csvService *CsvProcessingService) WriteResumableChunk(uploadID string, offset int64, chunk io.Reader, chunkLength int64) (*models.ResumableUpload, error) {
+	upload := csvService.resumableUpload(uploadID)
+	if upload == nil {
+		log.Printf("[SERVICE] [RESUMABLE] [ERROR] Upload not found - UploadID: %s", uploadID)
+		return nil, ErrUploadNotFound
+	}
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+
+	if offset != upload.info.Offset {
+		log.Printf("[SERVICE] [RESUMABLE] [ERROR] Offset mismatch - UploadID: %s, Offset: %d, Expected: %d",
+			uploadID, offset, upload.info.Offset)
+		return upload.snapshot(), ErrUploadOffsetMismatch
+	}
+
+	remaining := upload.info.Length - upload.info.Offset
+	if chunkLength > remaining {
+		log.Printf("[SERVICE] [RESUMABLE] [ERROR] Chunk exceeds upload length - UploadID: %s, Chunk: %d, Remaining: %d",
+			uploadID, chunkLength, remaining)
+		return upload.snapshot(), ErrUploadExceedsLength
+	}
+	if remaining > 0 {
+		file, err := os.OpenFile(upload.path, os.O_WRONLY, 0)
+		if err != nil {
+			return upload.snapshot(), fmt.Errorf("failed to open upload file: %w", err)
+		}
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return upload.snapshot(), fmt.Errorf("failed to seek upload file: %w", err)
+		}
+
+		var destination io.Writer = file
+		if upload.hash != nil {
+			destination = io.MultiWriter(file, upload.hash)
+		}
+		written, copyErr := io.Copy(destination, io.LimitReader(chunk, remaining))
+		closeErr := file.Close()
+		if copyErr != nil || closeErr != nil {
+			// The hash may not match the file any more
+			upload.hash = nil
+		} else if chunkExceeds(chunk) {
+			// Bodies of unknown length are only found too long once written
+			upload.hash = nil
+			if err := os.Truncate(upload.path, offset); err != nil {
+				return upload.snapshot(), fmt.Errorf("failed to discard chunk: %w", err)
+			}
+			log.Printf("[SERVICE] [RESUMABLE] [ERROR] Chunk exceeds upload length - UploadID: %s, Length: %d",
+				uploadID, upload.info.Length)
+			return upload.snapshot(), ErrUploadExceedsLength
+		}
+
+		upload.info.Offset += written
+		upload.info.ExpiresAt = time.Now().Add(ResumableUploadExpiry)
+		log.Printf("[SERVICE] [RESUMABLE] Chunk written - UploadID: %s, Bytes: %d, Offset: %d/%d",
+			uploadID, written, upload.info.Offset, upload.info.Length)
+
+		if copyErr != nil {
+			log.Printf("[SERVICE] [RESUMABLE] [ERROR] Chunk interrupted - UploadID: %s, Error: %v", uploadID, copyErr)
+			return upload.snapshot(), fmt.Errorf("failed to write chunk: %w", copyErr)
+		}
+		if closeErr != nil {
+			return upload.snapshot(), fmt.Errorf("failed to write chunk: %w", closeErr)
+		}
+	} else if chunkExceeds(chunk) {
+		log.Printf("[SERVICE] [RESUMABLE] [ERROR] Chunk exceeds upload length - UploadID: %s, Length: %d",
+			uploadID, upload.info.Length)
+		return upload.snapshot(), ErrUploadExceedsLength
+	}
+
+	if upload.info.Offset == upload.info.Length && upload.info.JobIDs == nil {
+		source := localFileSource{path: upload.path, name: upload.info.FileName, size: upload.info.Length}
+		if upload.hash != nil {
+			source.digest = hex.EncodeToString(upload.hash.Sum(nil))
+		}
+		jobIDs, err := csvService.processSource(source, upload.info.Options)
+		if err != nil {
+			log.Printf("[SERVICE] [RESUMABLE] [ERROR] Failed to start processing - UploadID: %s, Error: %v", uploadID, err)
+			return upload.snapshot(), err
+		}
+		upload.info.JobIDs = jobIDs
+		log.Printf("[SERVICE] [RESUMABLE] [SUCCESS] Upload complete, processing started - UploadID: %s, Jobs: %d",
+			uploadID, len(jobIDs))
+	}
+
+	return upload.snapshot(), nil
+}
+
+// jobsRunning reports whether any of the given jobs is still in progress.
+func (csvService *CsvProcessingService) jobsRunning(jobIDs []string) bool {
+	csvService.jobsMutex.RLock()
+	defer csvService.jobsMutex.RUnlock()
+	for _, jobID := range jobIDs {
+		if job := csvService.jobs[jobID]; job != nil && job.Status == models.JobStatusInProgress {
+			return true
+		}
+	}
+	return false
+}
+
+// chunkExceeds reports whether chunk has bytes left after the declared length was read.
+func chunkExceeds(chunk io.Reader) bool {
+	n, _ := chunk.Read(make([]byte, 1))
+	return n > 0
+}
+
+// DeleteResumableUpload discards an upload and its partial file. A completed
+// upload whose jobs still read the file fails with ErrUploadProcessing.
+func (csvService *CsvProcessingService) DeleteResumableUpload(uploadID string) error {
+	csvService.uploadsMutex.Lock()
+	upload := csvService.uploads[uploadID]
+	csvService.uploadsMutex.Unlock()
+
+	if upload == nil {
+		return ErrUploadNotFound
+	}
+
+	upload.mutex.Lock()
+	defer upload.mutex.Unlock()
+	if csvService.jobsRunning(upload.info.JobIDs) {
+		log.Printf("[SERVICE] [RESUMABLE] [ERROR] Upload still being processed - UploadID: %s", uploadID)
+		return ErrUploadProcessing
+	}
+
+	csvService.uploadsMutex.Lock()
+	_, tracked := csvService.uploads[uploadID]
+	delete(csvService.uploads, uploadID)
+	csvService.uploadsMutex.Unlock()
+	if !tracked {
+		return ErrUploadNotFound
+	}
+
+	if err := os.Remove(upload.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove upload file: %w", err)
+	}
+
+	log.Printf("[SERVICE] [RESUMABLE] Upload deleted - UploadID: %s", uploadID)
+	return nil
+}
+
+// ExpireResumableUploads removes uploads that received no chunk within
+// ResumableUploadExpiry, along with partial files left behind by a previous
+// run of the service. Completed uploads are kept until their jobs finish. It
+// returns the number of uploads removed.
+func (csvService *CsvProcessingService) ExpireResumableUploads() int {
+	now := time.Now()
+	removed := 0
+
+	csvService.uploadsMutex.Lock()
+	for uploadID, upload := range csvService.uploads {
+		// Skip uploads that are receiving a chunk; the write extends their expiry.
+		if !upload.mutex.TryLock() {
+			continue
+		}
+		if now.After(upload.info.ExpiresAt) && !csvService.jobsRunning(upload.info.JobIDs) {
+			delete(csvService.uploads, uploadID)
+			if err := os.Remove(upload.path); err != nil && !os.IsNotExist(err) {
+				log.Printf("[SERVICE] [RESUMABLE] [ERROR] Failed to remove expired upload - UploadID: %s, Error: %v",
+					uploadID, err)
+			}
+			removed++
+		}
+		upload.mutex.Unlock()
+	}
+	tracked := make(map[string]bool, len(csvService.uploads))
+	for _, upload := range csvService.uploads {
+		tracked[upload.path] = true
+	}
+	csvService.uploadsMutex.Unlock()
+
+	paths, _ := filepath.Glob(filepath.Join(csvService.storageDir, resumableUploadsDir, "*.part"))
+	for _, path := range paths {
+		if tracked[path] {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && now.Sub(info.ModTime()) > ResumableUploadExpiry {
+			if err := os.Remove(path); err == nil {
+				removed++
+			}
+		}
+	}
+
+	if removed > 0 {
+		log.Printf("[SERVICE] [RESUMABLE] Expired resumable uploads removed - Count: %d", removed)
+	}
+	return removed
+}
+
+// resumableUploadSweepEvery returns how often expired uploads are looked for.
+func resumableUploadSweepEvery() time.Duration {
+	if ResumableUploadExpiry > 0 && ResumableUploadExpiry < resumableUploadSweepInterval {
+		return ResumableUploadExpiry
+	}
+	return resumableUploadSweepInterval
+}
+
+func (csvService *CsvProcessingService) expireResumableUploadsPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		csvService.ExpireResumableUploads()
+	}
+}
+
+func (csvService *CsvProcessingService) resumableUpload(uploadID string) *resumableUpload {
+	csvService.uploadsMutex.Lock()
+	defer csvService.uploadsMutex.Unlock()
+
+	upload := csvService.uploads[uploadID]
+	if upload == nil || time.Now().After(upload.info.ExpiresAt) {
+		return nil
+	}
+	return upload
+}
+
+// snapshot copies the upload state so callers can read it without the lock.
+func (upload *resumableUpload) snapshot() *models.ResumableUpload {
+	info := upload.info
+	info.JobIDs = append([]string(nil), upload.info.JobIDs...)
+	return &info
+}
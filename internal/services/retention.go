@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"demandscience/internal/models"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadRetention is how long original uploads are kept in storage so their
+// jobs can be re-run; zero disables retention.
+var UploadRetention = 7 * 24 * time.Hour
+
+// inputsPrefix is the storage key prefix of retained uploads.
+const inputsPrefix = "inputs/"
+
+// ErrInputNotRetained is returned when re-running a job whose upload is gone.
+var ErrInputNotRetained = errors.New("the original upload of this job is no longer retained")
+
+// retainedInput is a retained upload in storage, counted against its tenant.
+type retainedInput struct {
+	tenant    string
+	size      int64
+	expiresAt time.Time
+}
+
+func init() {
+	if value := os.Getenv("UPLOAD_RETENTION"); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid UPLOAD_RETENTION in .env: %v", err)
+		}
+		UploadRetention = retention
+	}
+}
+
+// digestUpload returns the SHA-256 of an upload, or "" when it cannot be
+// read, which leaves the job out of the cache. Files hashed while they were
+// written are not read again.
+func digestUpload(source uploadSource) string {
+	if local, ok := source.(localFileSource); ok && local.digest != "" {
+		return local.digest
+	}
+	file, err := source.Open()
+	if err != nil {
+		log.Printf("[SERVICE] [RETAIN] [ERROR] Failed to open upload - File: %s, Error: %v", source.Name(), err)
+		return ""
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		log.Printf("[SERVICE] [RETAIN] [ERROR] Failed to hash upload - File: %s, Error: %v", source.Name(), err)
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// retainInput copies an upload to storage for later re-runs, under the
+// storage prefix of tenant. Failing to retain an upload only disables
+// re-runs, so errors are logged and nil returned.
+func (csvService *CsvProcessingService) retainInput(source uploadSource, tenant string) *models.JobInput {
+	if UploadRetention <= 0 {
+		return nil
+	}
+	file, err := source.Open()
+	if err != nil {
+		log.Printf("[SERVICE] [RETAIN] [ERROR] Failed to open upload - File: %s, Error: %v", source.Name(), err)
+		return nil
+	}
+	defer file.Close()
+
+	input := &models.JobInput{
+		Key:       tenantKey(tenant, inputsPrefix+uuid.New().String()+"_"+filepath.Base(source.Name())),
+		FileName:  source.Name(),
+		Size:      source.Size(),
+		ExpiresAt: time.Now().Add(UploadRetention),
+	}
+	if err := csvService.storage.Put(context.Background(), input.Key, file, source.Size()); err != nil {
+		log.Printf("[SERVICE] [RETAIN] [ERROR] Failed to store upload - File: %s, Error: %v", source.Name(), err)
+		return nil
+	}
+
+	csvService.jobsMutex.Lock()
+	csvService.inputs[input.Key] = retainedInput{tenant: tenant, size: input.Size, expiresAt: input.ExpiresAt}
+	csvService.jobsMutex.Unlock()
+	csvService.recordStored(tenant, input.Size)
+
+	log.Printf("[SERVICE] [RETAIN] Upload retained - File: %s, Key: %s, ExpiresAt: %v",
+		source.Name(), input.Key, input.ExpiresAt)
+	return input
+}
+
+// sharedInput retains an upload shared by several jobs, the entries of a
+// zip, once for all of them and only when one of them misses the cache.
+type sharedInput struct {
+	once  sync.Once
+	input *models.JobInput
+}
+
+func (shared *sharedInput) retain(csvService *CsvProcessingService, source uploadSource, tenant string) *models.JobInput {
+	shared.once.Do(func() {
+		shared.input = csvService.retainInput(source, tenant)
+	})
+	return shared.input
+}
+
+// RerunJob starts a new job from the retained upload of jobID on behalf of
+// the API key createdBy. Options, when given, replace those of the original
+// job; the zip mode, archive entry and tenant always stay the same. The new
+// job records the original in RerunOf.
+func (csvService *CsvProcessingService) RerunJob(jobID, createdBy string, options *models.ProcessingOptions) (string, error) {
+	csvService.jobsMutex.RLock()
+	original := csvService.jobs[jobID]
+	var input *models.JobInput
+	retained := false
+	if original != nil {
+		input = original.Input
+		if input != nil {
+			_, retained = csvService.inputs[input.Key]
+		}
+	}
+	csvService.jobsMutex.RUnlock()
+
+	if original == nil {
+		return "", ErrJobNotFound
+	}
+	if !retained {
+		log.Printf("[SERVICE] [RERUN] [ERROR] Upload not retained - JobID: %s", jobID)
+		return "", ErrInputNotRetained
+	}
+
+	rerunOptions := original.Options
+	if options != nil {
+		validated, err := csvService.validateOptions(*options)
+		if err != nil {
+			return "", err
+		}
+		validated.ZipMode = original.Options.ZipMode
+		rerunOptions = validated
+	}
+	rerunOptions.CreatedBy = createdBy
+	rerunOptions.Tenant = original.Tenant
+
+	source, err := csvService.fetchRetainedInput(input)
+	if err != nil {
+		log.Printf("[SERVICE] [RERUN] [ERROR] Failed to fetch retained upload - JobID: %s, Key: %s, Error: %v",
+			jobID, input.Key, err)
+		return "", err
+	}
+
+	if err := csvService.admitJobs(rerunOptions.Tenant, 1, source.Size()); err != nil {
+		os.Remove(source.path)
+		return "", err
+	}
+
+	job := csvService.newJob(original.OriginalFileName, rerunOptions)
+	job.ArchiveEntry = original.ArchiveEntry
+	job.Input = input
+	job.InputDigest = original.InputDigest
+	job.RerunOf = original.ID
+
+	csvService.jobsMutex.Lock()
+	original.Reruns = append(original.Reruns, job.ID)
+	csvService.jobsMutex.Unlock()
+
+	log.Printf("[SERVICE] [RERUN] Re-running job - JobID: %s, RerunOf: %s", job.ID, original.ID)
+	return csvService.startJob(source, job, nil), nil
+}
+
+// fetchRetainedInput copies a retained upload back to the uploads directory,
+// where it is cleaned up like other fetched files.
+func (csvService *CsvProcessingService) fetchRetainedInput(input *models.JobInput) (localFileSource, error) {
+	reader, err := csvService.storage.Open(context.Background(), input.Key)
+	if err != nil {
+		return localFileSource{}, fmt.Errorf("failed to read retained upload: %w", err)
+	}
+	defer reader.Close()
+
+	path := filepath.Join(csvService.storageDir, resumableUploadsDir, uuid.New().String()+".part")
+	file, err := os.Create(path)
+	if err != nil {
+		return localFileSource{}, err
+	}
+	written, err := io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return localFileSource{}, fmt.Errorf("failed to read retained upload: %w", err)
+	}
+	return localFileSource{path: path, name: input.FileName, size: written}, nil
+}
+
+// ExpireRetainedInputs deletes retained uploads older than UploadRetention
+// and returns how many were removed.
+func (csvService *CsvProcessingService) ExpireRetainedInputs() int {
+	now := time.Now()
+	expired := make(map[string]retainedInput)
+
+	csvService.jobsMutex.Lock()
+	for key, input := range csvService.inputs {
+		if now.After(input.expiresAt) {
+			expired[key] = input
+			delete(csvService.inputs, key)
+		}
+	}
+	csvService.jobsMutex.Unlock()
+
+	for key, input := range expired {
+		if err := csvService.storage.Delete(context.Background(), key); err != nil {
+			log.Printf("[SERVICE] [RETAIN] [ERROR] Failed to delete retained upload - Key: %s, Error: %v", key, err)
+			continue
+		}
+		csvService.recordStored(input.tenant, -input.size)
+	}
+	if len(expired) > 0 {
+		log.Printf("[SERVICE] [RETAIN] Expired retained uploads removed - Count: %d", len(expired))
+	}
+	return len(expired)
+}
+
+func (csvService *CsvProcessingService) expireRetainedInputsPeriodically(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		csvService.ExpireRetainedInputs()
+	}
+}
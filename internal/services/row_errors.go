@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ErrorModeStrict fails the job on the first malformed row.
+	ErrorModeStrict = "strict"
+	// ErrorModeTolerant skips malformed rows and reports them in an errors file.
+	ErrorModeTolerant = "tolerant"
+)
+
+// DefaultMaxRowErrors is the error budget of tolerant jobs that do not set max_errors.
+const DefaultMaxRowErrors = 100
+
+var errRowErrorBudget = errors.New("too many malformed rows")
+
+// rawRecordReader is a csv.Reader that remembers the raw text of the record it
+// just read, so a malformed row can be reported as it appeared in the input.
+type rawRecordReader struct {
+	reader  *csv.Reader
+	pending bytes.Buffer
+	offset  int64
+	raw     string
+	// sample, when set, keeps the first sampleLimit bytes consumed.
+	sample      *bytes.Buffer
+	sampleLimit int
+}
+
+func newRawRecordReader(input io.Reader) *rawRecordReader {
+	recorder := &rawRecordReader{}
+	recorder.reader = csv.NewReader(io.TeeReader(input, &recorder.pending))
+	return recorder
+}
+
+// Read returns the next record. Input that csv.Reader has consumed is dropped
+// from the buffer, which therefore only holds its read-ahead.
+func (recorder *rawRecordReader) Read() ([]string, error) {
+	record, err := recorder.reader.Read()
+
+	end := recorder.reader.InputOffset()
+	consumed := recorder.pending.Next(int(end - recorder.offset))
+	recorder.offset = end
+	if recorder.sample != nil && recorder.sample.Len() < recorder.sampleLimit {
+		recorder.sample.Write(consumed[:min(len(consumed), recorder.sampleLimit-recorder.sample.Len())])
+	}
+	if err != nil {
+		recorder.raw = strings.TrimRight(string(consumed), "\r\n")
+	}
+	return record, err
+}
+
+// rawText is the input text of the record that failed on the last Read.
+func (recorder *rawRecordReader) rawText() string {
+	return recorder.raw
+}
+
+// rowErrorReport writes malformed rows of a tolerant job to a CSV file, which
+// is only created once the first error is recorded.
+type rowErrorReport struct {
+	path   string
+	budget int
+	count  int
+	file   *os.File
+	writer *csv.Writer
+}
+
+func newRowErrorReport(path string, budget int) *rowErrorReport {
+	return &rowErrorReport{path: path, budget: budget}
+}
+
+// add records a malformed row and returns errRowErrorBudget once more rows
+// than the budget allows have failed.
+func (report *rowErrorReport) add(source string, line int, raw string, rowErr error) error {
+	if report.writer == nil {
+		file, err := os.Create(report.path)
+		if err != nil {
+			return fmt.Errorf("failed to create errors file: %w", err)
+		}
+		report.file = file
+		report.writer = csv.NewWriter(file)
+		report.writer.Write([]string{"source", "line", "raw", "error"})
+	}
+
+	report.count++
+	if err := report.writer.Write([]string{source, strconv.Itoa(line), raw, rowErr.Error()}); err != nil {
+		return fmt.Errorf("failed to write errors file: %w", err)
+	}
+
+	if report.count > report.budget {
+		return fmt.Errorf("%w: more than %d", errRowErrorBudget, report.budget)
+	}
+	return nil
+}
+
+// close flushes the errors file and reports whether one was written.
+func (report *rowErrorReport) close() (bool, error) {
+	if report.writer == nil {
+		return false, nil
+	}
+	report.writer.Flush()
+	if err := report.writer.Error(); err != nil {
+		report.file.Close()
+		return false, err
+	}
+	return true, report.file.Close()
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// rowSpool keeps the rows of an output that can only be written once every
+// value is known, such as typed parquet or SQLite columns, in a file next to
+// the output instead of in memory. Column types are inferred as rows arrive,
+// so memory does not grow with the number of rows.
+type rowSpool struct {
+	path     string
+	file     *os.File
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+	types    []columnType
+}
+
+func createRowSpool(outputPath string) (*rowSpool, error) {
+	path := outputPath + ".rows"
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewWriter(file)
+	return &rowSpool{path: path, file: file, buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+}
+
+// setColumns starts the type inference of count columns.
+func (spool *rowSpool) setColumns(count int) {
+	spool.types = make([]columnType, count)
+}
+
+// add stores record and widens the column types to fit its non-blank values.
+func (spool *rowSpool) add(record []string) error {
+	for column := range spool.types {
+		if column >= len(record) {
+			continue
+		}
+		if value := strings.TrimSpace(record[column]); value != "" && spool.types[column] != columnTypeString {
+			spool.types[column] = spool.types[column].widen(valueType(value))
+		}
+	}
+	return spool.encoder.Encode(record)
+}
+
+// each calls fn with every stored row, in order.
+func (spool *rowSpool) each(fn func(record []string) error) error {
+	if err := spool.buffered.Flush(); err != nil {
+		return err
+	}
+	if _, err := spool.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bufio.NewReader(spool.file))
+	for {
+		var record []string
+		if err := decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// remove deletes the spooled rows.
+func (spool *rowSpool) remove() {
+	spool.file.Close()
+	os.Remove(spool.path)
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	sqliteRecordsTable = "records"
+	sqliteSummaryTable = "job_summary"
+)
+
+// jobSummary is the per-job metadata written next to the rows by outputs that
+// can hold more than one table.
+type jobSummary struct {
+	JobID            string
+	OriginalFileName string
+	SourceFormat     string
+	Encoding         string
+	Delimiter        string
+	TotalRecords     int
+	EmailsFound      int
+	EmptyRecords     int
+	CreatedAt        time.Time
+}
+
+// summaryWriter is implemented by record writers that store the job summary.
+// It is called once, after the last row and before Close.
+type summaryWriter interface {
+	WriteSummary(summary jobSummary) error
+}
+
+// sqliteRecordWriter spools the rows of a job, infers a column type for each
+// header and writes them into a records table, plus a job_summary table.
+type sqliteRecordWriter struct {
+	db      *sql.DB
+	spool   *rowSpool
+	headers []string
+	summary *jobSummary
+}
+
+func createSQLiteRecordWriter(outputPath string) (*sqliteRecordWriter, error) {
+	if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", outputPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	spool, err := createRowSpool(outputPath)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteRecordWriter{db: db, spool: spool}, nil
+}
+
+func (output *sqliteRecordWriter) WriteHeader(headers []string) error {
+	output.headers = append([]string(nil), headers...)
+	output.spool.setColumns(len(headers))
+	return nil
+}
+
+func (output *sqliteRecordWriter) Write(record []string) error {
+	return output.spool.add(record)
+}
+
+func (output *sqliteRecordWriter) WriteSummary(summary jobSummary) error {
+	output.summary = &summary
+	return nil
+}
+
+func (output *sqliteRecordWriter) Close() error {
+	defer output.db.Close()
+	defer output.spool.remove()
+
+	tx, err := output.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sqlite writer error: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := output.writeRecords(tx); err != nil {
+		return fmt.Errorf("sqlite writer error: %w", err)
+	}
+	if output.summary != nil {
+		if err := output.writeSummary(tx); err != nil {
+			return fmt.Errorf("sqlite writer error: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite writer error: %w", err)
+	}
+	return output.db.Close()
+}
+
+func (output *sqliteRecordWriter) writeRecords(tx *sql.Tx) error {
+	names := uniqueColumnNames(output.headers)
+	columnTypes := output.spool.types
+	definitions := make([]string, len(output.headers))
+	placeholders := make([]string, len(output.headers))
+	for column := range output.headers {
+		definitions[column] = quoteSQLiteIdentifier(names[column]) + " " + sqliteColumnType(columnTypes[column])
+		placeholders[column] = "?"
+	}
+
+	if _, err := tx.Exec("CREATE TABLE " + sqliteRecordsTable + " (" + strings.Join(definitions, ", ") + ")"); err != nil {
+		return err
+	}
+
+	insert, err := tx.Prepare("INSERT INTO " + sqliteRecordsTable + " VALUES (" + strings.Join(placeholders, ", ") + ")")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	values := make([]interface{}, len(output.headers))
+	return output.spool.each(func(record []string) error {
+		for column := range output.headers {
+			values[column] = nil
+			if column >= len(record) || strings.TrimSpace(record[column]) == "" {
+				continue
+			}
+			values[column] = columnTypes[column].parse(strings.TrimSpace(record[column])).Interface()
+		}
+		_, err := insert.Exec(values...)
+		return err
+	})
+}
+
+func (output *sqliteRecordWriter) writeSummary(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE ` + sqliteSummaryTable + ` (
+		job_id TEXT PRIMARY KEY,
+		original_file_name TEXT,
+		source_format TEXT,
+		encoding TEXT,
+		delimiter TEXT,
+		total_records INTEGER,
+		emails_found INTEGER,
+		empty_records INTEGER,
+		created_at TEXT
+	)`)
+	if err != nil {
+		return err
+	}
+
+	summary := output.summary
+	_, err = tx.Exec("INSERT INTO "+sqliteSummaryTable+" VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		summary.JobID, summary.OriginalFileName, summary.SourceFormat, summary.Encoding, summary.Delimiter,
+		summary.TotalRecords, summary.EmailsFound, summary.EmptyRecords, summary.CreatedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func sqliteColumnType(t columnType) string {
+	switch t {
+	case columnTypeBoolean, columnTypeInteger:
+		return "INTEGER"
+	case columnTypeFloat:
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+func quoteSQLiteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
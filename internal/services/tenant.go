@@ -0,0 +1,33 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+)
+
+// tenantsPrefix is the storage key prefix under which each tenant has its own
+// directory. Files of the default tenant keep unprefixed keys.
+const tenantsPrefix = "tenants/"
+
+// ErrInvalidTenant is returned for a tenant name that cannot be used in a
+// storage key.
+var ErrInvalidTenant = errors.New("tenant must be 1 to 64 letters, digits, dots, dashes or underscores")
+
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidateTenant checks that tenant is empty, the default tenant, or a name
+// that is safe as a storage key segment.
+func ValidateTenant(tenant string) error {
+	if tenant != "" && !tenantPattern.MatchString(tenant) {
+		return ErrInvalidTenant
+	}
+	return nil
+}
+
+// tenantKey places a storage key under the prefix of tenant.
+func tenantKey(tenant, key string) string {
+	if tenant == "" {
+		return key
+	}
+	return tenantsPrefix + tenant + "/" + key
+}
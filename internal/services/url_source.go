@@ -0,0 +1,390 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"demandscience/internal/models"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sourceURLTimeout bounds the whole download of a source_url, body included.
+const sourceURLTimeout = 2 * time.Minute
+
+// sourceURLMaxRedirects is the number of redirects followed before giving up.
+const sourceURLMaxRedirects = 5
+
+// SourceURLAllowedNetworks lists CIDR ranges that source_url may reach even
+// though they are private, loopback or link-local. It is read when the service
+// is created.
+var SourceURLAllowedNetworks []*net.IPNet
+
+// SourceURLAllowedDirs lists the directories file:// source URLs may read from.
+// file:// URLs are rejected when it is empty.
+var SourceURLAllowedDirs []string
+
+var (
+	ErrSourceURLBlocked     = errors.New("source_url points to a blocked address")
+	ErrSourceTooLarge       = errors.New("source file exceeds the maximum file size")
+	ErrSourceContentType    = errors.New("source_url returned an unsupported content type")
+	errSourceURLScheme      = errors.New("source_url must use http, https or file")
+	errSourceFileNotAllowed = errors.New("file:// source_url is outside the allowed directories")
+)
+
+// blockedNetworks are ranges that are not publicly routable and could reach
+// services next to the processor. IsPrivate, IsLoopback and friends cover the
+// rest.
+var blockedNetworks = mustParseCIDRs("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4")
+
+// sourceContentTypes are the media types accepted for each upload kind.
+// application/octet-stream and a missing type are accepted for every kind.
+var sourceContentTypes = map[string][]string{
+	uploadKindCSV:  {"text/csv", "text/plain", "application/csv", "text/comma-separated-values", "application/vnd.ms-excel"},
+	uploadKindGzip: {"application/gzip", "application/x-gzip"},
+	uploadKindZip:  {"application/zip", "application/x-zip-compressed"},
+	uploadKindXLSX: {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+}
+
+// sourceExtensions names downloads whose URL has no usable file name.
+var sourceExtensions = map[string]string{
+	uploadKindCSV:  ".csv",
+	uploadKindGzip: ".csv.gz",
+	uploadKindZip:  ".zip",
+	uploadKindXLSX: ".xlsx",
+}
+
+// ProcessSourceURL downloads the file at sourceURL and processes it like an
+// upload with the same options. The body is streamed to the storage directory
+// and the file size limit of the tenant is enforced on the bytes read,
+// whatever the server claims.
+func (csvService *CsvProcessingService) ProcessSourceURL(ctx context.Context, sourceURL string, options models.ProcessingOptions) ([]string, error) {
+	log.Printf("[SERVICE] [PROCESS_URL] Starting source URL processing - URL: %s", sourceURL)
+
+	options, err := csvService.validateOptions(options)
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_URL] [ERROR] Option validation failed - URL: %s, Error: %v", sourceURL, err)
+		return nil, err
+	}
+
+	source, err := csvService.fetchSourceURL(ctx, sourceURL, csvService.maxFileSize(options.Tenant))
+	if err != nil {
+		log.Printf("[SERVICE] [PROCESS_URL] [ERROR] Failed to fetch source - URL: %s, Error: %v", sourceURL, err)
+		return nil, err
+	}
+
+	jobIDs, err := csvService.processSource(source, options)
+	if err != nil {
+		os.Remove(source.path)
+		return nil, err
+	}
+
+	log.Printf("[SERVICE] [PROCESS_URL] [SUCCESS] Source URL processing initiated - URL: %s, File: %s, Size: %d bytes, Jobs: %d",
+		sourceURL, source.name, source.size, len(jobIDs))
+	return jobIDs, nil
+}
+
+// fetchSourceURL copies the source into the uploads directory. Fetched files
+// are swept together with expired resumable uploads. Sources over limit bytes
+// fail with ErrSourceTooLarge.
+func (csvService *CsvProcessingService) fetchSourceURL(ctx context.Context, sourceURL string, limit int64) (localFileSource, error) {
+	parsed, err := url.Parse(sourceURL)
+	if err != nil {
+		return localFileSource{}, fmt.Errorf("invalid source_url: %w", err)
+	}
+
+	var body io.ReadCloser
+	var name, contentType string
+
+	switch parsed.Scheme {
+	case "http", "https":
+		body, name, contentType, err = openHTTPSource(ctx, csvService.sourceClient, parsed, limit)
+	case "file":
+		body, name, err = openFileSource(parsed)
+	default:
+		return localFileSource{}, errSourceURLScheme
+	}
+	if err != nil {
+		return localFileSource{}, err
+	}
+	defer body.Close()
+
+	name, err = sourceFileName(name, contentType)
+	if err != nil {
+		return localFileSource{}, err
+	}
+
+	destination := filepath.Join(csvService.storageDir, resumableUploadsDir, uuid.New().String()+".part")
+	file, err := os.Create(destination)
+	if err != nil {
+		return localFileSource{}, fmt.Errorf("failed to store source file: %w", err)
+	}
+
+	// Hash the file as it downloads so the cache lookup does not read it again
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(body, limit+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > limit {
+		err = ErrSourceTooLarge
+	}
+	if err != nil {
+		os.Remove(destination)
+		if errors.Is(err, ErrSourceTooLarge) {
+			return localFileSource{}, err
+		}
+		return localFileSource{}, fmt.Errorf("failed to download source file: %w", err)
+	}
+
+	log.Printf("[SERVICE] [PROCESS_URL] Source downloaded - URL: %s, File: %s, Size: %d bytes", sourceURL, name, written)
+	return localFileSource{path: destination, name: name, size: written, digest: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+func openHTTPSource(ctx context.Context, client *http.Client, sourceURL *url.URL, limit int64) (io.ReadCloser, string, string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL.String(), nil)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("invalid source_url: %w", err)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		if errors.Is(err, ErrSourceURLBlocked) {
+			return nil, "", "", ErrSourceURLBlocked
+		}
+		return nil, "", "", fmt.Errorf("failed to download source file: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		return nil, "", "", fmt.Errorf("source_url returned status %d", response.StatusCode)
+	}
+	if response.ContentLength > limit {
+		response.Body.Close()
+		return nil, "", "", ErrSourceTooLarge
+	}
+
+	name := path.Base(response.Request.URL.Path)
+	if _, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = path.Base(params["filename"])
+	}
+
+	contentType := ""
+	if header := response.Header.Get("Content-Type"); header != "" {
+		mediaType, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			response.Body.Close()
+			return nil, "", "", ErrSourceContentType
+		}
+		contentType = mediaType
+	}
+
+	if err := checkSourceContentType(name, contentType); err != nil {
+		response.Body.Close()
+		return nil, "", "", err
+	}
+	return response.Body, name, contentType, nil
+}
+
+// openFileSource opens a file:// URL after resolving symlinks, so a link inside
+// an allowed directory cannot point outside of it.
+func openFileSource(sourceURL *url.URL) (io.ReadCloser, string, error) {
+	if sourceURL.Host != "" && sourceURL.Host != "localhost" {
+		return nil, "", errSourceFileNotAllowed
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(sourceURL.Path))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open source file: %w", err)
+	}
+
+	allowed := false
+	for _, dir := range SourceURLAllowedDirs {
+		root, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		if relative, err := filepath.Rel(root, resolved); err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, "", errSourceFileNotAllowed
+	}
+
+	file, err := os.Open(resolved)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open source file: %w", err)
+	}
+	if info, err := file.Stat(); err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		return nil, "", errors.New("source_url is not a regular file")
+	}
+	return file, filepath.Base(resolved), nil
+}
+
+// sourceFileName returns a name whose extension selects the upload kind,
+// falling back to the content type when the URL has no usable file name.
+func sourceFileName(name, contentType string) (string, error) {
+	if uploadKind(name) != "" {
+		return name, nil
+	}
+	for kind, contentTypes := range sourceContentTypes {
+		for _, candidate := range contentTypes {
+			if candidate == contentType {
+				base := strings.TrimSuffix(name, path.Ext(name))
+				if base == "" || base == "." || base == "/" {
+					base = "download"
+				}
+				return base + sourceExtensions[kind], nil
+			}
+		}
+	}
+	return "", errors.New("invalid file type. Only CSV, CSV.GZ, ZIP and XLSX files are allowed")
+}
+
+// checkSourceContentType rejects responses whose type contradicts the file
+// name, such as an HTML error page served for a .csv URL.
+func checkSourceContentType(name, contentType string) error {
+	if contentType == "" || contentType == "application/octet-stream" {
+		return nil
+	}
+
+	kind := uploadKind(name)
+	if kind == "" {
+		for _, contentTypes := range sourceContentTypes {
+			for _, candidate := range contentTypes {
+				if candidate == contentType {
+					return nil
+				}
+			}
+		}
+		return ErrSourceContentType
+	}
+
+	for _, candidate := range sourceContentTypes[kind] {
+		if candidate == contentType {
+			return nil
+		}
+	}
+	return ErrSourceContentType
+}
+
+// CloseIdleConnections closes the idle connections kept by source_url downloads.
+func (csvService *CsvProcessingService) CloseIdleConnections() {
+	csvService.sourceClient.CloseIdleConnections()
+}
+
+// sourceHTTPClient checks every address it connects to, including redirect
+// targets and addresses returned by DNS, against the SSRF rules, allowing the
+// given internal networks. The client is shared by every source_url download
+// of a service so idle connections are reused and closed, rather than left
+// behind by a transport per download. Proxies from the environment are
+// ignored because they would hide the real destination.
+func sourceHTTPClient(allowed []*net.IPNet) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !sourceAddressAllowed(ip, allowed) {
+				log.Printf("[SERVICE] [PROCESS_URL] [ERROR] Blocked connection to address - Address: %s", address)
+				return ErrSourceURLBlocked
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: sourceURLTimeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= sourceURLMaxRedirects {
+				return errors.New("source_url redirected too many times")
+			}
+			if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+				return errSourceURLScheme
+			}
+			return nil
+		},
+	}
+}
+
+// sourceAddressAllowed reports whether source_url may connect to ip. Public
+// addresses are always allowed; internal ranges only when in allowed.
+func sourceAddressAllowed(ip net.IP, allowed []*net.IPNet) bool {
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCIDRList parses a comma separated list of CIDR ranges or single addresses.
+func parseCIDRList(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks, err := parseCIDRList(strings.Join(cidrs, ","))
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
@@ -0,0 +1,478 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errSheetNotFound = errors.New("sheet not found")
+
+// xlsxMaxColumns is the number of columns Excel allows, A to XFD.
+const xlsxMaxColumns = 16384
+
+// builtinDateFormats are the predefined SpreadsheetML number formats that render dates or times.
+var builtinDateFormats = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	45: true, 46: true, 47: true,
+	50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+}
+
+type xlsxWorkbook struct {
+	WorkbookPr struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name  string `xml:"name,attr"`
+		State string `xml:"state,attr"`
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxStyleSheet struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+// xlsxRowReader streams the rows of one worksheet as strings, so spreadsheet
+// uploads can be fed through the same record pipeline as CSV files.
+//
+// Cell values are converted consistently regardless of how they are displayed
+// in Excel: numbers use their shortest decimal form (15 significant digits),
+// date-formatted numbers become ISO 8601, booleans become true/false and
+// formulas yield their cached result.
+type xlsxRowReader struct {
+	sheetName     string
+	sheet         io.ReadCloser
+	decoder       *xml.Decoder
+	sharedStrings []string
+	dateStyles    map[int]bool
+	date1904      bool
+	width         int
+}
+
+// openXLSXSheet opens the worksheet selected by sheet, which is matched against
+// sheet names first and then taken as a 1-based position. An empty selector picks
+// the first visible sheet.
+func openXLSXSheet(file io.ReaderAt, size int64, sheet string, guard *decompressionGuard) (*xlsxRowReader, error) {
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read xlsx file: %w", err)
+	}
+
+	parts := make(map[string]*zip.File, len(archive.File))
+	for _, part := range archive.File {
+		parts[strings.TrimPrefix(part.Name, "/")] = part
+	}
+
+	var workbook xlsxWorkbook
+	if err := decodeXLSXPart(parts, "xl/workbook.xml", guard, &workbook); err != nil {
+		return nil, err
+	}
+	var relationships xlsxRelationships
+	if err := decodeXLSXPart(parts, "xl/_rels/workbook.xml.rels", guard, &relationships); err != nil {
+		return nil, err
+	}
+
+	sheetIndex, err := selectXLSXSheet(workbook, sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	sheetPath := ""
+	for _, relationship := range relationships.Relationships {
+		if relationship.ID == workbook.Sheets[sheetIndex].RelID {
+			sheetPath = relationship.Target
+		}
+	}
+	if strings.HasPrefix(sheetPath, "/") {
+		sheetPath = strings.TrimPrefix(sheetPath, "/")
+	} else {
+		sheetPath = path.Join("xl", sheetPath)
+	}
+	sheetPart, ok := parts[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("worksheet part missing from xlsx file: %s", sheetPath)
+	}
+
+	sharedStrings, err := readXLSXSharedStrings(parts, guard)
+	if err != nil {
+		return nil, err
+	}
+	dateStyles, err := readXLSXDateStyles(parts, guard)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := sheetPart.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worksheet: %w", err)
+	}
+
+	return &xlsxRowReader{
+		sheetName:     workbook.Sheets[sheetIndex].Name,
+		sheet:         stream,
+		decoder:       xml.NewDecoder(guard.wrap(stream, int64(sheetPart.CompressedSize64))),
+		sharedStrings: sharedStrings,
+		dateStyles:    dateStyles,
+		date1904:      workbook.WorkbookPr.Date1904,
+	}, nil
+}
+
+func selectXLSXSheet(workbook xlsxWorkbook, sheet string) (int, error) {
+	if len(workbook.Sheets) == 0 {
+		return 0, errors.New("xlsx file contains no sheets")
+	}
+
+	if sheet == "" {
+		for i, candidate := range workbook.Sheets {
+			if candidate.State == "" || candidate.State == "visible" {
+				return i, nil
+			}
+		}
+		return 0, nil
+	}
+
+	for i, candidate := range workbook.Sheets {
+		if candidate.Name == sheet {
+			return i, nil
+		}
+	}
+	for i, candidate := range workbook.Sheets {
+		if strings.EqualFold(candidate.Name, sheet) {
+			return i, nil
+		}
+	}
+	if position, err := strconv.Atoi(sheet); err == nil && position >= 1 && position <= len(workbook.Sheets) {
+		return position - 1, nil
+	}
+	return 0, fmt.Errorf("%w: %s", errSheetNotFound, sheet)
+}
+
+func decodeXLSXPart(parts map[string]*zip.File, name string, guard *decompressionGuard, target interface{}) error {
+	part, ok := parts[name]
+	if !ok {
+		return fmt.Errorf("invalid xlsx file: missing %s", name)
+	}
+	stream, err := part.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer stream.Close()
+
+	if err := xml.NewDecoder(guard.wrap(stream, int64(part.CompressedSize64))).Decode(target); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// readXLSXSharedStrings loads the shared string table, concatenating rich text
+// runs and skipping phonetic hints.
+func readXLSXSharedStrings(parts map[string]*zip.File, guard *decompressionGuard) ([]string, error) {
+	part, ok := parts["xl/sharedStrings.xml"]
+	if !ok {
+		return nil, nil
+	}
+	stream, err := part.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shared strings: %w", err)
+	}
+	defer stream.Close()
+
+	decoder := xml.NewDecoder(guard.wrap(stream, int64(part.CompressedSize64)))
+	var sharedStrings []string
+	var current strings.Builder
+	inText, inPhonetic := false, false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return sharedStrings, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse shared strings: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				inText = true
+			case "rPh":
+				inPhonetic = true
+			}
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "si":
+				sharedStrings = append(sharedStrings, current.String())
+			case "t":
+				inText = false
+			case "rPh":
+				inPhonetic = false
+			}
+		case xml.CharData:
+			if inText && !inPhonetic {
+				current.Write(element)
+			}
+		}
+	}
+}
+
+// readXLSXDateStyles returns the cell style indexes whose number format renders a date or time.
+func readXLSXDateStyles(parts map[string]*zip.File, guard *decompressionGuard) (map[int]bool, error) {
+	dateStyles := make(map[int]bool)
+	if _, ok := parts["xl/styles.xml"]; !ok {
+		return dateStyles, nil
+	}
+
+	var styles xlsxStyleSheet
+	if err := decodeXLSXPart(parts, "xl/styles.xml", guard, &styles); err != nil {
+		return nil, err
+	}
+
+	customDateFormats := make(map[int]bool)
+	for _, numFmt := range styles.NumFmts {
+		customDateFormats[numFmt.ID] = isDateFormatCode(numFmt.Code)
+	}
+	for i, xf := range styles.CellXfs {
+		if isDate, custom := customDateFormats[xf.NumFmtID]; custom {
+			dateStyles[i] = isDate
+		} else {
+			dateStyles[i] = builtinDateFormats[xf.NumFmtID]
+		}
+	}
+	return dateStyles, nil
+}
+
+// isDateFormatCode reports whether a custom number format contains date or time
+// tokens once quoted literals, escapes and bracketed colours/locales are removed.
+func isDateFormatCode(code string) bool {
+	var stripped strings.Builder
+	inQuote, inBracket, escaped := false, false, false
+	for _, r := range code {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote:
+			inQuote = r != '"'
+		case inBracket:
+			inBracket = r != ']'
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = true
+		case r == '[':
+			inBracket = true
+		default:
+			stripped.WriteRune(r)
+		}
+	}
+
+	lowered := strings.ToLower(stripped.String())
+	if lowered == "general" {
+		return false
+	}
+	return strings.ContainsAny(lowered, "ydmhs")
+}
+
+// Read returns the next row. Rows are padded to the width of the first row and
+// cells beyond it are dropped. It returns io.EOF after the last row.
+func (reader *xlsxRowReader) Read() ([]string, error) {
+	var row []string
+	inValue, inInline := false, false
+	var cellType, cellValue, inlineValue string
+	cellStyle, cellColumn := 0, 0
+
+	for {
+		token, err := reader.decoder.Token()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse worksheet: %w", err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "row":
+				row = row[:0]
+			case "c":
+				cellType, cellValue, inlineValue = "", "", ""
+				cellStyle, cellColumn = 0, len(row)
+				for _, attr := range element.Attr {
+					switch attr.Name.Local {
+					case "t":
+						cellType = attr.Value
+					case "s":
+						cellStyle, _ = strconv.Atoi(attr.Value)
+					case "r":
+						column, ok := xlsxColumnIndex(attr.Value)
+						if !ok {
+							return nil, fmt.Errorf("invalid cell reference %q", attr.Value)
+						}
+						cellColumn = column
+					}
+				}
+			case "v":
+				inValue = true
+			case "is":
+				inInline = true
+			}
+
+		case xml.CharData:
+			if inValue {
+				cellValue += string(element)
+			} else if inInline {
+				inlineValue += string(element)
+			}
+
+		case xml.EndElement:
+			switch element.Name.Local {
+			case "v":
+				inValue = false
+			case "is":
+				inInline = false
+			case "c":
+				// Cells past the header have no column to go to
+				if reader.width > 0 && cellColumn >= reader.width {
+					continue
+				}
+				for len(row) < cellColumn {
+					row = append(row, "")
+				}
+				value, err := reader.cellString(cellType, cellStyle, cellValue, inlineValue)
+				if err != nil {
+					return nil, err
+				}
+				row = append(row, value)
+			case "row":
+				return reader.normalizeWidth(row), nil
+			case "sheetData":
+				return nil, io.EOF
+			}
+		}
+	}
+}
+
+func (reader *xlsxRowReader) normalizeWidth(row []string) []string {
+	if reader.width == 0 {
+		reader.width = len(row)
+	}
+	for len(row) > reader.width && row[len(row)-1] == "" {
+		row = row[:len(row)-1]
+	}
+	for len(row) < reader.width {
+		row = append(row, "")
+	}
+	return append([]string(nil), row...)
+}
+
+func (reader *xlsxRowReader) cellString(cellType string, cellStyle int, value, inline string) (string, error) {
+	switch cellType {
+	case "s":
+		index, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || index < 0 || index >= len(reader.sharedStrings) {
+			return "", fmt.Errorf("invalid shared string reference: %s", value)
+		}
+		return reader.sharedStrings[index], nil
+	case "inlineStr":
+		return inline, nil
+	case "b":
+		return strconv.FormatBool(strings.TrimSpace(value) == "1"), nil
+	case "str", "e", "d":
+		return value, nil
+	}
+
+	if value == "" {
+		return "", nil
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return value, nil
+	}
+	if reader.dateStyles[cellStyle] {
+		return excelSerialToString(number, reader.date1904), nil
+	}
+	return formatExcelNumber(number), nil
+}
+
+// Close releases the worksheet stream.
+func (reader *xlsxRowReader) Close() error {
+	return reader.sheet.Close()
+}
+
+// formatExcelNumber renders a number with Excel's 15 significant digits of
+// precision, without exponent notation or trailing zeros.
+func formatExcelNumber(number float64) string {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(number, 'g', 15, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// excelSerialToString converts an Excel date serial into ISO 8601: a date, a
+// date-time, or a bare time for serials below one day.
+func excelSerialToString(serial float64, date1904 bool) string {
+	days := math.Floor(serial)
+	seconds := math.Round((serial - days) * 86400)
+
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	} else if days < 60 {
+		// Excel treats 1900 as a leap year, so serials before the phantom
+		// 29 February are offset by one day.
+		epoch = epoch.AddDate(0, 0, 1)
+	}
+	moment := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+
+	switch {
+	case days == 0 && !date1904:
+		return moment.Format("15:04:05")
+	case seconds == 0:
+		return moment.Format("2006-01-02")
+	default:
+		return moment.Format("2006-01-02T15:04:05")
+	}
+}
+
+// xlsxColumnIndex converts the column letters of a cell reference such as "AB12" to a zero-based index.
+// References past XFD, the last column Excel allows, are rejected.
+func xlsxColumnIndex(reference string) (int, bool) {
+	column := 0
+	letters := 0
+	for _, r := range reference {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		column = column*26 + int(r-'A'+1)
+		letters++
+		if column > xlsxMaxColumns {
+			return 0, false
+		}
+	}
+	if letters == 0 {
+		return 0, false
+	}
+	return column - 1, true
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config selects an S3-compatible bucket, such as AWS S3 or MinIO.
+type S3Config struct {
+	// Endpoint is the host and optional port, without scheme.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+	// Prefix is prepended to every key, so several deployments can share a bucket.
+	Prefix string
+}
+
+// S3ConfigFromEnv reads the S3_* environment variables. S3_USE_SSL defaults to true.
+func S3ConfigFromEnv() S3Config {
+	return S3Config{
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		Region:          os.Getenv("S3_REGION"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		UseSSL:          !strings.EqualFold(os.Getenv("S3_USE_SSL"), "false"),
+		Prefix:          os.Getenv("S3_PREFIX"),
+	}
+}
+
+// S3Storage keeps objects in an S3-compatible bucket.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// DSS3Storage connects to the bucket and creates it when it does not exist.
+func DSS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("S3 storage requires S3_ENDPOINT and S3_BUCKET")
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach S3 bucket %s: %w", config.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create S3 bucket %s: %w", config.Bucket, err)
+		}
+	}
+
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3Storage{client: client, bucket: config.Bucket, prefix: prefix}, nil
+}
+
+func (s3 *S3Storage) Put(ctx context.Context, key string, reader io.Reader, size int64) error {
+	_, err := s3.client.PutObject(ctx, s3.bucket, s3.prefix+key, reader, size, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	return err
+}
+
+func (s3 *S3Storage) Get(ctx context.Context, key string) ([]byte, error) {
+	return readAll(ctx, s3, key)
+}
+
+// Open checks that the object exists first, because GetObject only reports a
+// missing key on the first read.
+func (s3 *S3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s3.client.GetObject(ctx, s3.bucket, s3.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s3Error(err)
+	}
+	return object, nil
+}
+
+func (s3 *S3Storage) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s3.client.StatObject(ctx, s3.bucket, s3.prefix+key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s3Error(err)
+	}
+	return ObjectInfo{Key: key, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s3 *S3Storage) Delete(ctx context.Context, key string) error {
+	return s3Error(s3.client.RemoveObject(ctx, s3.bucket, s3.prefix+key, minio.RemoveObjectOptions{}))
+}
+
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	if response := minio.ToErrorResponse(err); response.Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+// Package storage abstracts where processed files are kept, so several
+// replicas of the service can share them through an object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// ErrNotFound is returned when no object exists under a key.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage stores objects under slash separated keys.
+type Storage interface {
+	// Put stores the content of reader under key, replacing any existing
+	// object. size is the content length, or -1 when unknown.
+	Put(ctx context.Context, key string, reader io.Reader, size int64) error
+	// Get reads a whole object into memory.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Open streams an object; the caller must close the reader.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete removes an object. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// DSStorageFromEnv builds the backend selected by STORAGE_BACKEND. The local
+// backend, the default, keeps objects in localDir.
+func DSStorageFromEnv(localDir string) (Storage, error) {
+	switch backend := strings.ToLower(os.Getenv("STORAGE_BACKEND")); backend {
+	case "", BackendLocal:
+		return DSLocalStorage(localDir)
+	case BackendS3:
+		return DSS3Storage(S3ConfigFromEnv())
+	default:
+		return nil, fmt.Errorf("unsupported STORAGE_BACKEND: %s", backend)
+	}
+}
+
+// readAll reads an object opened through storage.Open.
+func readAll(ctx context.Context, storage Storage, key string) ([]byte, error) {
+	reader, err := storage.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testStorage runs the behaviour every backend must share.
+func testStorage(t *testing.T, store Storage) {
+	ctx := context.Background()
+	key := "jobs/" + uuid.New().String() + "_processed.csv"
+	content := []byte("name,email,has_email\nJohn,john@test.com,true\n")
+
+	if _, err := store.Stat(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound before Put, got %v", err)
+	}
+
+	if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	data, err := store.Get(ctx, key)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("Get returned %q, %v", data, err)
+	}
+
+	reader, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	streamed, _ := io.ReadAll(reader)
+	reader.Close()
+	if !bytes.Equal(streamed, content) {
+		t.Errorf("Open streamed %q", streamed)
+	}
+
+	info, err := store.Stat(ctx, key)
+	if err != nil || info.Size != int64(len(content)) {
+		t.Errorf("Stat returned %+v, %v", info, err)
+	}
+
+	// Put replaces the object, with an unknown size this time
+	if err := store.Put(ctx, key, strings.NewReader("replaced"), -1); err != nil {
+		t.Fatalf("Put with unknown size failed: %v", err)
+	}
+	if data, _ := store.Get(ctx, key); string(data) != "replaced" {
+		t.Errorf("Expected replaced content, got %q", data)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Open(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after Delete, got %v", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Deleting a missing key should succeed, got %v", err)
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	store, err := DSLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create local storage: %v", err)
+	}
+	testStorage(t, store)
+
+	if err := store.Put(context.Background(), "../escape.csv", strings.NewReader("x"), 1); err == nil {
+		t.Error("Keys outside the storage directory should be rejected")
+	}
+}
+
+// TestS3Storage runs against an S3-compatible server such as a local MinIO:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=localhost:9000 go test ./internal/storage
+func TestS3Storage(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+
+	config := S3Config{
+		Endpoint:        endpoint,
+		Bucket:          "demandscience-test",
+		AccessKeyID:     "minioadmin",
+		SecretAccessKey: "minioadmin",
+		Prefix:          "storage-test",
+	}
+	if value := os.Getenv("S3_TEST_ACCESS_KEY_ID"); value != "" {
+		config.AccessKeyID = value
+		config.SecretAccessKey = os.Getenv("S3_TEST_SECRET_ACCESS_KEY")
+	}
+
+	store, err := DSS3Storage(config)
+	if err != nil {
+		t.Fatalf("Failed to connect to S3: %v", err)
+	}
+	testStorage(t, store)
+}